@@ -1,76 +1,200 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"maps"
 	"math"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+	"unicode"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type applicant struct {
 	ID             string
+	OriginalID     string
+	SourceLine     int
 	Name           string
 	NeedLevel      string
 	ScoreRaw       float64
 	ScoreNorm      float64
 	Requested      float64
+	OtherAid       float64
+	CostOfAttend   float64
+	FTE            float64
+	EligibleUntil  time.Time
+	NeedWeight     float64
+	HasNeedWeight  bool
+	PriorAwards    int
+	Rank           int
+	RankNorm       float64
+	RequestNorm    float64
+	AwardBasis     float64
 	PriorityScore  float64
+	ScoreContrib   float64
+	NeedContrib    float64
+	RequestContrib float64
 	Awarded        float64
+	Match          float64
+	Swept          float64
+	ToppedUp       float64
+	StretchShave   float64
+	StretchAdded   bool
+	Constraint     string
+	Pass           string
 	Eligible       bool
+	Declined       bool
 	EligibilityMsg string
+	Extras         map[string]string
 }
 
 type allocationSummary struct {
 	GeneratedAt             string                     `json:"generated_at"`
+	ResultHash              string                     `json:"result_hash"`
+	GeneratedTime           time.Time                  `json:"-"`
+	PriorityPrecision       int                        `json:"-"`
+	AnonymizeNames          bool                       `json:"-"`
+	IneligibleReasonsTop    int                        `json:"-"`
+	Preview                 *previewInfo               `json:"preview,omitempty"`
 	Budget                  float64                    `json:"budget"`
 	BudgetUsed              float64                    `json:"budget_used"`
+	EffectiveBudget         float64                    `json:"effective_budget,omitempty"`
+	EffectiveBudgetNote     string                     `json:"effective_budget_note,omitempty"`
+	TermYears               int                        `json:"term_years,omitempty"`
+	AnnualBudget            float64                    `json:"annual_budget,omitempty"`
+	AnnualBudgetUsed        float64                    `json:"annual_budget_used,omitempty"`
+	AnnualRequestedTotal    float64                    `json:"annual_requested_total,omitempty"`
+	TotalEffectiveAwarded   float64                    `json:"total_effective_awarded"`
 	BudgetLeft              float64                    `json:"budget_left"`
+	StrandedBudget          float64                    `json:"stranded_budget,omitempty"`
 	BudgetRequiredFull      float64                    `json:"budget_required_full"`
 	BudgetShortfall         float64                    `json:"budget_shortfall"`
 	Applicants              int                        `json:"applicants"`
 	EligibleCount           int                        `json:"eligible_count"`
 	AwardedCount            int                        `json:"awarded_count"`
 	IneligibleCount         int                        `json:"ineligible_count"`
+	DeclinedCount           int                        `json:"declined_count,omitempty"`
 	EligibleUnfundedCount   int                        `json:"eligible_unfunded_count"`
 	EligibleUnfundedAmount  float64                    `json:"eligible_unfunded_amount"`
 	EligibleRequestedTotal  float64                    `json:"eligible_requested_total"`
 	FullyFundedCount        int                        `json:"fully_funded_count"`
 	PartiallyFundedCount    int                        `json:"partially_funded_count"`
+	MaxPartial              int                        `json:"max_partial,omitempty"`
 	FundingGapTotal         float64                    `json:"funding_gap_total"`
+	GapClosedPerDollar      float64                    `json:"gap_closed_per_dollar"`
 	CoverageRate            float64                    `json:"coverage_rate"`
 	FullFundingRate         float64                    `json:"full_funding_rate"`
+	IncludesIneligibleRates bool                       `json:"includes_ineligible_rates,omitempty"`
+	AllRequestedTotal       float64                    `json:"all_requested_total,omitempty"`
+	CoverageRateAll         float64                    `json:"coverage_rate_all,omitempty"`
+	FullFundingRateAll      float64                    `json:"full_funding_rate_all,omitempty"`
 	AverageAward            float64                    `json:"average_award"`
 	AwardP25                float64                    `json:"award_p25"`
 	AwardP50                float64                    `json:"award_p50"`
 	AwardP75                float64                    `json:"award_p75"`
 	AwardToRequestAvg       float64                    `json:"award_to_request_avg"`
+	RequestedTotal          float64                    `json:"requested_total"`
+	RequestedMean           float64                    `json:"requested_mean"`
+	RequestedP25            float64                    `json:"requested_p25"`
+	RequestedP50            float64                    `json:"requested_p50"`
+	RequestedP75            float64                    `json:"requested_p75"`
 	MinAwarded              float64                    `json:"min_awarded"`
 	MaxAwarded              float64                    `json:"max_awarded"`
 	LastFundedPriority      float64                    `json:"last_funded_priority"`
 	LastFundedScore         float64                    `json:"last_funded_score"`
 	LastFundedNeed          string                     `json:"last_funded_need"`
 	LastFundedRequested     float64                    `json:"last_funded_requested"`
+	FirstUnfundedPriority   float64                    `json:"first_unfunded_priority"`
+	FirstUnfundedScore      float64                    `json:"first_unfunded_score"`
+	FirstUnfundedNeed       string                     `json:"first_unfunded_need"`
+	FirstUnfundedRequested  float64                    `json:"first_unfunded_requested"`
+	Boundary                []boundaryRecord           `json:"boundary,omitempty"`
+	RequestCapAmount        float64                    `json:"request_cap_amount,omitempty"`
+	MedianAwardCap          float64                    `json:"median_award_cap,omitempty"`
+	RequestCappedCount      int                        `json:"request_capped_count,omitempty"`
+	FlagCapped              bool                       `json:"-"`
+	MaxCappedCount          int                        `json:"max_capped_count"`
+	MaxCappedTrimmed        float64                    `json:"max_capped_trimmed"`
+	SweptAmount             float64                    `json:"swept_amount,omitempty"`
+	SweptCount              int                        `json:"swept_count,omitempty"`
+	TopupAmount             float64                    `json:"topup_amount,omitempty"`
+	TopupCount              int                        `json:"topup_count,omitempty"`
+	StretchShave            float64                    `json:"stretch_shave,omitempty"`
+	StretchAddedCount       int                        `json:"stretch_added_count,omitempty"`
+	LevelCaps               []levelCapUsage            `json:"level_caps,omitempty"`
+	LevelCapWarnings        []string                   `json:"level_cap_warnings,omitempty"`
 	ByNeed                  map[string]needAgg         `json:"by_need"`
+	GroupBy                 string                     `json:"group_by,omitempty"`
+	ByGroup                 map[string]needCoverageAgg `json:"by_group,omitempty"`
+	ByProgram               map[string]programAgg      `json:"by_program,omitempty"`
+	ByNeedBudget            map[string]programAgg      `json:"by_need_budget,omitempty"`
+	Representation          []representResult          `json:"representation,omitempty"`
 	NeedCoverage            map[string]needCoverageAgg `json:"need_coverage"`
 	UnfundedByNeed          map[string]needUnfundedAgg `json:"unfunded_by_need"`
 	IneligibleReasonSummary map[string]int             `json:"ineligible_reasons"`
+	ConstraintSummary       map[string]int             `json:"constraint_summary"`
 	Awards                  []awardRecord              `json:"awards"`
 	Unfunded                []awardRecord              `json:"unfunded"`
 	Ineligible              []ineligibleRecord         `json:"ineligible"`
+	NearMisses              []nearMissRecord           `json:"near_misses,omitempty"`
+	PassBreakdown           []passResult               `json:"pass_breakdown,omitempty"`
+	Rounds                  []roundResult              `json:"rounds,omitempty"`
 	ScenarioResults         []scenarioResult           `json:"scenario_results,omitempty"`
+	ScenarioSteps           []scenarioStep             `json:"scenario_steps,omitempty"`
+	CoverageLadder          []ladderStep               `json:"coverage_ladder,omitempty"`
+	ShadowComparison        *shadowComparison          `json:"shadow_comparison,omitempty"`
+	Withdrawal              *withdrawalImpact          `json:"withdrawal,omitempty"`
+	ModeComparison          []modeResult               `json:"mode_comparison,omitempty"`
+	WeightSweep             []weightSweepResult        `json:"weight_sweep,omitempty"`
+}
+
+// passResult is what one allocation pass spent. For the sweep and topup
+// passes, Funded counts awards that were topped up.
+type passResult struct {
+	Name   string  `json:"name"`
+	Spent  float64 `json:"spent"`
+	Funded int     `json:"funded"`
+}
+
+type previewInfo struct {
+	Sampled     int     `json:"sampled"`
+	Total       int     `json:"total"`
+	Random      bool    `json:"random"`
+	Seed        int64   `json:"seed,omitempty"`
+	FullBudget  float64 `json:"full_budget"`
+	BudgetScale float64 `json:"budget_scale"`
+}
+
+// levelCapUsage reports one need level's absolute -cap-<level>-amount limit
+// against what the level was awarded.
+type levelCapUsage struct {
+	NeedLevel string  `json:"need_level"`
+	Cap       float64 `json:"cap"`
+	Used      float64 `json:"used"`
+	Reached   bool    `json:"reached"`
 }
 
 type needAgg struct {
@@ -78,12 +202,40 @@ type needAgg struct {
 	BudgetUsed   float64 `json:"budget_used"`
 }
 
+type programAgg struct {
+	Budget         float64 `json:"budget"`
+	BudgetUsed     float64 `json:"budget_used"`
+	BudgetLeft     float64 `json:"budget_left"`
+	EligibleCount  int     `json:"eligible_count"`
+	AwardedCount   int     `json:"awarded_count"`
+	UnfundedCount  int     `json:"unfunded_count"`
+	RequestedTotal float64 `json:"requested_total"`
+	CoverageRate   float64 `json:"coverage_rate"`
+}
+
+type representRule struct {
+	Column string `json:"column"`
+	Value  string `json:"value"`
+	Count  int    `json:"count"`
+}
+
+type representResult struct {
+	Column        string  `json:"column"`
+	Value         string  `json:"value"`
+	Target        int     `json:"target"`
+	EligibleCount int     `json:"eligible_count"`
+	AwardedCount  int     `json:"awarded_count"`
+	AwardedTotal  float64 `json:"awarded_total"`
+	Met           bool    `json:"met"`
+}
+
 type needCoverageAgg struct {
 	EligibleCount  int     `json:"eligible_count"`
 	AwardedCount   int     `json:"awarded_count"`
 	UnfundedCount  int     `json:"unfunded_count"`
 	RequestedTotal float64 `json:"requested_total"`
 	AwardedTotal   float64 `json:"awarded_total"`
+	FundingGap     float64 `json:"funding_gap"`
 	CoverageRate   float64 `json:"coverage_rate"`
 	RequestedShare float64 `json:"requested_share"`
 	AwardedShare   float64 `json:"awarded_share"`
@@ -96,6 +248,23 @@ type needUnfundedAgg struct {
 }
 
 type awardRecord struct {
+	Rank        int     `json:"rank,omitempty"`
+	ApplicantID string  `json:"applicant_id"`
+	OriginalID  string  `json:"original_id,omitempty"`
+	SourceLine  int     `json:"source_line,omitempty"`
+	Name        string  `json:"name"`
+	NeedLevel   string  `json:"need_level"`
+	Score       float64 `json:"score"`
+	Requested   float64 `json:"requested"`
+	Awarded     float64 `json:"awarded"`
+	Effective   float64 `json:"effective_awarded"`
+	Priority    float64 `json:"priority"`
+	Margin      float64 `json:"margin_to_cutoff"`
+	Constraint  string  `json:"constraint,omitempty"`
+}
+
+// boundaryRecord is an eligible applicant tied at the last-funded priority.
+type boundaryRecord struct {
 	ApplicantID string  `json:"applicant_id"`
 	Name        string  `json:"name"`
 	NeedLevel   string  `json:"need_level"`
@@ -103,10 +272,13 @@ type awardRecord struct {
 	Requested   float64 `json:"requested"`
 	Awarded     float64 `json:"awarded"`
 	Priority    float64 `json:"priority"`
+	Funded      bool    `json:"funded"`
 }
 
 type ineligibleRecord struct {
 	ApplicantID string  `json:"applicant_id"`
+	OriginalID  string  `json:"original_id,omitempty"`
+	SourceLine  int     `json:"source_line,omitempty"`
 	Name        string  `json:"name"`
 	NeedLevel   string  `json:"need_level"`
 	Score       float64 `json:"score"`
@@ -114,6 +286,14 @@ type ineligibleRecord struct {
 	Reason      string  `json:"reason"`
 }
 
+// nearMissRecord is an applicant excluded only by the minimum score, with the
+// threshold that applied and how far below it the score fell.
+type nearMissRecord struct {
+	ineligibleRecord
+	Threshold float64 `json:"threshold"`
+	BelowBy   float64 `json:"below_by"`
+}
+
 type needAwardCaps struct {
 	MinHigh   float64
 	MaxHigh   float64
@@ -123,6 +303,124 @@ type needAwardCaps struct {
 	MaxLow    float64
 }
 
+type needMinScores struct {
+	High   float64
+	Medium float64
+	Low    float64
+}
+
+// forNeed returns the minimum score for a need level, falling back to the
+// global minimum when the tier threshold is unset (negative).
+func (scores needMinScores) forNeed(level string, global float64) (float64, bool) {
+	var tier float64
+	switch strings.ToLower(level) {
+	case "high":
+		tier = scores.High
+	case "medium":
+		tier = scores.Medium
+	case "low":
+		tier = scores.Low
+	default:
+		return global, false
+	}
+	if tier < 0 {
+		return global, false
+	}
+	return tier, true
+}
+
+type roundResult struct {
+	Round           int     `json:"round"`
+	BudgetAvailable float64 `json:"budget_available"`
+	Offered         int     `json:"offered"`
+	OfferedAmount   float64 `json:"offered_amount"`
+	Declined        int     `json:"declined"`
+	DeclinedAmount  float64 `json:"declined_amount"`
+	Accepted        int     `json:"accepted"`
+	BudgetUsed      float64 `json:"budget_used"`
+}
+
+type modeResult struct {
+	Mode            string  `json:"mode"`
+	AwardedCount    int     `json:"awarded_count"`
+	CoverageRate    float64 `json:"coverage_rate"`
+	FullFundingRate float64 `json:"full_funding_rate"`
+	Gini            float64 `json:"gini"`
+	BudgetUsed      float64 `json:"budget_used"`
+	BudgetLeft      float64 `json:"budget_left"`
+}
+
+type weightSweepResult struct {
+	ScoreWeight     float64            `json:"score_weight"`
+	NeedWeight      float64            `json:"need_weight"`
+	AwardedCount    int                `json:"awarded_count"`
+	CoverageRate    float64            `json:"coverage_rate"`
+	FullFundingRate float64            `json:"full_funding_rate"`
+	NeedCoverage    map[string]float64 `json:"need_coverage"`
+}
+
+type shadowComparison struct {
+	Actual           scenarioResult `json:"actual"`
+	Shadow           scenarioResult `json:"shadow"`
+	AdditionalFunded int            `json:"additional_funded"`
+}
+
+type withdrawalImpact struct {
+	ApplicantID string           `json:"applicant_id"`
+	Name        string           `json:"name"`
+	BudgetFreed float64          `json:"budget_freed"`
+	Gains       []withdrawalGain `json:"gains"`
+}
+
+type withdrawalGain struct {
+	ApplicantID string  `json:"applicant_id"`
+	Name        string  `json:"name"`
+	Before      float64 `json:"before"`
+	After       float64 `json:"after"`
+	NewlyFunded bool    `json:"newly_funded"`
+}
+
+type ladderStep struct {
+	TargetCoverage float64 `json:"target_coverage"`
+	Reachable      bool    `json:"reachable"`
+	Budget         float64 `json:"budget"`
+	MarginalBudget float64 `json:"marginal_budget"`
+	CoverageRate   float64 `json:"coverage_rate"`
+	AwardedCount   int     `json:"awarded_count"`
+}
+
+type cutoffExplanation struct {
+	BudgetLeft float64
+	LastFunded *applicant
+	Next       []cutoffCandidate
+}
+
+type cutoffCandidate struct {
+	Applicant        *applicant
+	PlannedAward     float64
+	AdditionalToFund float64
+}
+
+// appealDocument is the single-applicant record behind -appeal-export: the
+// inputs that set their priority, the outcome, and the run's parameters.
+type appealDocument struct {
+	GeneratedAt  string
+	Applicant    *applicant
+	ScoreMaxRef  float64
+	ScoreTerm    float64
+	NeedTerm     float64
+	RequestTerm  float64
+	Cutoff       float64
+	PlannedAward float64
+	BudgetLeft   float64
+	Parameters   []appealParameter
+}
+
+type appealParameter struct {
+	Name  string
+	Value string
+}
+
 type scenarioResult struct {
 	Budget                float64 `json:"budget"`
 	BudgetUsed            float64 `json:"budget_used"`
@@ -138,11 +436,26 @@ type scenarioResult struct {
 	FundingGapTotal       float64 `json:"funding_gap_total"`
 	AverageAward          float64 `json:"average_award"`
 	AwardToRequestAvg     float64 `json:"award_to_request_avg"`
+
+	// fundedIDs lists the applicants funded at this budget in priority
+	// order, kept for -scenario-detail.
+	fundedIDs []string
+	// needCoverage is the awarded share of eligible requests per need
+	// level, kept for -sweep-weights.
+	needCoverage map[string]float64
+}
+
+// scenarioStep lists who a scenario budget funds that the previous scenario
+// budget in the list did not.
+type scenarioStep struct {
+	FromBudget     float64  `json:"from_budget"`
+	ToBudget       float64  `json:"to_budget"`
+	NewlyFundedIDs []string `json:"newly_funded_ids"`
 }
 
 func main() {
-	inputPath := flag.String("input", "", "Path to applicant CSV file")
-	budget := flag.Float64("budget", 0, "Total award budget")
+	inputPath := flag.String("input", "", "Path to applicant CSV file, or an .xlsx workbook (first sheet)")
+	budget := flag.Float64("budget", 0, "Total award budget (defaults to GS_AWARD_ALLOCATOR_BUDGET when unset)")
 	minAward := flag.Float64("min", 500, "Minimum award amount")
 	maxAward := flag.Float64("max", 5000, "Maximum award amount")
 	minHigh := flag.Float64("min-high", -1, "Minimum award for high-need applicants (-1 uses global min)")
@@ -153,93 +466,439 @@ func main() {
 	maxLow := flag.Float64("max-low", -1, "Maximum award for low-need applicants (-1 uses global max)")
 	scoreWeight := flag.Float64("score-weight", 0.7, "Weight for applicant score (0-1)")
 	needWeight := flag.Float64("need-weight", 0.3, "Weight for need level (0-1)")
+	requestWeight := flag.Float64("request-weight", 0, "Weight for requested amount normalized by the largest request (0 disables)")
+	scoreMaxRef := flag.Float64("score-max-ref", 0, "Fixed score maximum used for normalization instead of the observed max (0 uses the observed max)")
+	repeatPenalty := flag.Float64("repeat-penalty", 0, "Priority subtracted per prior award from the prior_awards column (0 disables)")
+	efficiencyBias := flag.Float64("efficiency-bias", 0, "Boost priority for smaller requests by priority x (1 + bias x (1 - normalized request)), 0-1 (0 disables)")
 	reserveHigh := flag.Float64("reserve-high", 0, "Share of budget reserved for high-need applicants (0-1)")
 	reserveMedium := flag.Float64("reserve-medium", 0, "Share of budget reserved for medium-need applicants (0-1)")
 	reserveLow := flag.Float64("reserve-low", 0, "Share of budget reserved for low-need applicants (0-1)")
+	capHighAmount := flag.Float64("cap-high-amount", 0, "Maximum total dollars awarded to high-need applicants (0 disables)")
+	capMediumAmount := flag.Float64("cap-medium-amount", 0, "Maximum total dollars awarded to medium-need applicants (0 disables)")
+	capLowAmount := flag.Float64("cap-low-amount", 0, "Maximum total dollars awarded to low-need applicants (0 disables)")
 	roundTo := flag.Float64("round", 0, "Round awards to nearest increment (0 disables)")
+	awardIncrement := flag.Float64("award-increment", 0, "Floor awards to a multiple of this amount, never rounding up (0 disables)")
+	needCodesFlag := flag.String("need-codes", "", "Map coded need_level values to levels before eligibility checks (e.g. 1=low,2=medium,3=high)")
+	needBinsFlag := flag.String("need-bins", "", "Two thresholds (e.g. 0.33,0.66) that bin a need_index column into low/medium/high; priority uses the raw index")
+	roundToSet := flag.String("round-to-set", "", "Comma-separated standard award amounts to snap awards to (e.g. 500,1000,2500)")
 	maxPercent := flag.Float64("max-percent", 1, "Max percent of requested amount to award (0-1]")
+	maxSpendPercent := flag.Float64("max-spend-percent", 0, "Cap spending at this share of eligible demand (0-1], even when the budget allows more (0 disables)")
+	maxAwardMedianMultiple := flag.Float64("max-award-median-multiple", 0, "Cap each award at this multiple of the median eligible request (0 disables)")
+	requestCapPercentile := flag.Float64("request-cap-percentile", 0, "Cap requests above this percentile of eligible requests for award computation (0-1, 0 disables)")
 	minScore := flag.Float64("min-score", 0, "Minimum applicant score to be eligible")
+	minScoreHigh := flag.Float64("min-score-high", -1, "Minimum score for high-need applicants (-1 uses global min-score)")
+	minScoreMedium := flag.Float64("min-score-medium", -1, "Minimum score for medium-need applicants (-1 uses global min-score)")
+	minScoreLow := flag.Float64("min-score-low", -1, "Minimum score for low-need applicants (-1 uses global min-score)")
+	eligibleTopPct := flag.Float64("eligible-top-percent", 0, "Only applicants within this top fraction of the pool by score are eligible (0-1, e.g. 0.2 for the top 20%; 0 disables)")
+	normalizeIDs := flag.Bool("normalize-ids", false, "Trim and upper-case applicant IDs (and IDs passed to -declined-ids and -appeal-export) so formatting differences match")
+	idStrip := flag.String("id-strip", "", "Characters -normalize-ids also removes from IDs (e.g. \"-_. \")")
+	decimalComma := flag.Bool("decimal-comma", false, "Parse amounts with a comma decimal separator and dot grouping (e.g. 1.250,00)")
+	amountScale := flag.Float64("amount-scale", 1, "Multiplier applied to requested_amount when parsing (e.g. 0.01 for amounts exported in cents)")
 	jsonPath := flag.String("json", "", "Optional path to write JSON output")
+	summaryJSONPath := flag.String("summary-only-json", "", "Optional path to write JSON output without per-applicant arrays")
+	jsonCompact := flag.Bool("json-compact", false, "Write -json and -summary-only-json output on a single line instead of indented")
+	summaryCSV := flag.String("summary-csv", "", "Optional path to write summary metrics as metric,value CSV rows")
+	sortOutput := flag.String("sort-output", "priority", "Order of the awards, unfunded, and ineligible lists in JSON and CSV files: priority or id")
+	sortAwardsBy := flag.String("sort-awards", "priority", "Display order for the awards list: priority, name, need, awarded-desc, or id (allocation is unchanged)")
+	errorOnCutoffTie := flag.Bool("error-on-cutoff-tie", false, "Exit with status 3 when a priority tie at the funding cutoff decided who was funded")
+	requireFullSpend := flag.Bool("require-full-spend", false, "Exit with status 4 when more than -full-spend-tolerance of the budget is left unspent after allocation")
+	fullSpendTolerance := flag.Float64("full-spend-tolerance", 1, "Unspent amount -require-full-spend allows before failing the run")
+	nearMissDelta := flag.Float64("near-miss-delta", 0, "List applicants excluded only by the minimum score who fell within this many points of it (0 disables)")
+	flagCapped := flag.Bool("flag-capped", false, "Report applicants whose award was trimmed by the max award and add a capped_by column to the awards CSV")
+	sourceLines := flag.Bool("source-lines", false, "Add a source_line column with each applicant's input line number to the awards, unfunded, and ineligible CSVs")
 	awardsCSV := flag.String("awards-csv", "", "Optional path to write awarded applicants CSV")
+	fixedWidthPath := flag.String("fixed-width", "", "Optional path to write awards as fixed-width records (requires -fixed-width-spec)")
+	fixedWidthSpecFlag := flag.String("fixed-width-spec", "", "Fixed-width record layout as field:width pairs, e.g. id:12,amount:10,need:8 (fields: id, name, need, score, requested, amount)")
+	awardsTxt := flag.String("awards-txt", "", "Optional path to write the console awards list as plain text (honors -top and -all)")
 	unfundedCSV := flag.String("unfunded-csv", "", "Optional path to write unfunded eligible applicants CSV")
 	ineligibleCSV := flag.String("ineligible-csv", "", "Optional path to write ineligible applicants CSV")
+	priorityBreakdownCSV := flag.String("priority-breakdown-csv", "", "Optional path to write each eligible applicant's priority formula breakdown as CSV")
+	xlsxPath := flag.String("xlsx", "", "Optional path to write an Excel workbook with awards, unfunded, ineligible, and summary sheets")
+	lettersDir := flag.String("letters", "", "Optional directory to write one award letter per funded applicant")
+	letterTemplate := flag.String("letter-template", "", "Template file (text/template) used to render award letters")
+	promFile := flag.String("prom-file", "", "Optional path to write Prometheus textfile-collector metrics")
 	reportPath := flag.String("report", "", "Optional path to write Markdown allocation report")
-	scenarioBudgets := flag.String("scenario-budgets", "", "Comma-separated budgets for scenario analysis")
+	outputsManifestPath := flag.String("outputs-manifest", "", "Optional path to write a JSON list of every output file written, with its type and SHA-256")
+	manifestPath := flag.String("manifest", "", "Optional path to write a run manifest (resolved options and input hash)")
+	reproducePath := flag.String("reproduce", "", "Re-run an allocation from a previously written manifest")
+	ignoreHash := flag.Bool("ignore-hash", false, "Skip input hash verification when using -reproduce")
+	asOf := flag.String("as-of", "", "Run date (YYYY-MM-DD) for eligible_until expirations (defaults to today in -timezone)")
+	excludeFundedSince := flag.String("exclude-funded-since", "", "Mark applicants awarded in any database run generated on or after this date (YYYY-MM-DD) as ineligible")
+	recomputeRunID := flag.String("recompute-from-db", "", "Re-run the current allocation on applicants logged under a database run ID (flags override stored options)")
+	timeFormat := flag.String("time-format", "rfc3339", "Timestamp format for generated_at: rfc3339, date, or a Go time layout")
+	timezone := flag.String("timezone", "UTC", "Time zone for generated_at (IANA name, UTC, or Local)")
+	includeIneligible := flag.Bool("include-ineligible-in-coverage", false, "Also report coverage and full-funding rates using all applicants as the denominator")
+	groupBy := flag.String("group-by", "", "Optional CSV column to aggregate awards and coverage by (e.g. cohort)")
+	minRepresent := flag.String("min-represent", "", "Minimum awards among applicants matching a column value (e.g. first_gen:true=10,rural:yes=5)")
+	budgetHigh := flag.Float64("budget-high", 0, "Separate budget for high-need applicants; any need-level budget replaces the shared pool and reserves")
+	budgetMedium := flag.Float64("budget-medium", 0, "Separate budget for medium-need applicants")
+	budgetLow := flag.Float64("budget-low", 0, "Separate budget for low-need applicants")
+	programBudgets := flag.String("program-budgets", "", "Independent budgets per program column value (e.g. stem=50000,arts=20000)")
+	sweep := flag.Bool("sweep", false, "Top up partially funded awards with leftover budget, smallest gaps first")
+	topupLeftover := flag.Bool("topup-leftover", false, "Top up partially funded awards with leftover budget in priority order")
+	maxPartial := flag.Int("max-partial", 0, "Once this many awards are partial, fund only applicants who can be funded in full (0 disables)")
+	stretchPct := flag.Float64("stretch-percent", 0, "Shave every award by up to this share (0-1) when that funds more eligible applicants (0 disables)")
+	minMeaningfulAward := flag.Float64("min-meaningful-award", 0, "Stop allocating once the remaining budget falls below this amount and report it as stranded (0 disables)")
+	tiebreak := flag.String("tiebreak", "score", "Comma-separated tie-break order for equal priorities: score, requested-asc, requested-desc")
+	prioritySource := flag.String("priority-source", prioritySourceComputed, "Where priority comes from: computed (score/need formula), external (the rank column), or blend")
+	rankWeight := flag.Float64("rank-weight", 0.5, "Weight of the normalized external rank when -priority-source is blend (0-1)")
+	reserveMode := flag.String("reserve-mode", reserveModePriority, "How each need-level reserve is shared: priority/greedy (highest priority first) or spread/proportional (proportional across the level)")
+	tierStrict := flag.Bool("tier-strict", false, "Fund need tiers in order (high, medium, low), finishing each tier before the next")
+	rounds := flag.Int("rounds", 1, "Number of allocation rounds; declined offers are reallocated between rounds")
+	termYears := flag.Int("term-years", 1, "Multiply requested_amount and other_aid by this many years; the budget must cover the full multi-year commitment")
+	declinedIDs := flag.String("declined-ids", "", "Comma-separated applicant IDs that decline their award offer (used with -rounds)")
+	compareModes := flag.String("compare-modes", "", "Comma-separated allocation modes to compare (priority, proportional, equal, max-recipients)")
+	sweepWeights := flag.String("sweep-weights", "", "Comma-separated score/need weight pairs to compare, e.g. 0.5/0.5,0.7/0.3,0.9/0.1")
+	shadowBudget := flag.Float64("shadow-budget", 0, "Aspirational budget to compare against the actual budget (0 disables)")
+	withdrawID := flag.String("withdraw-id", "", "Re-run the allocation without this applicant and report who gains funding and the budget freed")
+	scenarioBudgets := flag.String("scenario-budgets", "", "Comma-separated budgets for scenario analysis (0 is allowed as a no-funding baseline)")
+	scenarioDetail := flag.Bool("scenario-detail", false, "Add the applicant IDs each scenario budget newly funds over the previous one to the JSON output")
+	coverageLadder := flag.Bool("coverage-ladder", false, "Compute the minimum budget needed to reach each 10% coverage step")
+	coverageLadderCSV := flag.String("coverage-ladder-csv", "", "Optional path to write the coverage ladder CSV (implies -coverage-ladder)")
 	topN := flag.Int("top", 10, "Number of awarded applicants to display")
 	showAll := flag.Bool("all", false, "Show all awarded applicants")
 	unfundedTop := flag.Int("unfunded", 10, "Number of unfunded eligible applicants to display")
+	ineligibleReasonsTop := flag.Int("ineligible-reasons-top", 3, "Number of ineligible reasons to display in the console and report (0 shows all)")
 	showAllUnfunded := flag.Bool("unfunded-all", false, "Show all unfunded eligible applicants")
+	priorityPrecision := flag.Int("priority-precision", 4, "Decimal places for priority scores in console, CSV, JSON, and report output")
+	anonymizeNames := flag.Bool("anonymize-names", false, "Mask applicant names as initials in console and Markdown report output (CSV and JSON keep full names)")
+	appealExport := flag.String("appeal-export", "", "Applicant ID to export a shareable decision record for (inputs, outcome, and run parameters)")
+	appealOut := flag.String("appeal-out", "", "Optional path for the -appeal-export record (prints to stdout when unset)")
+	explainCutoff := flag.Bool("explain-cutoff", false, "Print the last funded and first unfunded applicants with the extra budget needed to fund them")
+	previewCount := flag.Int("preview", 0, "Run on only the first n valid applicants with a proportionally scaled budget (0 disables)")
+	previewRandom := flag.Bool("preview-random", false, "With -preview, sample n applicants at random instead of taking the first n")
+	previewSeed := flag.Int64("preview-seed", 1, "Random seed for -preview-random")
+	verbose := flag.Bool("verbose", false, "Print normalization and priority intermediate values for ranked applicants")
+	dryRun := flag.Bool("dry-run", false, "Run the full allocation and console output but skip every file write and database log, listing what would be written")
 	dbLog := flag.Bool("db-log", false, "Log allocation run to Postgres when GS_AWARD_ALLOCATOR_DB_URL is set")
 	flag.Parse()
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
 
-	if *inputPath == "" || *budget <= 0 {
-		exitWith("input and budget are required")
+	if *lettersDir != "" && *letterTemplate == "" {
+		exitWith("letters requires -letter-template")
+	}
+	if *priorityPrecision < 0 || *priorityPrecision > 10 {
+		exitWith("priority-precision must be between 0 and 10")
+	}
+	if *previewCount < 0 {
+		exitWith("preview must be >= 0")
+	}
+	if *sortOutput != "priority" && *sortOutput != "id" {
+		exitWith(fmt.Sprintf("unknown sort-output order: %s (expected priority or id)", *sortOutput))
+	}
+	if !validAwardSort(*sortAwardsBy) {
+		exitWith(fmt.Sprintf("unknown sort-awards field: %s (expected %s)", *sortAwardsBy, strings.Join(awardSortFields, ", ")))
+	}
+	if *shadowBudget < 0 {
+		exitWith("shadow-budget must be >= 0")
+	}
+	if *ineligibleReasonsTop < 0 {
+		exitWith("ineligible-reasons-top must be >= 0")
+	}
+	if *fullSpendTolerance < 0 || !isFinite(*fullSpendTolerance) {
+		exitWith("full-spend-tolerance must be >= 0")
+	}
+	if *previewCount > 0 && *manifestPath != "" {
+		exitWith("manifest is not supported with -preview")
+	}
+	scenarioList, err := parseBudgetList(*scenarioBudgets)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *minAward < 0 || *maxAward <= 0 || *maxAward < *minAward {
-		exitWith("invalid min/max award values")
-	}
-	if err := validateNeedCaps(*minAward, *maxAward, needAwardCaps{
-		MinHigh:   *minHigh,
-		MaxHigh:   *maxHigh,
-		MinMedium: *minMedium,
-		MaxMedium: *maxMedium,
-		MinLow:    *minLow,
-		MaxLow:    *maxLow,
-	}); err != nil {
+	modeList, err := parseModeList(*compareModes)
+	if err != nil {
 		exitWith(err.Error())
 	}
-	if *scoreWeight < 0 || *needWeight < 0 {
-		exitWith("weights must be non-negative")
+	weightPairs, err := parseWeightPairs(*sweepWeights)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *reserveHigh < 0 || *reserveHigh > 1 {
-		exitWith("reserve-high must be between 0 and 1")
+	programList, err := parseProgramBudgets(*programBudgets)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *reserveMedium < 0 || *reserveMedium > 1 {
-		exitWith("reserve-medium must be between 0 and 1")
+	representRules, err := parseRepresentRules(*minRepresent)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *reserveLow < 0 || *reserveLow > 1 {
-		exitWith("reserve-low must be between 0 and 1")
+	tiebreakList, err := parseTiebreak(*tiebreak)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *reserveHigh+*reserveMedium+*reserveLow > 1 {
-		exitWith("reserve shares must sum to 1 or less")
+	needBins, err := parseNeedBins(*needBinsFlag)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *roundTo < 0 {
-		exitWith("round must be >= 0")
+	needCodes, err := parseNeedCodes(*needCodesFlag)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *maxPercent <= 0 || *maxPercent > 1 {
-		exitWith("max-percent must be between 0 (exclusive) and 1")
+	fixedWidthSpec, err := parseFixedWidthSpec(*fixedWidthSpecFlag)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	if *minScore < 0 {
-		exitWith("min-score must be >= 0")
+	if *fixedWidthPath != "" && len(fixedWidthSpec) == 0 {
+		exitWith("fixed-width requires -fixed-width-spec")
 	}
-	weightTotal := *scoreWeight + *needWeight
-	if weightTotal == 0 {
-		exitWith("score-weight and need-weight cannot both be zero")
+	roundSet, err := parseRoundSet(*roundToSet)
+	if err != nil {
+		exitWith(err.Error())
 	}
-	scenarioList, err := parseBudgetList(*scenarioBudgets)
+	budgetValue, budgetSource, err := resolveBudget(*budget, setFlags["budget"])
 	if err != nil {
 		exitWith(err.Error())
 	}
+	if len(programList) > 0 {
+		var programTotal float64
+		for _, amount := range programList {
+			programTotal += amount
+		}
+		if budgetValue == 0 {
+			budgetValue = programTotal
+			budgetSource = "program budgets"
+		} else if math.Abs(budgetValue-programTotal) > 0.005 {
+			exitWith("budget must equal the sum of program budgets (or be omitted)")
+		}
+	}
+	if levelTotal := *budgetHigh + *budgetMedium + *budgetLow; levelTotal > 0 {
+		if budgetValue == 0 {
+			budgetValue = levelTotal
+			budgetSource = "need-level budgets"
+		} else if math.Abs(budgetValue-levelTotal) > 0.005 {
+			exitWith("budget must equal the sum of need-level budgets (or be omitted)")
+		}
+	}
+	opts := runOptions{
+		Budget:          budgetValue,
+		MinAward:        *minAward,
+		MaxAward:        *maxAward,
+		MinHigh:         *minHigh,
+		MaxHigh:         *maxHigh,
+		MinMedium:       *minMedium,
+		MaxMedium:       *maxMedium,
+		MinLow:          *minLow,
+		MaxLow:          *maxLow,
+		ScoreWeight:     *scoreWeight,
+		NeedWeight:      *needWeight,
+		RequestWeight:   *requestWeight,
+		EfficiencyBias:  *efficiencyBias,
+		RepeatPenalty:   *repeatPenalty,
+		ScoreMaxRef:     *scoreMaxRef,
+		ReserveHigh:     *reserveHigh,
+		ReserveMedium:   *reserveMedium,
+		ReserveLow:      *reserveLow,
+		CapHighAmount:   *capHighAmount,
+		CapMediumAmount: *capMediumAmount,
+		CapLowAmount:    *capLowAmount,
+		ReserveMode:     *reserveMode,
+		PrioritySource:  *prioritySource,
+		RankWeight:      *rankWeight,
+		RoundTo:         *roundTo,
+		RoundSet:        roundSet,
+		AwardIncrement:  *awardIncrement,
+		NeedBins:        needBins,
+		NeedCodes:       needCodes,
+		NormalizeIDs:    *normalizeIDs,
+		IDStrip:         *idStrip,
+		AsOf:            *asOf,
+		MaxPercent:      *maxPercent,
+		MedianMultiple:  *maxAwardMedianMultiple,
+		MaxSpendPct:     *maxSpendPercent,
+		MinScore:        *minScore,
+		MinScoreHigh:    *minScoreHigh,
+		MinScoreMedium:  *minScoreMedium,
+		MinScoreLow:     *minScoreLow,
+		EligibleTopPct:  *eligibleTopPct,
+		AmountScale:     *amountScale,
+		DecimalComma:    *decimalComma,
+		RequestCapPct:   *requestCapPercentile,
+		Sweep:           *sweep,
+		TopupLeftover:   *topupLeftover,
+		StretchPct:      *stretchPct,
+		MaxPartial:      *maxPartial,
+		TierStrict:      *tierStrict,
+		Tiebreak:        tiebreakList,
+		MinMeaningful:   *minMeaningfulAward,
+		TermYears:       *termYears,
+		Rounds:          *rounds,
+		DeclinedIDs:     parseIDList(*declinedIDs),
+		ProgramBudgets:  programList,
+		BudgetHigh:      *budgetHigh,
+		BudgetMedium:    *budgetMedium,
+		BudgetLow:       *budgetLow,
+		MinRepresent:    representRules,
+		ScenarioBudgets: scenarioList,
+	}
+	input := *inputPath
+
+	if *reproducePath != "" {
+		manifest, err := loadManifest(*reproducePath)
+		if err != nil {
+			exitWith(err.Error())
+		}
+		if err := verifyManifestInput(manifest, *ignoreHash); err != nil {
+			exitWith(err.Error())
+		}
+		input = manifest.InputPath
+		opts = manifest.Options
+		budgetSource = "manifest"
+		fmt.Printf("Reproducing run from %s (input %s)\n\n", *reproducePath, input)
+	}
 
-	applicants, warnings, err := loadApplicants(*inputPath)
-	if err != nil {
+	var recomputed []*applicant
+	if *recomputeRunID != "" {
+		if *reproducePath != "" {
+			exitWith("recompute-from-db cannot be combined with -reproduce")
+		}
+		if *manifestPath != "" {
+			exitWith("manifest is not supported with -recompute-from-db")
+		}
+		if *previewCount > 0 {
+			exitWith("preview is not supported with -recompute-from-db")
+		}
+		runID, err := uuid.Parse(strings.TrimSpace(*recomputeRunID))
+		if err != nil {
+			exitWith(fmt.Sprintf("invalid run ID %q: %v", *recomputeRunID, err))
+		}
+		dbConfig, err := loadDBConfig()
+		if err != nil {
+			exitWith(err.Error())
+		}
+		if !dbConfig.Enabled {
+			exitWith("recompute-from-db requires GS_AWARD_ALLOCATOR_DB_URL")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+		stored, storedInput, loaded, err := loadRunFromDatabase(ctx, dbConfig, runID)
+		cancel()
+		if err != nil {
+			exitWith(err.Error())
+		}
+		input = storedInput
+		opts = applyOptionOverrides(stored, opts, setFlags)
+		if !setFlags["budget"] {
+			budgetSource = "database run"
+		}
+		recomputed = loaded
+		fmt.Printf("Recomputing run %s from database (%d applicants)\n\n", runID, len(recomputed))
+	}
+
+	if (input == "" && recomputed == nil) || opts.Budget <= 0 {
+		exitWith("input and budget are required")
+	}
+	if err := validateOptions(opts); err != nil {
 		exitWith(err.Error())
 	}
+	for _, pair := range weightPairs {
+		if pair[0]+pair[1]+opts.RequestWeight == 0 {
+			exitWith(fmt.Sprintf("sweep-weights pair %s/%s needs a non-zero weight", formatFloat(pair[0], 2), formatFloat(pair[1], 2)))
+		}
+	}
+
+	applicants := recomputed
+	var warnings []string
+	var preview *previewInfo
+	if applicants == nil {
+		limit := 0
+		if *previewCount > 0 && !*previewRandom {
+			limit = *previewCount
+		}
+		applicants, warnings, err = loadApplicants(input, opts.AmountScale, opts.DecimalComma, opts.NeedBins, opts.NeedCodes, optionIDNormalization(opts), limit)
+		if err != nil {
+			exitWith(err.Error())
+		}
+		applyTermYears(applicants, opts.TermYears)
+	}
+	if *previewCount > 0 {
+		applicants, preview, err = buildPreview(input, applicants, *previewCount, *previewRandom, *previewSeed, opts)
+		if err != nil {
+			exitWith(err.Error())
+		}
+		preview.FullBudget = opts.Budget
+		scalePreviewBudgets(&opts, preview.BudgetScale)
+		fmt.Printf("PREVIEW: %d of %d applicants (%s), budget scaled from $%.2f to $%.2f\n\n",
+			preview.Sampled, preview.Total, previewMethod(preview), preview.FullBudget, opts.Budget)
+	}
+	if warning := amountScaleWarning(applicants, opts.MaxAward); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if warning := costOfAttendanceWarning(applicants); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		exitWith(fmt.Sprintf("invalid timezone %q: %v", *timezone, err))
+	}
+	groupColumn := strings.ToLower(strings.TrimSpace(*groupBy))
+	if groupColumn != "" && !hasColumn(applicants, groupColumn) {
+		exitWith(fmt.Sprintf("group-by column %q not found in input", groupColumn))
+	}
+	if len(opts.ProgramBudgets) > 0 && !hasColumn(applicants, "program") {
+		exitWith("program-budgets requires a program column in the input")
+	}
+	if prioritySourceOrDefault(opts.PrioritySource) != prioritySourceComputed && !hasColumn(applicants, "rank") {
+		exitWith(fmt.Sprintf("priority-source %s requires a rank column in the input", opts.PrioritySource))
+	}
+	for _, rule := range opts.MinRepresent {
+		if !hasColumn(applicants, rule.Column) {
+			exitWith(fmt.Sprintf("min-represent column %q not found in input", rule.Column))
+		}
+	}
 
-	applyMinScore(applicants, *minScore)
-	normalizeScores(applicants)
-	assignPriority(applicants, *scoreWeight, *needWeight)
-	sortApplicants(applicants)
-	caps := needAwardCaps{
-		MinHigh:   *minHigh,
-		MaxHigh:   *maxHigh,
-		MinMedium: *minMedium,
-		MaxMedium: *maxMedium,
-		MinLow:    *minLow,
-		MaxLow:    *maxLow,
+	if opts.AsOf == "" {
+		opts.AsOf = time.Now().In(location).Format(time.DateOnly)
+	}
+	asOfDate, _ := time.Parse(time.DateOnly, opts.AsOf)
+	if expired := applyEligibilityExpiry(applicants, asOfDate); expired > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d applicant(s) with eligibility expired before %s marked ineligible", expired, opts.AsOf))
+	}
+
+	if *excludeFundedSince != "" {
+		since, err := time.ParseInLocation(time.DateOnly, *excludeFundedSince, location)
+		if err != nil {
+			exitWith(fmt.Sprintf("invalid exclude-funded-since date %q (expected YYYY-MM-DD)", *excludeFundedSince))
+		}
+		dbConfig, err := loadDBConfig()
+		if err != nil {
+			exitWith(err.Error())
+		}
+		if !dbConfig.Enabled {
+			exitWith("exclude-funded-since requires GS_AWARD_ALLOCATOR_DB_URL")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+		funded, err := fetchFundedSince(ctx, dbConfig, since)
+		cancel()
+		if err != nil {
+			exitWith(err.Error())
+		}
+		normalized := make(map[string]bool, len(funded))
+		for id := range funded {
+			normalized[optionIDNormalization(opts).apply(id)] = true
+		}
+		if excluded := excludeFunded(applicants, normalized); excluded > 0 {
+			warnings = append(warnings, fmt.Sprintf("%d applicant(s) already funded in a run since %s marked ineligible", excluded, *excludeFundedSince))
+		}
 	}
 
-	awarded := allocateBudget(applicants, *budget, *minAward, *maxAward, caps, *reserveHigh, *reserveMedium, *reserveLow, *roundTo, *maxPercent)
+	applyTopPercent(applicants, opts.EligibleTopPct)
+	applyMinScore(applicants, opts.MinScore, optionMinScores(opts))
+	applyRequestCap(applicants, opts.RequestCapPct)
+	opts.medianAwardCap = medianAwardCap(applicants, opts.MedianMultiple)
+	warnings = append(warnings, unbudgetedProgramWarnings(applicants, opts.ProgramBudgets)...)
+	normalizeScores(applicants, opts.ScoreMaxRef)
+	assignPriority(applicants, opts)
+	sortApplicants(applicants, opts.Tiebreak)
+
+	effectiveBudget := spendCapBudget(applicants, opts.Budget, opts.MaxSpendPct)
+	var awarded []*applicant
+	var roundResults []roundResult
+	if opts.Rounds > 1 {
+		awarded, roundResults = allocateRounds(applicants, opts.Budget, opts)
+	} else {
+		awarded = allocateBudget(applicants, opts.Budget, opts)
+	}
 	if len(warnings) > 0 {
 		fmt.Println("Warnings:")
 		for _, warning := range warnings {
@@ -248,51 +907,249 @@ func main() {
 		fmt.Println()
 	}
 
-	summary := summarize(applicants, *budget, awarded)
-	if len(scenarioList) > 0 {
-		summary.ScenarioResults = buildScenarioResults(applicants, scenarioList, *minAward, *maxAward, caps, *reserveHigh, *reserveMedium, *reserveLow, *roundTo, *maxPercent)
+	summary := summarize(applicants, opts.Budget, awarded, groupColumn)
+	summary.Rounds = roundResults
+	summary.ByProgram = summarizePrograms(applicants, opts.ProgramBudgets)
+	summary.ByNeedBudget = summarizeNeedBudgets(applicants, effectiveBudget, opts)
+	summary.Representation = summarizeRepresentation(applicants, opts.MinRepresent)
+	summary.GeneratedAt = formatTimestamp(summary.GeneratedTime, *timeFormat, location)
+	applyPriorityPrecision(&summary, *priorityPrecision)
+	summary.AnonymizeNames = *anonymizeNames
+	summary.IneligibleReasonsTop = *ineligibleReasonsTop
+	summary.Preview = preview
+	summary.FlagCapped = *flagCapped
+	summary.NearMisses = buildNearMisses(summary.Ineligible, *nearMissDelta, opts.MinScore, optionMinScores(opts))
+	summary.StrandedBudget = strandedBudget(summary.BudgetLeft, opts.MinMeaningful)
+	summary.MedianAwardCap = opts.medianAwardCap
+	applySpendCap(&summary, effectiveBudget, opts.MaxSpendPct)
+	applyTermSummary(&summary, opts.TermYears)
+	summary.MaxPartial = opts.MaxPartial
+	summary.LevelCaps, summary.LevelCapWarnings = summarizeLevelCaps(applicants, summary.BudgetLeft, opts)
+	sortAwardRecords(summary.Awards, *sortAwardsBy)
+	if *includeIneligible {
+		applyAllApplicantRates(&summary, applicants)
+	}
+	if len(opts.ScenarioBudgets) > 0 {
+		summary.ScenarioResults = buildScenarioResults(applicants, opts.ScenarioBudgets, opts)
+		if *scenarioDetail {
+			summary.ScenarioSteps = buildScenarioSteps(summary.ScenarioResults)
+		}
+	}
+	if len(modeList) > 0 {
+		summary.ModeComparison = buildModeResults(applicants, opts.Budget, modeList, opts)
+	}
+	if len(weightPairs) > 0 {
+		summary.WeightSweep = buildWeightSweep(applicants, opts.Budget, weightPairs, opts)
+	}
+	if *shadowBudget > 0 {
+		summary.ShadowComparison = buildShadowComparison(applicants, awarded, opts.Budget, *shadowBudget, opts)
+	}
+	if *withdrawID != "" {
+		withdrawal, err := buildWithdrawal(applicants, optionIDNormalization(opts).apply(*withdrawID), opts.Budget, opts)
+		if err != nil {
+			exitWith(err.Error())
+		}
+		summary.Withdrawal = withdrawal
+	}
+	if *coverageLadder || *coverageLadderCSV != "" {
+		summary.CoverageLadder = buildCoverageLadder(applicants, opts)
+	}
+	if *verbose {
+		fmt.Printf("Budget source: %s\n", budgetSource)
+		fmt.Println(weightNote(opts))
+		printPriorityBreakdown(applicants, opts, *topN, *showAll)
 	}
 	printSummary(summary)
+	if summary.EligibleCount == 0 {
+		fmt.Fprint(os.Stderr, noEligibleMessage(summary, summary.IneligibleReasonsTop))
+	}
+	printBoundary(summary.Boundary, summary.PriorityPrecision, summary.AnonymizeNames)
+	if message := cutoffTieMessage(summary.Boundary, summary.PriorityPrecision); *errorOnCutoffTie && message != "" {
+		fmt.Fprint(os.Stderr, message)
+		os.Exit(exitCutoffTie)
+	}
+	if message := fullSpendMessage(applicants, summary, opts, *fullSpendTolerance); *requireFullSpend && message != "" {
+		fmt.Fprint(os.Stderr, message)
+		os.Exit(exitUnderSpent)
+	}
+	printNearMisses(summary.NearMisses, summary.AnonymizeNames)
+	printShadowComparison(summary.ShadowComparison)
+	printWithdrawal(summary.Withdrawal, summary.AnonymizeNames)
+	printRoundResults(summary.Rounds)
 	printScenarioResults(summary.ScenarioResults)
-	printAwards(awarded, *topN, *showAll)
-	printUnfunded(summary.Unfunded, *unfundedTop, *showAllUnfunded)
+	printModeComparison(summary.ModeComparison)
+	printWeightSweep(summary.WeightSweep)
+	printCoverageLadder(summary.CoverageLadder)
+	if *explainCutoff {
+		printCutoffExplanation(buildCutoffExplanation(applicants, summary.BudgetLeft, opts, cutoffCandidateCount), summary.PriorityPrecision, summary.AnonymizeNames)
+	}
+	printAwards(summary.Awards, *topN, *showAll, summary.PriorityPrecision, summary.AnonymizeNames)
+	printUnfunded(summary.Unfunded, *unfundedTop, *showAllUnfunded, summary.PriorityPrecision, summary.AnonymizeNames)
+
+	var written []outputFile
+	gate := &outputGate{dryRun: *dryRun}
+	if *appealExport != "" {
+		appeal, err := buildAppeal(applicants, *appealExport, summary, opts)
+		if err != nil {
+			exitWith(err.Error())
+		}
+		if *appealOut == "" {
+			fmt.Println()
+			if err := writeAppealDocument(os.Stdout, appeal, summary.PriorityPrecision, summary.AnonymizeNames); err != nil {
+				exitWith(err.Error())
+			}
+		} else if !gate.skip("appeal record", *appealOut) {
+			if err := writeAppeal(*appealOut, appeal, summary.PriorityPrecision, summary.AnonymizeNames); err != nil {
+				exitWith(err.Error())
+			}
+			fmt.Printf("\nAppeal record for %s written to %s\n", *appealExport, *appealOut)
+			written = append(written, outputFile{Path: *appealOut, Type: "appeal"})
+		}
+	}
+	fileSummary := summary
+	if *sortOutput == "id" {
+		fileSummary = sortOutputByID(summary)
+	}
 
-	if *jsonPath != "" {
-		if err := writeJSON(*jsonPath, summary, awarded); err != nil {
+	if *jsonPath != "" && !gate.skip("JSON", *jsonPath) {
+		if err := writeJSON(*jsonPath, fileSummary, awarded, *jsonCompact); err != nil {
 			exitWith(err.Error())
 		}
 		fmt.Printf("\nJSON written to %s\n", *jsonPath)
+		written = append(written, outputFile{Path: *jsonPath, Type: "json"})
+	}
+
+	if *summaryJSONPath != "" && !gate.skip("summary-only JSON", *summaryJSONPath) {
+		if err := writeSummaryJSON(*summaryJSONPath, summary, *jsonCompact); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nSummary-only JSON written to %s\n", *summaryJSONPath)
+		written = append(written, outputFile{Path: *summaryJSONPath, Type: "summary_json"})
+	}
+
+	if *summaryCSV != "" && !gate.skip("summary CSV", *summaryCSV) {
+		if err := writeSummaryCSV(*summaryCSV, summary); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nSummary CSV written to %s\n", *summaryCSV)
+		written = append(written, outputFile{Path: *summaryCSV, Type: "summary_csv"})
 	}
 
-	if *awardsCSV != "" {
-		if err := writeAwardsCSV(*awardsCSV, awarded); err != nil {
+	if *awardsCSV != "" && !gate.skip("awarded CSV", *awardsCSV) {
+		if err := writeAwardsCSV(*awardsCSV, fileSummary.Awards, summary.PriorityPrecision, summary.FlagCapped, *sourceLines); err != nil {
 			exitWith(err.Error())
 		}
 		fmt.Printf("\nAwarded CSV written to %s\n", *awardsCSV)
+		written = append(written, outputFile{Path: *awardsCSV, Type: "awards_csv"})
+	}
+
+	if *awardsTxt != "" && !gate.skip("awards text", *awardsTxt) {
+		if err := writeAwardsText(*awardsTxt, summary.Awards, *topN, *showAll, summary.PriorityPrecision, summary.AnonymizeNames); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nAwards text written to %s\n", *awardsTxt)
+		written = append(written, outputFile{Path: *awardsTxt, Type: "awards_txt"})
+	}
+
+	if *fixedWidthPath != "" && !gate.skip("fixed-width awards", *fixedWidthPath) {
+		if err := writeFixedWidth(*fixedWidthPath, awarded, fixedWidthSpec); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nFixed-width awards written to %s\n", *fixedWidthPath)
+		written = append(written, outputFile{Path: *fixedWidthPath, Type: "fixed_width"})
 	}
 
-	if *unfundedCSV != "" {
-		if err := writeUnfundedCSV(*unfundedCSV, summary.Unfunded); err != nil {
+	if *unfundedCSV != "" && !gate.skip("unfunded CSV", *unfundedCSV) {
+		if err := writeUnfundedCSV(*unfundedCSV, fileSummary.Unfunded, summary.PriorityPrecision, *sourceLines); err != nil {
 			exitWith(err.Error())
 		}
 		fmt.Printf("\nUnfunded CSV written to %s\n", *unfundedCSV)
+		written = append(written, outputFile{Path: *unfundedCSV, Type: "unfunded_csv"})
 	}
 
-	if *ineligibleCSV != "" {
-		if err := writeIneligibleCSV(*ineligibleCSV, summary.Ineligible); err != nil {
+	if *ineligibleCSV != "" && !gate.skip("ineligible CSV", *ineligibleCSV) {
+		if err := writeIneligibleCSV(*ineligibleCSV, fileSummary.Ineligible, *sourceLines); err != nil {
 			exitWith(err.Error())
 		}
 		fmt.Printf("\nIneligible CSV written to %s\n", *ineligibleCSV)
+		written = append(written, outputFile{Path: *ineligibleCSV, Type: "ineligible_csv"})
+	}
+
+	if *priorityBreakdownCSV != "" && !gate.skip("priority breakdown CSV", *priorityBreakdownCSV) {
+		if err := writePriorityBreakdownCSV(*priorityBreakdownCSV, applicants, opts.RequestWeight > 0, summary.PriorityPrecision); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nPriority breakdown CSV written to %s\n", *priorityBreakdownCSV)
+		written = append(written, outputFile{Path: *priorityBreakdownCSV, Type: "priority_breakdown_csv"})
+	}
+
+	if *xlsxPath != "" && !gate.skip("Excel workbook", *xlsxPath) {
+		if err := writeXLSX(*xlsxPath, workbookSheets(fileSummary)); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nExcel workbook written to %s\n", *xlsxPath)
+		written = append(written, outputFile{Path: *xlsxPath, Type: "xlsx"})
+	}
+
+	if *coverageLadderCSV != "" && !gate.skip("coverage ladder CSV", *coverageLadderCSV) {
+		if err := writeCoverageLadderCSV(*coverageLadderCSV, summary.CoverageLadder); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nCoverage ladder CSV written to %s\n", *coverageLadderCSV)
+		written = append(written, outputFile{Path: *coverageLadderCSV, Type: "coverage_ladder_csv"})
+	}
+
+	if *lettersDir != "" && !gate.skip("award letters", *lettersDir) {
+		letters, err := writeLetters(*lettersDir, *letterTemplate, summary)
+		if err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\n%d award letters written to %s\n", len(letters), *lettersDir)
+		for _, path := range letters {
+			written = append(written, outputFile{Path: path, Type: "letter"})
+		}
+	}
+
+	if *promFile != "" && !gate.skip("Prometheus metrics", *promFile) {
+		if err := writePromFile(*promFile, summary); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nPrometheus metrics written to %s\n", *promFile)
+		written = append(written, outputFile{Path: *promFile, Type: "prometheus"})
 	}
 
-	if *reportPath != "" {
+	if *reportPath != "" && !gate.skip("Markdown report", *reportPath) {
 		if err := writeReport(*reportPath, summary, *topN, *showAll, *unfundedTop, *showAllUnfunded); err != nil {
 			exitWith(err.Error())
 		}
 		fmt.Printf("\nMarkdown report written to %s\n", *reportPath)
+		written = append(written, outputFile{Path: *reportPath, Type: "report"})
+	}
+
+	if *manifestPath != "" && !gate.skip("run manifest", *manifestPath) {
+		manifest, err := buildManifest(summary.GeneratedAt, input, opts)
+		if err != nil {
+			exitWith(err.Error())
+		}
+		if err := writeManifest(*manifestPath, manifest); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nRun manifest written to %s\n", *manifestPath)
+		written = append(written, outputFile{Path: *manifestPath, Type: "run_manifest"})
+	}
+
+	if *outputsManifestPath != "" && !gate.skip("outputs manifest", *outputsManifestPath) {
+		if err := writeOutputsManifest(*outputsManifestPath, summary.GeneratedAt, written); err != nil {
+			exitWith(err.Error())
+		}
+		fmt.Printf("\nOutputs manifest written to %s\n", *outputsManifestPath)
 	}
 
-	if *dbLog {
+	if *dbLog && preview != nil {
+		fmt.Fprintln(os.Stderr, "DB logging skipped for preview runs")
+	} else if *dbLog && *dryRun {
+		fmt.Println("[dry-run] would log the allocation run to the database")
+	} else if *dbLog {
 		dbConfig, err := loadDBConfig()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "DB logging disabled: %v\n", err)
@@ -301,55 +1158,342 @@ func main() {
 		} else {
 			ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
 			defer cancel()
-			opts := dbRunOptions{
-				MinAward:      *minAward,
-				MaxAward:      *maxAward,
-				MinHigh:       *minHigh,
-				MaxHigh:       *maxHigh,
-				MinMedium:     *minMedium,
-				MaxMedium:     *maxMedium,
-				MinLow:        *minLow,
-				MaxLow:        *maxLow,
-				ScoreWeight:   *scoreWeight,
-				NeedWeight:    *needWeight,
-				ReserveHigh:   *reserveHigh,
-				ReserveMedium: *reserveMedium,
-				ReserveLow:    *reserveLow,
-				RoundTo:       *roundTo,
-				MaxPercent:    *maxPercent,
-				MinScore:      *minScore,
-			}
-			if err := logRunToDatabase(ctx, dbConfig, summary, applicants, *inputPath, opts); err != nil {
+			if err := logRunToDatabase(ctx, dbConfig, summary, applicants, input, opts); err != nil {
 				fmt.Fprintf(os.Stderr, "DB logging failed: %v\n", err)
 			} else {
 				fmt.Println("\nLogged allocation run to database.")
 			}
 		}
 	}
+
+	if summary.EligibleCount == 0 {
+		os.Exit(exitNoEligible)
+	}
 }
 
-func exitWith(message string) {
-	fmt.Fprintf(os.Stderr, "Error: %s\n", message)
-	os.Exit(1)
+// outputGate lets -dry-run skip file outputs, announcing each skipped
+// output instead of writing it.
+type outputGate struct {
+	dryRun bool
 }
 
-func loadApplicants(path string) ([]*applicant, []string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, nil, fmt.Errorf("unable to open CSV: %w", err)
+// skip reports whether the output should be skipped, announcing it if so.
+func (g *outputGate) skip(label, path string) bool {
+	if !g.dryRun {
+		return false
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.TrimLeadingSpace = true
+	fmt.Printf("[dry-run] would write %s to %s\n", label, path)
+	return true
+}
 
-	header, err := reader.Read()
-	if err != nil {
-		return nil, nil, fmt.Errorf("unable to read header: %w", err)
+// exitNoEligible is the exit status when a run completes but no applicant is
+// eligible, so scripts can tell it apart from errors (1) and normal runs (0).
+const exitNoEligible = 2
+
+// exitCutoffTie is the exit status for -error-on-cutoff-tie when the
+// last-funded and first-unfunded applicants share a priority.
+const exitCutoffTie = 3
+
+// cutoffTieMessage explains a boundary group that straddles the cutoff, or
+// returns "" when every tied applicant was funded.
+func cutoffTieMessage(boundary []boundaryRecord, precision int) string {
+	unfunded := 0
+	for _, item := range boundary {
+		if !item.Funded {
+			unfunded++
+		}
 	}
-	index := mapHeaders(header)
+	if unfunded == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nCutoff tie: %d of %d applicants tied at priority %s were left unfunded by tie-breaking; no outputs were written.\n",
+		unfunded, len(boundary), formatFloat(boundary[0].Priority, precision))
+}
 
-	required := []string{"applicant_id", "score", "need_level", "requested_amount"}
+// exitUnderSpent is the exit status for -require-full-spend when the budget
+// was not fully disbursed.
+const exitUnderSpent = 4
+
+// fullSpendMessage explains budget left unspent beyond tolerance, or returns
+// "" when the run disbursed it. Money held back by -max-spend-percent is
+// deliberate and does not count as unspent.
+func fullSpendMessage(applicants []*applicant, summary allocationSummary, opts runOptions, tolerance float64) string {
+	unspent := summary.BudgetLeft
+	if summary.EffectiveBudget > 0 {
+		unspent -= summary.Budget - summary.EffectiveBudget
+	}
+	if unspent <= tolerance {
+		return ""
+	}
+	unfunded := 0
+	held := make(map[string]int)
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		if item.Awarded <= 0 {
+			unfunded++
+			continue
+		}
+		if unmetNeed(item)-item.Awarded > invariantTolerance {
+			held[item.Constraint]++
+		}
+	}
+	var reasons []string
+	if unfunded == 0 && len(held) == 0 {
+		reasons = append(reasons, "every eligible applicant is fully funded")
+	}
+	for _, constraint := range constraintOrder {
+		if held[constraint] > 0 {
+			reasons = append(reasons, fmt.Sprintf("%d awards held below need by %s", held[constraint], constraint))
+		}
+	}
+	if unfunded > 0 {
+		reason := fmt.Sprintf("%d eligible applicants unfunded", unfunded)
+		if unspent < opts.MinAward {
+			reason += fmt.Sprintf(" because the leftover is below the minimum award (%s)", formatCurrency(opts.MinAward))
+		}
+		reasons = append(reasons, reason)
+	}
+	return fmt.Sprintf("\nUnder-spent budget: %s left unspent (tolerance %s): %s; no outputs were written.\n",
+		formatCurrency(unspent), formatCurrency(tolerance), strings.Join(reasons, "; "))
+}
+
+func validateOptions(opts runOptions) error {
+	if opts.MinAward < 0 || opts.MaxAward <= 0 || opts.MaxAward < opts.MinAward {
+		return errors.New("invalid min/max award values")
+	}
+	if err := validateNeedCaps(opts.MinAward, opts.MaxAward, optionCaps(opts)); err != nil {
+		return err
+	}
+	if !isFinite(opts.ScoreWeight) || !isFinite(opts.NeedWeight) || !isFinite(opts.RequestWeight) {
+		return errors.New("weights must be finite numbers")
+	}
+	if opts.ScoreWeight < 0 || opts.NeedWeight < 0 || opts.RequestWeight < 0 {
+		return errors.New("weights must be non-negative")
+	}
+	if opts.ScoreMaxRef < 0 {
+		return errors.New("score-max-ref must be >= 0")
+	}
+	if opts.EfficiencyBias < 0 || opts.EfficiencyBias > 1 {
+		return errors.New("efficiency-bias must be between 0 and 1")
+	}
+	if opts.RepeatPenalty < 0 {
+		return errors.New("repeat-penalty must be >= 0")
+	}
+	if opts.ReserveHigh < 0 || opts.ReserveHigh > 1 {
+		return errors.New("reserve-high must be between 0 and 1")
+	}
+	if opts.ReserveMedium < 0 || opts.ReserveMedium > 1 {
+		return errors.New("reserve-medium must be between 0 and 1")
+	}
+	if opts.ReserveLow < 0 || opts.ReserveLow > 1 {
+		return errors.New("reserve-low must be between 0 and 1")
+	}
+	if opts.ReserveHigh+opts.ReserveMedium+opts.ReserveLow > 1 {
+		return errors.New("reserve shares must sum to 1 or less")
+	}
+	if opts.CapHighAmount < 0 || opts.CapMediumAmount < 0 || opts.CapLowAmount < 0 {
+		return errors.New("need-level amount caps must be >= 0")
+	}
+	if mode := reserveModeOrDefault(opts.ReserveMode); mode != reserveModePriority && mode != reserveModeSpread {
+		return fmt.Errorf("unknown reserve-mode: %s (expected %s or %s)", opts.ReserveMode, reserveModePriority, reserveModeSpread)
+	}
+	switch prioritySourceOrDefault(opts.PrioritySource) {
+	case prioritySourceComputed, prioritySourceExternal, prioritySourceBlend:
+	default:
+		return fmt.Errorf("unknown priority-source: %s (expected %s, %s, or %s)", opts.PrioritySource, prioritySourceComputed, prioritySourceExternal, prioritySourceBlend)
+	}
+	if opts.RankWeight < 0 || opts.RankWeight > 1 {
+		return errors.New("rank-weight must be between 0 and 1")
+	}
+	if opts.RoundTo < 0 {
+		return errors.New("round must be >= 0")
+	}
+	if opts.MinMeaningful < 0 {
+		return errors.New("min-meaningful-award must be >= 0")
+	}
+	if opts.AwardIncrement < 0 {
+		return errors.New("award-increment must be >= 0")
+	}
+	if opts.AwardIncrement > 0 && (opts.RoundTo > 0 || len(opts.RoundSet) > 0) {
+		return errors.New("award-increment cannot be combined with round or round-to-set")
+	}
+	if opts.RoundTo > 0 && len(opts.RoundSet) > 0 {
+		return errors.New("round and round-to-set cannot be combined")
+	}
+	if opts.Sweep && opts.TopupLeftover {
+		return errors.New("sweep and topup-leftover cannot be combined")
+	}
+	if opts.StretchPct < 0 || opts.StretchPct >= 1 {
+		return errors.New("stretch-percent must be >= 0 and < 1")
+	}
+	if opts.MaxPartial < 0 {
+		return errors.New("max-partial must be >= 0")
+	}
+	if opts.EligibleTopPct < 0 || opts.EligibleTopPct > 1 {
+		return errors.New("eligible-top-percent must be between 0 and 1")
+	}
+	if opts.IDStrip != "" && !opts.NormalizeIDs {
+		return errors.New("id-strip requires -normalize-ids")
+	}
+	for _, r := range opts.IDStrip {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return fmt.Errorf("id-strip may only list non-alphanumeric characters, got %q", r)
+		}
+	}
+	if opts.BudgetHigh < 0 || opts.BudgetMedium < 0 || opts.BudgetLow < 0 {
+		return errors.New("need-level budgets must be >= 0")
+	}
+	if hasNeedBudgets(opts) && len(opts.ProgramBudgets) > 0 {
+		return errors.New("need-level budgets and program-budgets cannot be combined")
+	}
+	if opts.MedianMultiple < 0 {
+		return errors.New("max-award-median-multiple must be >= 0")
+	}
+	if opts.MaxSpendPct < 0 || opts.MaxSpendPct > 1 {
+		return errors.New("max-spend-percent must be between 0 and 1")
+	}
+	if opts.AsOf != "" {
+		if _, err := time.Parse(time.DateOnly, opts.AsOf); err != nil {
+			return fmt.Errorf("invalid as-of date %q (expected YYYY-MM-DD)", opts.AsOf)
+		}
+	}
+	if opts.MaxPercent <= 0 || opts.MaxPercent > 1 {
+		return errors.New("max-percent must be between 0 (exclusive) and 1")
+	}
+	if opts.MinScore < 0 {
+		return errors.New("min-score must be >= 0")
+	}
+	if opts.AmountScale <= 0 {
+		return errors.New("amount-scale must be > 0")
+	}
+	if opts.RequestCapPct < 0 || opts.RequestCapPct > 1 {
+		return errors.New("request-cap-percentile must be between 0 and 1")
+	}
+	if opts.Rounds < 1 {
+		return errors.New("rounds must be >= 1")
+	}
+	if len(opts.DeclinedIDs) > 0 && opts.Rounds < 2 {
+		return errors.New("declined-ids requires -rounds of at least 2")
+	}
+	if opts.TermYears < 0 {
+		return errors.New("term-years must be >= 0")
+	}
+	if opts.ScoreWeight+opts.NeedWeight+opts.RequestWeight == 0 {
+		return errors.New("score-weight, need-weight, and request-weight cannot all be zero")
+	}
+	return nil
+}
+
+// idNormalization is the -normalize-ids rule for applicant IDs: trim,
+// upper-case, and remove the -id-strip characters.
+type idNormalization struct {
+	enabled bool
+	strip   string
+}
+
+func optionIDNormalization(opts runOptions) idNormalization {
+	return idNormalization{enabled: opts.NormalizeIDs, strip: opts.IDStrip}
+}
+
+func (n idNormalization) apply(id string) string {
+	if !n.enabled {
+		return id
+	}
+	id = strings.ToUpper(strings.TrimSpace(id))
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(n.strip, r) {
+			return -1
+		}
+		return r
+	}, id)
+}
+
+func optionMinScores(opts runOptions) needMinScores {
+	return needMinScores{
+		High:   opts.MinScoreHigh,
+		Medium: opts.MinScoreMedium,
+		Low:    opts.MinScoreLow,
+	}
+}
+
+func optionCaps(opts runOptions) needAwardCaps {
+	return needAwardCaps{
+		MinHigh:   opts.MinHigh,
+		MaxHigh:   opts.MaxHigh,
+		MinMedium: opts.MinMedium,
+		MaxMedium: opts.MaxMedium,
+		MinLow:    opts.MinLow,
+		MaxLow:    opts.MaxLow,
+	}
+}
+
+// noEligibleMessage explains a run where every applicant was ineligible,
+// listing the most common reasons up to -ineligible-reasons-top.
+func noEligibleMessage(summary allocationSummary, top int) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "\nNo eligible applicants: all %d applicants were ineligible, so no awards were made.\n", summary.Applicants)
+	reasons, hidden := limitReasonSummary(sortReasonSummary(summary.IneligibleReasonSummary), top)
+	if len(reasons) > 0 {
+		builder.WriteString("Top ineligibility reasons:\n")
+	}
+	for _, reason := range reasons {
+		fmt.Fprintf(&builder, "  - %s: %d\n", reason.Reason, reason.Count)
+	}
+	if hidden > 0 {
+		fmt.Fprintf(&builder, "  ... %d more\n", hidden)
+	}
+	builder.WriteString("Check -min-score, need_level values, and requested_amount in the input.\n")
+	return builder.String()
+}
+
+func exitWith(message string) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", message)
+	os.Exit(1)
+}
+
+// loadApplicants reads applicants from a CSV file. A positive limit stops
+// reading once that many valid applicants have been collected.
+func loadApplicants(path string, amountScale float64, decimalComma bool, needBins []float64, needCodes map[string]string, ids idNormalization, limit int) ([]*applicant, []string, error) {
+	var reader rowReader
+	if isXLSXPath(path) {
+		rows, lines, err := readXLSXRows(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader = &sliceRows{rows: rows, lines: lines}
+		// Workbook numbers are stored locale-free, so -decimal-comma only
+		// applies to CSV input.
+		decimalComma = false
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to open CSV: %w", err)
+		}
+		defer file.Close()
+
+		csvReader := csv.NewReader(file)
+		csvReader.TrimLeadingSpace = true
+		reader = csvReader
+	}
+	return readApplicants(reader, amountScale, decimalComma, needBins, needCodes, ids, limit)
+}
+
+// readApplicants parses the header and data rows from reader. Malformed CSV
+// rows are skipped with a warning; any other read error stops the load.
+func readApplicants(reader rowReader, amountScale float64, decimalComma bool, needBins []float64, needCodes map[string]string, ids idNormalization, limit int) ([]*applicant, []string, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read header: %w", err)
+	}
+	index := mapHeaders(header)
+	line, _ := reader.FieldPos(0)
+
+	required := []string{"applicant_id", "score", "need_level", "requested_amount"}
+	if len(needBins) > 0 {
+		required[2] = "need_index"
+	}
 	missing := missingHeaders(required, index)
 	if len(missing) > 0 {
 		return nil, nil, fmt.Errorf("missing required headers: %s", strings.Join(missing, ", "))
@@ -357,36 +1501,345 @@ func loadApplicants(path string) ([]*applicant, []string, error) {
 
 	var applicants []*applicant
 	var warnings []string
-	line := 1
+	var needSpellings []string
 	for {
-		line++
 		record, err := reader.Read()
 		if errors.Is(err, io.EOF) {
 			break
 		}
-		if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			line = parseErr.StartLine
 			warnings = append(warnings, fmt.Sprintf("line %d: %v", line, err))
 			continue
 		}
-		item, warn := parseApplicant(record, index, line)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("unable to read the row after line %d: %w", line, err)
+		}
+		// Report the file line the record starts on: the CSV reader skips
+		// blank lines and quoted fields can span several lines.
+		line, _ = reader.FieldPos(0)
+		item, warn := parseApplicant(record, index, line, amountScale, decimalComma, needBins, needCodes, ids)
 		if warn != "" {
 			warnings = append(warnings, warn)
 		}
 		if item != nil {
 			applicants = append(applicants, item)
+			if pos, ok := index["need_level"]; ok && pos < len(record) {
+				needSpellings = append(needSpellings, strings.TrimSpace(record[pos]))
+			}
+			if limit > 0 && len(applicants) >= limit {
+				break
+			}
 		}
 	}
 
 	if len(applicants) == 0 {
 		return nil, warnings, fmt.Errorf("no valid applicants found")
 	}
+	warnings = append(warnings, mixedNeedSpellingWarnings(needSpellings)...)
 
 	return applicants, warnings, nil
 }
 
+// rowReader is the record source loadApplicants reads from: a csv.Reader for
+// CSV input or the rows of a workbook's first sheet. FieldPos reports the
+// source line of the record most recently read.
+type rowReader interface {
+	Read() ([]string, error)
+	FieldPos(field int) (line, column int)
+}
+
+// sliceRows reads pre-parsed rows. lines holds each row's source line when
+// rows were skipped; without it rows are numbered from 1.
+type sliceRows struct {
+	rows  [][]string
+	lines []int
+	next  int
+}
+
+func (r *sliceRows) Read() ([]string, error) {
+	if r.next >= len(r.rows) {
+		return nil, io.EOF
+	}
+	r.next++
+	return r.rows[r.next-1], nil
+}
+
+func (r *sliceRows) FieldPos(field int) (int, int) {
+	if r.next > 0 && r.next <= len(r.lines) {
+		return r.lines[r.next-1], field + 1
+	}
+	return r.next, field + 1
+}
+
+func isXLSXPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xlsx")
+}
+
+type xlsxWorkbookXML struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelsXML struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxTextXML struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxTextXML) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var out strings.Builder
+	for _, run := range t.Runs {
+		out.WriteString(run.Text)
+	}
+	return out.String()
+}
+
+type xlsxSheetXML struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Ref    string      `xml:"r,attr"`
+			Type   string      `xml:"t,attr"`
+			Value  string      `xml:"v"`
+			Inline xlsxTextXML `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXRows returns the cell text of the first sheet in a workbook, one
+// slice per non-blank row, along with each row's sheet row number. Numeric
+// cells come back as their stored value, so amounts keep full precision and
+// text IDs keep their leading zeros. Cells are placed by their reference,
+// leaving gaps as empty strings. Workbooks store no element for empty rows,
+// so row numbers come from each row's r attribute rather than a count.
+func readXLSXRows(path string) ([][]string, []int, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open workbook: %w", err)
+	}
+	defer archive.Close()
+
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		parts[file.Name] = file
+	}
+	decode := func(name string, target any) (bool, error) {
+		part, ok := parts[name]
+		if !ok {
+			return false, nil
+		}
+		reader, err := part.Open()
+		if err != nil {
+			return true, fmt.Errorf("unable to read workbook part %s: %w", name, err)
+		}
+		defer reader.Close()
+		if err := xml.NewDecoder(reader).Decode(target); err != nil {
+			return true, fmt.Errorf("unable to parse workbook part %s: %w", name, err)
+		}
+		return true, nil
+	}
+
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var workbook xlsxWorkbookXML
+	var rels xlsxRelsXML
+	if _, err := decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, nil, err
+	}
+	if _, err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, nil, err
+	}
+	if len(workbook.Sheets) > 0 {
+		for _, rel := range rels.Relationships {
+			if rel.ID == workbook.Sheets[0].ID {
+				sheetPath = "xl/" + strings.TrimPrefix(rel.Target, "/xl/")
+			}
+		}
+	}
+
+	var shared struct {
+		Items []xlsxTextXML `xml:"si"`
+	}
+	if _, err := decode("xl/sharedStrings.xml", &shared); err != nil {
+		return nil, nil, err
+	}
+	var sheet xlsxSheetXML
+	found, err := decode(sheetPath, &sheet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("workbook has no sheet at %s", sheetPath)
+	}
+
+	var rows [][]string
+	var lines []int
+	line := 0
+	for _, row := range sheet.Rows {
+		line++
+		if row.Number > 0 {
+			line = row.Number
+		}
+		var record []string
+		blank := true
+		for _, cell := range row.Cells {
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, nil, fmt.Errorf("cell %s: invalid shared string %q", cell.Ref, value)
+				}
+				value = shared.Items[index].String()
+			case "inlineStr":
+				value = cell.Inline.String()
+			}
+			column := xlsxColumnIndex(cell.Ref)
+			if column < 0 {
+				column = len(record)
+			}
+			for len(record) <= column {
+				record = append(record, "")
+			}
+			record[column] = value
+			if strings.TrimSpace(value) != "" {
+				blank = false
+			}
+		}
+		if !blank {
+			rows = append(rows, record)
+			lines = append(lines, line)
+		}
+	}
+	return rows, lines, nil
+}
+
+// xlsxColumnIndex converts a cell reference such as C7 to a zero-based
+// column index, the inverse of xlsxColumn. It returns -1 without letters.
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	letters := 0
+	for _, char := range strings.ToUpper(ref) {
+		if char < 'A' || char > 'Z' {
+			break
+		}
+		index = index*26 + int(char-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return -1
+	}
+	return index - 1
+}
+
+// mixedNeedSpellingWarnings flags need levels written with more than one
+// casing (High, HIGH, high). Parsing already normalizes them, but mixed
+// spellings usually point to a messy export worth cleaning at the source.
+func mixedNeedSpellingWarnings(raw []string) []string {
+	spellings := make(map[string][]string)
+	var levels []string
+	for _, value := range raw {
+		level := strings.ToLower(value)
+		seen := spellings[level]
+		if len(seen) == 0 {
+			levels = append(levels, level)
+		}
+		known := false
+		for _, spelling := range seen {
+			if spelling == value {
+				known = true
+				break
+			}
+		}
+		if !known {
+			spellings[level] = append(seen, value)
+		}
+	}
+	var warnings []string
+	for _, level := range levels {
+		if len(spellings[level]) > 1 {
+			warnings = append(warnings, fmt.Sprintf("need_level has mixed spellings: %s", strings.Join(spellings[level], ", ")))
+		}
+	}
+	return warnings
+}
+
+// buildPreview reduces applicants to a preview sample and reports the share of
+// the full file it represents. Sequential previews were already cut short by
+// loadApplicants, so the full size comes from loading the whole file again;
+// both modes count the same valid applicants.
+func buildPreview(path string, applicants []*applicant, count int, random bool, seed int64, opts runOptions) ([]*applicant, *previewInfo, error) {
+	preview := &previewInfo{Random: random}
+	if random {
+		preview.Seed = seed
+		preview.Total = len(applicants)
+		applicants = sampleApplicants(applicants, count, seed)
+	} else {
+		all, _, err := loadApplicants(path, opts.AmountScale, opts.DecimalComma, opts.NeedBins, opts.NeedCodes, optionIDNormalization(opts), 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		preview.Total = len(all)
+	}
+	preview.Sampled = len(applicants)
+	if preview.Total < preview.Sampled {
+		preview.Total = preview.Sampled
+	}
+	preview.BudgetScale = 1
+	if preview.Total > 0 {
+		preview.BudgetScale = float64(preview.Sampled) / float64(preview.Total)
+	}
+	return applicants, preview, nil
+}
+
+// sampleApplicants picks count applicants with a seeded shuffle, keeping the
+// file order of the chosen rows.
+func sampleApplicants(applicants []*applicant, count int, seed int64) []*applicant {
+	if count >= len(applicants) {
+		return applicants
+	}
+	picked := rand.New(rand.NewSource(seed)).Perm(len(applicants))[:count]
+	sort.Ints(picked)
+	sample := make([]*applicant, 0, count)
+	for _, index := range picked {
+		sample = append(sample, applicants[index])
+	}
+	return sample
+}
+
+func scalePreviewBudgets(opts *runOptions, scale float64) {
+	opts.Budget *= scale
+	for i := range opts.ScenarioBudgets {
+		opts.ScenarioBudgets[i] *= scale
+	}
+}
+
+func previewMethod(preview *previewInfo) string {
+	if preview.Random {
+		return fmt.Sprintf("random sample, seed %d", preview.Seed)
+	}
+	return "first rows"
+}
+
 func mapHeaders(header []string) map[string]int {
 	index := make(map[string]int, len(header))
 	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
 		key := strings.ToLower(strings.TrimSpace(name))
 		index[key] = i
 	}
@@ -403,7 +1856,15 @@ func missingHeaders(required []string, index map[string]int) []string {
 	return missing
 }
 
-func parseApplicant(record []string, index map[string]int, line int) (*applicant, string) {
+var coreColumns = map[string]bool{
+	"applicant_id":     true,
+	"name":             true,
+	"score":            true,
+	"need_level":       true,
+	"requested_amount": true,
+}
+
+func parseApplicant(record []string, index map[string]int, line int, amountScale float64, decimalComma bool, needBins []float64, needCodes map[string]string, ids idNormalization) (*applicant, string) {
 	get := func(key string) string {
 		pos := index[key]
 		if pos >= len(record) {
@@ -412,7 +1873,8 @@ func parseApplicant(record []string, index map[string]int, line int) (*applicant
 		return strings.TrimSpace(record[pos])
 	}
 
-	id := get("applicant_id")
+	rawID := get("applicant_id")
+	id := ids.apply(rawID)
 	if id == "" {
 		return nil, fmt.Sprintf("line %d: missing applicant_id", line)
 	}
@@ -422,75 +1884,655 @@ func parseApplicant(record []string, index map[string]int, line int) (*applicant
 	}
 
 	score, err := strconv.ParseFloat(get("score"), 64)
-	if err != nil {
+	if err != nil && !overflowed(score, err) {
 		return nil, fmt.Sprintf("line %d: invalid score", line)
 	}
 
-	need := strings.ToLower(get("need_level"))
-	requested, err := strconv.ParseFloat(get("requested_amount"), 64)
-	if err != nil {
+	need := ""
+	if _, ok := index["need_level"]; ok {
+		need = strings.ToLower(get("need_level"))
+		if level, ok := needCodes[need]; ok {
+			need = level
+		}
+	}
+	requested, err := parseAmount(get("requested_amount"), decimalComma)
+	if err != nil && !overflowed(requested, err) {
 		return nil, fmt.Sprintf("line %d: invalid requested_amount", line)
 	}
+	requested *= amountScale
 
-	applicant := &applicant{
-		ID:        id,
-		Name:      name,
-		NeedLevel: need,
-		ScoreRaw:  score,
-		Requested: requested,
-		Eligible:  true,
+	var otherAid float64
+	if _, ok := index["other_aid"]; ok && get("other_aid") != "" {
+		otherAid, err = parseAmount(get("other_aid"), decimalComma)
+		if err != nil || otherAid < 0 || !isFinite(otherAid) {
+			return nil, fmt.Sprintf("line %d: invalid other_aid", line)
+		}
+		otherAid *= amountScale
 	}
 
-	if requested <= 0 {
-		markIneligible(applicant, "requested_amount must be > 0")
-	}
-	if need != "low" && need != "medium" && need != "high" {
-		markIneligible(applicant, "need_level must be low, medium, or high")
+	var eligibleUntil time.Time
+	var warn string
+	if _, ok := index["eligible_until"]; ok && get("eligible_until") != "" {
+		eligibleUntil, err = time.Parse(time.DateOnly, get("eligible_until"))
+		if err != nil {
+			warn = fmt.Sprintf("line %d: invalid eligible_until %q (expected YYYY-MM-DD); applicant kept eligible", line, get("eligible_until"))
+		}
 	}
 
-	return applicant, ""
-}
-
-func markIneligible(applicant *applicant, message string) {
-	applicant.Eligible = false
-	if applicant.EligibilityMsg == "" {
-		applicant.EligibilityMsg = message
-		return
+	var costOfAttendance float64
+	if _, ok := index["cost_of_attendance"]; ok && get("cost_of_attendance") != "" {
+		costOfAttendance, err = parseAmount(get("cost_of_attendance"), decimalComma)
+		if err != nil || costOfAttendance < 0 || !isFinite(costOfAttendance) {
+			return nil, fmt.Sprintf("line %d: invalid cost_of_attendance", line)
+		}
+		costOfAttendance *= amountScale
 	}
-	applicant.EligibilityMsg = fmt.Sprintf("%s; %s", applicant.EligibilityMsg, message)
-}
 
-func applyMinScore(applicants []*applicant, minScore float64) {
-	if minScore <= 0 {
-		return
+	fte := 1.0
+	if _, ok := index["fte"]; ok && get("fte") != "" {
+		fte, err = strconv.ParseFloat(get("fte"), 64)
+		if err != nil {
+			fte = math.NaN()
+		}
 	}
-	for _, item := range applicants {
-		if item.ScoreRaw < minScore {
-			markIneligible(item, fmt.Sprintf("score below minimum (%.1f)", minScore))
+
+	match := 1.0
+	if _, ok := index["match_multiplier"]; ok && get("match_multiplier") != "" {
+		match, err = strconv.ParseFloat(get("match_multiplier"), 64)
+		if err != nil || match < 0 || !isFinite(match) {
+			return nil, fmt.Sprintf("line %d: invalid match_multiplier", line)
 		}
 	}
-}
 
-func normalizeScores(applicants []*applicant) {
-	var maxScore float64
-	for _, item := range applicants {
-		if item.ScoreRaw > maxScore {
-			maxScore = item.ScoreRaw
+	extras := make(map[string]string)
+	for key := range index {
+		if coreColumns[key] {
+			continue
 		}
+		extras[key] = get(key)
 	}
-	if maxScore == 0 {
-		maxScore = 1
+
+	var needWeight float64
+	hasNeedWeight := false
+	if _, ok := index["need_weight"]; ok && get("need_weight") != "" {
+		needWeight, err = strconv.ParseFloat(get("need_weight"), 64)
+		if err != nil {
+			return nil, fmt.Sprintf("line %d: invalid need_weight", line)
+		}
+		if needWeight < 0 || needWeight > 1 || math.IsNaN(needWeight) {
+			return nil, fmt.Sprintf("line %d: need_weight must be between 0 and 1", line)
+		}
+		hasNeedWeight = true
 	}
-	for _, item := range applicants {
-		item.ScoreNorm = item.ScoreRaw / maxScore
+
+	var priorAwards int
+	if _, ok := index["prior_awards"]; ok && get("prior_awards") != "" {
+		priorAwards, err = strconv.Atoi(get("prior_awards"))
+		if err != nil || priorAwards < 0 {
+			return nil, fmt.Sprintf("line %d: invalid prior_awards", line)
+		}
 	}
-}
 
-func assignPriority(applicants []*applicant, scoreWeight, needWeight float64) {
+	var rank int
+	if _, ok := index["rank"]; ok && get("rank") != "" {
+		rank, err = strconv.Atoi(get("rank"))
+		if err != nil || rank < 1 {
+			return nil, fmt.Sprintf("line %d: rank must be a whole number >= 1", line)
+		}
+	}
+
+	if _, ok := index["need_index"]; ok && len(needBins) > 0 && get("need_index") != "" {
+		needIndex, err := strconv.ParseFloat(get("need_index"), 64)
+		if err != nil || needIndex < 0 || needIndex > 1 || math.IsNaN(needIndex) {
+			return nil, fmt.Sprintf("line %d: need_index must be between 0 and 1", line)
+		}
+		need = binNeedIndex(needIndex, needBins)
+		needWeight = needIndex
+		hasNeedWeight = true
+	}
+
+	item := newApplicant(id, name, need, score, requested, otherAid, extras)
+	if rawID != id {
+		item.OriginalID = rawID
+	}
+	item.SourceLine = line
+	item.Match = match
+	item.CostOfAttend = costOfAttendance
+	applyFTE(item, fte)
+	item.EligibleUntil = eligibleUntil
+	item.PriorAwards = priorAwards
+	item.Rank = rank
+	item.NeedWeight = needWeight
+	item.HasNeedWeight = hasNeedWeight
+	return item, warn
+}
+
+// binNeedIndex maps a continuous need index to a need level using the two
+// -need-bins thresholds: below the first is low, below the second is medium,
+// and the rest is high.
+func binNeedIndex(needIndex float64, bins []float64) string {
+	switch {
+	case needIndex < bins[0]:
+		return "low"
+	case needIndex < bins[1]:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// parseNeedCodes parses -need-codes into a map from coded need_level values
+// (e.g. 1, 2, 3) to low, medium, or high.
+func parseNeedCodes(raw string) (map[string]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	codes := make(map[string]string)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, level, ok := strings.Cut(part, "=")
+		code = strings.ToLower(strings.TrimSpace(code))
+		level = strings.ToLower(strings.TrimSpace(level))
+		if !ok || code == "" {
+			return nil, fmt.Errorf("invalid need code: %s (expected code=level)", part)
+		}
+		if level != "low" && level != "medium" && level != "high" {
+			return nil, fmt.Errorf("need code %s must map to low, medium, or high", code)
+		}
+		if _, dup := codes[code]; dup {
+			return nil, fmt.Errorf("duplicate need code: %s", code)
+		}
+		codes[code] = level
+	}
+	return codes, nil
+}
+
+// parseNeedBins parses -need-bins into two ascending thresholds within 0..1.
+func parseNeedBins(raw string) ([]float64, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ",")
+	if len(parts) != 2 {
+		return nil, errors.New("need-bins must list two thresholds (low/medium, medium/high)")
+	}
+	bins := make([]float64, 0, 2)
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid need-bins threshold: %s", strings.TrimSpace(part))
+		}
+		if value < 0 || value > 1 {
+			return nil, errors.New("need-bins thresholds must be between 0 and 1")
+		}
+		bins = append(bins, value)
+	}
+	if bins[0] >= bins[1] {
+		return nil, errors.New("need-bins thresholds must be ascending")
+	}
+	return bins, nil
+}
+
+// parseAmount parses a money amount that may use thousands separators, such
+// as 1,250.00 (or 1.250,00 with decimalComma). Grouping must come in groups of
+// three digits so a decimal comma is never mistaken for a separator.
+func parseAmount(raw string, decimalComma bool) (float64, error) {
+	group, decimal := ",", "."
+	if decimalComma {
+		group, decimal = ".", ","
+	}
+	whole, fraction, hasFraction := strings.Cut(raw, decimal)
+	if strings.Contains(whole, group) {
+		parts := strings.Split(whole, group)
+		first := strings.TrimLeft(parts[0], "+-")
+		if len(first) == 0 || len(first) > 3 {
+			return 0, fmt.Errorf("invalid digit grouping in %q", raw)
+		}
+		for _, part := range parts[1:] {
+			if len(part) != 3 {
+				return 0, fmt.Errorf("invalid digit grouping in %q", raw)
+			}
+		}
+		whole = strings.Join(parts, "")
+	}
+	normalized := whole
+	if hasFraction {
+		normalized += "." + fraction
+	}
+	return strconv.ParseFloat(normalized, 64)
+}
+
+// effectiveAwarded is the benefit an award delivers once employer match
+// funding is applied. The allocation itself always spends Awarded.
+func effectiveAwarded(item *applicant) float64 {
+	return item.Awarded * item.Match
+}
+
+// newApplicant builds an applicant and applies the input-level eligibility
+// checks shared by CSV parsing and database recomputation.
+func newApplicant(id, name, need string, score, requested, otherAid float64, extras map[string]string) *applicant {
+	applicant := &applicant{
+		ID:        id,
+		Name:      name,
+		NeedLevel: need,
+		ScoreRaw:  score,
+		Requested: requested,
+		OtherAid:  otherAid,
+		Match:     1,
+		FTE:       1,
+		Eligible:  true,
+		Extras:    extras,
+	}
+
+	if !isFinite(score) {
+		markIneligible(applicant, "score must be a finite number")
+		applicant.ScoreRaw = 0
+	}
+	if !isFinite(requested) {
+		markIneligible(applicant, "requested_amount must be a finite number")
+		applicant.Requested = 0
+	} else if requested <= 0 {
+		markIneligible(applicant, "requested_amount must be > 0")
+	} else if otherAid >= requested {
+		markIneligible(applicant, "need already met")
+	}
+	if need != "low" && need != "medium" && need != "high" {
+		markIneligible(applicant, "need_level must be low, medium, or high")
+	}
+
+	return applicant
+}
+
+// isFinite reports whether value is neither NaN nor infinite. ParseFloat
+// accepts "nan" and "inf", which would otherwise poison normalization.
+func isFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// applyTermYears converts annual requested_amount, other_aid, and
+// cost_of_attendance values into totals over a multi-year term. A term of 0
+// or 1 leaves amounts unchanged.
+func applyTermYears(applicants []*applicant, years int) {
+	if years <= 1 {
+		return
+	}
+	for _, item := range applicants {
+		item.Requested *= float64(years)
+		item.OtherAid *= float64(years)
+		item.CostOfAttend *= float64(years)
+	}
+}
+
+// applyTermSummary records the annual equivalents of the budget, spending,
+// and eligible requests when amounts are multi-year totals.
+func applyTermSummary(summary *allocationSummary, years int) {
+	if years <= 1 {
+		return
+	}
+	term := float64(years)
+	summary.TermYears = years
+	summary.AnnualBudget = summary.Budget / term
+	summary.AnnualBudgetUsed = summary.BudgetUsed / term
+	summary.AnnualRequestedTotal = summary.EligibleRequestedTotal / term
+}
+
+// overflowed reports whether a ParseFloat error only means the value was too
+// large to represent (e.g. 1e400). The ±Inf result is then left for
+// newApplicant to mark ineligible like a literal "inf".
+func overflowed(value float64, err error) bool {
+	return errors.Is(err, strconv.ErrRange) && math.IsInf(value, 0)
+}
+
+// costOfAttendanceWarning flags eligible applicants who requested more than
+// their cost_of_attendance, which usually points to a data-quality problem.
+func costOfAttendanceWarning(applicants []*applicant) string {
+	var ids []string
+	for _, item := range applicants {
+		if item.Eligible && item.CostOfAttend > 0 && item.Requested > item.CostOfAttend {
+			ids = append(ids, item.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	example := strings.Join(ids[:min(len(ids), 3)], ", ")
+	return fmt.Sprintf("%d applicant(s) requested more than their cost_of_attendance (%s); awards are capped at cost of attendance", len(ids), example)
+}
+
+// amountScaleWarning flags inputs whose median request is far above the
+// maximum award, which usually means amounts were exported in cents.
+func amountScaleWarning(applicants []*applicant, maxAward float64) string {
+	var requests []float64
+	for _, item := range applicants {
+		if item.Requested > 0 {
+			requests = append(requests, item.Requested)
+		}
+	}
+	median := percentile(requests, 0.5)
+	if maxAward <= 0 || median <= maxAward*10 {
+		return ""
+	}
+	return fmt.Sprintf("median requested_amount $%.2f is more than 10x the max award ($%.2f); amounts may be in cents (try -amount-scale 0.01)", median, maxAward)
+}
+
+func hasColumn(applicants []*applicant, column string) bool {
+	if coreColumns[column] {
+		return true
+	}
+	for _, item := range applicants {
+		if _, ok := item.Extras[column]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func columnValue(item *applicant, column string) string {
+	switch column {
+	case "applicant_id":
+		return item.ID
+	case "name":
+		return item.Name
+	case "need_level":
+		return item.NeedLevel
+	case "score":
+		return formatFloat(item.ScoreRaw, 1)
+	case "requested_amount":
+		return formatFloat(item.Requested, 2)
+	}
+	return item.Extras[column]
+}
+
+// applyFTE records a part-time applicant's full-time equivalent, which scales
+// their award ceiling but not their priority. Values outside (0, 1] make the
+// applicant ineligible.
+func applyFTE(item *applicant, fte float64) {
+	item.FTE = fte
+	if !(fte > 0 && fte <= 1) {
+		markIneligible(item, "fte must be greater than 0 and at most 1")
+	}
+}
+
+func markIneligible(applicant *applicant, message string) {
+	applicant.Eligible = false
+	if applicant.EligibilityMsg == "" {
+		applicant.EligibilityMsg = message
+		return
+	}
+	applicant.EligibilityMsg = fmt.Sprintf("%s; %s", applicant.EligibilityMsg, message)
+}
+
+// applyEligibilityExpiry marks applicants whose eligible_until date falls
+// before the as-of run date ineligible and returns how many lapsed.
+// Eligibility still holds on the eligible_until date itself.
+func applyEligibilityExpiry(applicants []*applicant, asOf time.Time) int {
+	expired := 0
+	for _, item := range applicants {
+		if item.EligibleUntil.IsZero() || !item.EligibleUntil.Before(asOf) {
+			continue
+		}
+		markIneligible(item, fmt.Sprintf("eligibility expired %s", item.EligibleUntil.Format(time.DateOnly)))
+		expired++
+	}
+	return expired
+}
+
+// applyTopPercent keeps only the top pct of the eligible pool by raw score.
+// Applicants tied with the last one kept stay eligible, so the cut never
+// splits a score.
+func applyTopPercent(applicants []*applicant, pct float64) {
+	if pct <= 0 || pct >= 1 {
+		return
+	}
+	var scores []float64
+	for _, item := range applicants {
+		if item.Eligible {
+			scores = append(scores, item.ScoreRaw)
+		}
+	}
+	if len(scores) == 0 {
+		return
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(scores)))
+	keep := max(int(math.Ceil(pct*float64(len(scores))-1e-9)), 1)
+	threshold := scores[keep-1]
+	for _, item := range applicants {
+		if item.Eligible && item.ScoreRaw < threshold {
+			markIneligible(item, fmt.Sprintf("outside top %s by score", formatPercent(pct)))
+		}
+	}
+}
+
+func applyMinScore(applicants []*applicant, minScore float64, tiers needMinScores) {
+	for _, item := range applicants {
+		threshold, tiered := tiers.forNeed(item.NeedLevel, minScore)
+		if threshold <= 0 || item.ScoreRaw >= threshold {
+			continue
+		}
+		if tiered {
+			markIneligible(item, fmt.Sprintf("score below %s-need minimum (%.1f)", strings.ToLower(item.NeedLevel), threshold))
+			continue
+		}
+		markIneligible(item, fmt.Sprintf("score below minimum (%.1f)", threshold))
+	}
+}
+
+// applyRequestCap limits the amount used for award computation to the given
+// percentile of eligible requests. Requested is left untouched for reporting.
+func applyRequestCap(applicants []*applicant, pct float64) float64 {
+	if pct <= 0 {
+		return 0
+	}
+	var requests []float64
+	for _, item := range applicants {
+		if item.Eligible {
+			requests = append(requests, unmetNeed(item))
+		}
+	}
+	if len(requests) == 0 {
+		return 0
+	}
+	capAmount := percentile(requests, pct)
+	for _, item := range applicants {
+		if unmetNeed(item) > capAmount {
+			item.AwardBasis = capAmount
+		}
+	}
+	return capAmount
+}
+
+// medianAwardCap returns multiple times the median eligible request, the
+// cohort-relative ceiling applied by -max-award-median-multiple (0 disables).
+func medianAwardCap(applicants []*applicant, multiple float64) float64 {
+	if multiple <= 0 {
+		return 0
+	}
+	var requests []float64
+	for _, item := range applicants {
+		if item.Eligible {
+			requests = append(requests, item.Requested)
+		}
+	}
+	return multiple * percentile(requests, 0.5)
+}
+
+func awardBasis(item *applicant) float64 {
+	need := unmetNeed(item)
+	if item.AwardBasis > 0 && item.AwardBasis < need {
+		return item.AwardBasis
+	}
+	return need
+}
+
+// unmetNeed is the request left after other aid; it drives award computation
+// and priority while Requested is kept for reporting.
+func unmetNeed(item *applicant) float64 {
+	return math.Max(0, item.Requested-item.OtherAid)
+}
+
+// normalizeScores scales scores by the observed maximum, or by maxRef when it
+// is set so ScoreNorm stays comparable across runs. Scores above maxRef clamp to 1.
+func normalizeScores(applicants []*applicant, maxRef float64) {
+	maxScore := maxRef
+	if maxScore <= 0 || !isFinite(maxScore) {
+		maxScore = 0
+		for _, item := range applicants {
+			if isFinite(item.ScoreRaw) && item.ScoreRaw > maxScore {
+				maxScore = item.ScoreRaw
+			}
+		}
+	}
+	if maxScore == 0 {
+		maxScore = 1
+	}
+	for _, item := range applicants {
+		item.ScoreNorm = 0
+		if isFinite(item.ScoreRaw) {
+			item.ScoreNorm = math.Min(item.ScoreRaw/maxScore, 1)
+		}
+	}
+}
+
+func assignPriority(applicants []*applicant, opts runOptions) {
+	var maxRequested float64
+	for _, item := range applicants {
+		if item.Eligible && unmetNeed(item) > maxRequested {
+			maxRequested = unmetNeed(item)
+		}
+	}
+	normalizeRanks(applicants)
+	for _, item := range applicants {
+		item.RequestNorm = 0
+		if maxRequested > 0 {
+			item.RequestNorm = math.Min(unmetNeed(item)/maxRequested, 1)
+		}
+		item.ScoreContrib, item.NeedContrib, item.RequestContrib = priorityContributions(item, opts)
+		switch prioritySourceOrDefault(opts.PrioritySource) {
+		case prioritySourceExternal:
+			item.PriorityScore = item.RankNorm
+		case prioritySourceBlend:
+			item.PriorityScore = (1-opts.RankWeight)*computedPriority(item, opts) + opts.RankWeight*item.RankNorm
+		default:
+			item.PriorityScore = computedPriority(item, opts)
+		}
+	}
+}
+
+// priorityContributions splits the formula priority into its weighted score,
+// need, and request terms, each divided by the total weight so they sum to the
+// priority before -efficiency-bias, -repeat-penalty, and rank blending.
+func priorityContributions(item *applicant, opts runOptions) (float64, float64, float64) {
+	totalWeight := opts.ScoreWeight + opts.NeedWeight + opts.RequestWeight
+	if totalWeight <= 0 {
+		return 0, 0, 0
+	}
+	return opts.ScoreWeight * item.ScoreNorm / totalWeight,
+		opts.NeedWeight * applicantNeedScore(item) / totalWeight,
+		opts.RequestWeight * item.RequestNorm / totalWeight
+}
+
+// effectiveWeights returns the score, need, and request weights as
+// computedPriority uses them: divided by their sum, so only their ratio
+// matters.
+func effectiveWeights(opts runOptions) (float64, float64, float64) {
+	total := opts.ScoreWeight + opts.NeedWeight + opts.RequestWeight
+	if total <= 0 {
+		return 0, 0, 0
+	}
+	return opts.ScoreWeight / total, opts.NeedWeight / total, opts.RequestWeight / total
+}
+
+// weightNote describes the effective weights for -verbose, calling out when
+// the flags were normalized from values that do not sum to 1.
+func weightNote(opts runOptions) string {
+	score, need, request := effectiveWeights(opts)
+	note := fmt.Sprintf("Effective weights: score %.3f, need %.3f, request %.3f", score, need, request)
+	total := opts.ScoreWeight + opts.NeedWeight + opts.RequestWeight
+	if math.Abs(total-1) > 1e-9 {
+		note += fmt.Sprintf(" (normalized from %g/%g/%g, which sum to %g; only their ratio matters)",
+			opts.ScoreWeight, opts.NeedWeight, opts.RequestWeight, total)
+	}
+	return note
+}
+
+// computedPriority is the formula priority: the weighted score, need, and
+// request terms, tilted by -efficiency-bias and reduced by -repeat-penalty.
+// RequestNorm must already be set.
+func computedPriority(item *applicant, opts runOptions) float64 {
+	totalWeight := opts.ScoreWeight + opts.NeedWeight + opts.RequestWeight
+	need := opts.NeedWeight * applicantNeedScore(item)
+	request := opts.RequestWeight * item.RequestNorm
+	priority := (opts.ScoreWeight*item.ScoreNorm + need + request) / totalWeight
+	priority *= efficiencyFactor(item, opts)
+	return applyRepeatPenalty(priority, item, opts)
+}
+
+const (
+	prioritySourceComputed = "computed"
+	prioritySourceExternal = "external"
+	prioritySourceBlend    = "blend"
+)
+
+// prioritySourceOrDefault returns the configured priority source, defaulting
+// to computed for manifests and runs recorded before -priority-source existed.
+func prioritySourceOrDefault(source string) string {
+	if source == "" {
+		return prioritySourceComputed
+	}
+	return source
+}
+
+// normalizeRanks maps eligible applicants' external ranks onto 0..1, with
+// the best (lowest) rank at 1 and the worst at 0. Applicants without a rank
+// get 0, as do ineligible ones.
+func normalizeRanks(applicants []*applicant) {
+	best, worst := 0, 0
+	for _, item := range applicants {
+		if !item.Eligible || item.Rank == 0 {
+			continue
+		}
+		if best == 0 || item.Rank < best {
+			best = item.Rank
+		}
+		if item.Rank > worst {
+			worst = item.Rank
+		}
+	}
 	for _, item := range applicants {
-		need := needWeight * needScore(item.NeedLevel)
-		item.PriorityScore = (scoreWeight*item.ScoreNorm + need) / (scoreWeight + needWeight)
+		item.RankNorm = 0
+		if !item.Eligible || item.Rank == 0 {
+			continue
+		}
+		item.RankNorm = 1
+		if worst > best {
+			item.RankNorm = float64(worst-item.Rank) / float64(worst-best)
+		}
+	}
+}
+
+// applyRepeatPenalty lowers priority by -repeat-penalty for each prior award,
+// floored at 0, so fresh applicants can outrank frequent recipients.
+func applyRepeatPenalty(priority float64, item *applicant, opts runOptions) float64 {
+	return math.Max(0, priority-opts.RepeatPenalty*float64(item.PriorAwards))
+}
+
+// efficiencyFactor tilts priority toward smaller requests so more applicants
+// can be funded per dollar. It is 1 when -efficiency-bias is unset.
+func efficiencyFactor(item *applicant, opts runOptions) float64 {
+	return 1 + opts.EfficiencyBias*(1-item.RequestNorm)
+}
+
+// applicantNeedScore is the need component of priority: the applicant's own
+// need_weight when the input provides one, otherwise the need level's score.
+func applicantNeedScore(item *applicant) float64 {
+	if item.HasNeedWeight {
+		return item.NeedWeight
 	}
+	return needScore(item.NeedLevel)
 }
 
 func needScore(level string) float64 {
@@ -506,83 +2548,1191 @@ func needScore(level string) float64 {
 	}
 }
 
-func sortApplicants(applicants []*applicant) {
+var tiebreakCriteria = []string{"score", "requested-asc", "requested-desc"}
+
+// parseTiebreak parses -tiebreak into an ordered list of criteria.
+func parseTiebreak(raw string) ([]string, error) {
+	var criteria []string
+	for _, part := range strings.Split(raw, ",") {
+		criterion := strings.ToLower(strings.TrimSpace(part))
+		if criterion == "" {
+			continue
+		}
+		known := false
+		for _, candidate := range tiebreakCriteria {
+			if criterion == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown tiebreak: %s (expected %s)", criterion, strings.Join(tiebreakCriteria, ", "))
+		}
+		criteria = append(criteria, criterion)
+	}
+	return criteria, nil
+}
+
+// tiebreakOrder returns the configured criteria, defaulting to score.
+func tiebreakOrder(tiebreak []string) []string {
+	if len(tiebreak) == 0 {
+		return []string{"score"}
+	}
+	return tiebreak
+}
+
+// sortApplicants orders applicants by priority. Equal priorities are broken
+// by each tiebreak criterion in turn (score by default), then by input order.
+func sortApplicants(applicants []*applicant, tiebreak []string) {
+	criteria := tiebreakOrder(tiebreak)
 	sort.SliceStable(applicants, func(i, j int) bool {
-		if applicants[i].PriorityScore == applicants[j].PriorityScore {
-			return applicants[i].ScoreRaw > applicants[j].ScoreRaw
+		a, b := applicants[i], applicants[j]
+		if a.PriorityScore != b.PriorityScore {
+			return a.PriorityScore > b.PriorityScore
 		}
-		return applicants[i].PriorityScore > applicants[j].PriorityScore
+		for _, criterion := range criteria {
+			switch criterion {
+			case "score":
+				if a.ScoreRaw != b.ScoreRaw {
+					return a.ScoreRaw > b.ScoreRaw
+				}
+			case "requested-asc":
+				if a.Requested != b.Requested {
+					return a.Requested < b.Requested
+				}
+			case "requested-desc":
+				if a.Requested != b.Requested {
+					return a.Requested > b.Requested
+				}
+			}
+		}
+		return false
 	})
 }
 
-func allocateBudget(applicants []*applicant, budget, minAward, maxAward float64, caps needAwardCaps, reserveHigh, reserveMedium, reserveLow, roundTo, maxPercent float64) []*applicant {
-	remaining := budget
-	var awarded []*applicant
+func allocateBudget(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	budget = spendCapBudget(applicants, budget, opts.MaxSpendPct)
+	if opts.StretchPct <= 0 {
+		return allocateFunds(applicants, budget, opts)
+	}
+	factor, baseline := stretchFactor(applicants, budget, opts)
+	opts.stretchFactor = factor
+	awarded := allocateFunds(applicants, budget, opts)
+	if factor < 1 {
+		for _, item := range awarded {
+			item.StretchShave = 1 - factor
+			item.StretchAdded = !baseline[item.ID]
+		}
+	}
+	return awarded
+}
 
-	reserves := []struct {
-		level string
-		share float64
-	}{
-		{level: "high", share: reserveHigh},
-		{level: "medium", share: reserveMedium},
-		{level: "low", share: reserveLow},
+func allocateFunds(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	if len(opts.ProgramBudgets) > 0 {
+		return allocatePrograms(applicants, budget, opts)
 	}
+	if hasNeedBudgets(opts) {
+		return allocateNeedBudgets(applicants, budget, opts)
+	}
+	return allocatePool(applicants, budget, opts)
+}
 
-	for _, reserve := range reserves {
-		if reserve.share <= 0 {
-			continue
+func hasNeedBudgets(opts runOptions) bool {
+	return opts.BudgetHigh > 0 || opts.BudgetMedium > 0 || opts.BudgetLow > 0
+}
+
+// needBudgets maps each need level to its -budget-<level> amount, scaled so
+// the levels sum to budget (which differs from their total for scenarios,
+// previews, and spend caps).
+func needBudgets(budget float64, opts runOptions) map[string]float64 {
+	budgets := map[string]float64{"high": opts.BudgetHigh, "medium": opts.BudgetMedium, "low": opts.BudgetLow}
+	total := opts.BudgetHigh + opts.BudgetMedium + opts.BudgetLow
+	if total > 0 {
+		for level := range budgets {
+			budgets[level] *= budget / total
 		}
-		reserved := budget * reserve.share
-		if reserved <= 0 {
+	}
+	return budgets
+}
+
+// allocateNeedBudgets funds each need level only from its own budget, with
+// no spillover between levels. Reserves are shares of a shared pool, so they
+// do not apply.
+func allocateNeedBudgets(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	opts.ReserveHigh, opts.ReserveMedium, opts.ReserveLow = 0, 0, 0
+	budgets := needBudgets(budget, opts)
+	var awarded []*applicant
+	for _, level := range []string{"high", "medium", "low"} {
+		if budgets[level] <= 0 {
 			continue
 		}
-		reservedAwards := allocatePass(applicants, reserved, minAward, maxAward, caps, roundTo, maxPercent, func(item *applicant) bool {
-			return item.NeedLevel == reserve.level && item.Awarded == 0
-		})
-		awarded = append(awarded, reservedAwards...)
-		remaining -= totalAwarded(reservedAwards)
+		var members []*applicant
+		for _, item := range applicants {
+			if item.NeedLevel == level {
+				members = append(members, item)
+			}
+		}
+		awarded = append(awarded, allocatePool(members, budgets[level], opts)...)
+	}
+	return awarded
+}
+
+// stretchFactor finds the smallest uniform shave, in whole-percent steps up
+// to -stretch-percent, that funds the most applicants beyond the unshaved
+// allocation, and returns the resulting award multiplier with the IDs the
+// unshaved allocation funded. The multiplier is 1 when shaving funds no one
+// extra. Trial allocations run on clones.
+func stretchFactor(applicants []*applicant, budget float64, opts runOptions) (float64, map[string]bool) {
+	fundedAt := func(factor float64) []*applicant {
+		trial := opts
+		trial.stretchFactor = factor
+		return allocateFunds(cloneApplicants(applicants), budget, trial)
+	}
+	baseline := make(map[string]bool)
+	for _, item := range fundedAt(1) {
+		baseline[item.ID] = true
+	}
+	eligible := 0
+	for _, item := range applicants {
+		if item.Eligible && item.Awarded == 0 {
+			eligible++
+		}
+	}
+	if len(baseline) >= eligible {
+		return 1, baseline
+	}
+	best := len(fundedAt(1 - opts.StretchPct))
+	if best <= len(baseline) {
+		return 1, baseline
+	}
+	for step := 1; float64(step)/100 < opts.StretchPct; step++ {
+		factor := 1 - float64(step)/100
+		if len(fundedAt(factor)) >= best {
+			return factor, baseline
+		}
+	}
+	return 1 - opts.StretchPct, baseline
+}
+
+// spendCapBudget returns the budget the allocator may spend: the nominal
+// budget, or -max-spend-percent of eligible demand when that is smaller.
+func spendCapBudget(applicants []*applicant, budget, pct float64) float64 {
+	if pct <= 0 {
+		return budget
+	}
+	return math.Min(budget, pct*eligibleDemand(applicants))
+}
+
+// eligibleDemand totals the requested amounts of eligible applicants.
+func eligibleDemand(applicants []*applicant) float64 {
+	var total float64
+	for _, item := range applicants {
+		if item.Eligible {
+			total += item.Requested
+		}
+	}
+	return total
+}
+
+// applySpendCap records the effective budget and the reason when
+// -max-spend-percent held spending below the nominal budget.
+func applySpendCap(summary *allocationSummary, effective, pct float64) {
+	if pct <= 0 || effective >= summary.Budget {
+		return
+	}
+	summary.EffectiveBudget = effective
+	summary.EffectiveBudgetNote = fmt.Sprintf("capped at %s of eligible demand (%s); %s held back",
+		formatPercent(pct), formatCurrency(effective/pct), formatCurrency(summary.Budget-effective))
+}
+
+// allocatePrograms runs an independent allocation per program using that
+// program's budget. Program budgets are scaled when budget differs from their
+// total (as in scenario analysis). Applicants in unbudgeted programs stay unfunded.
+func allocatePrograms(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	var total float64
+	for _, amount := range opts.ProgramBudgets {
+		total += amount
+	}
+	scale := 1.0
+	if total > 0 {
+		scale = budget / total
+	}
+
+	var awarded []*applicant
+	for _, program := range slices.Sorted(maps.Keys(opts.ProgramBudgets)) {
+		var members []*applicant
+		for _, item := range applicants {
+			if programOf(item) == program {
+				members = append(members, item)
+			}
+		}
+		awarded = append(awarded, allocatePool(members, opts.ProgramBudgets[program]*scale, opts)...)
+	}
+	return awarded
+}
+
+func allocatePool(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	remaining := budget
+	var awarded []*applicant
+
+	reserves := []struct {
+		level string
+		share float64
+	}{
+		{level: "high", share: opts.ReserveHigh},
+		{level: "medium", share: opts.ReserveMedium},
+		{level: "low", share: opts.ReserveLow},
+	}
+
+	representAwards := allocateRepresentation(applicants, remaining, opts)
+	markPass(representAwards, "representation")
+	awarded = append(awarded, representAwards...)
+	remaining -= totalAwarded(representAwards)
+
+	for _, reserve := range reserves {
+		if reserve.share <= 0 {
+			continue
+		}
+		// Representation awards come out of the same budget, so a reserve
+		// can only use what is still left.
+		reserved := math.Min(budget*reserve.share, remaining)
+		if reserved <= 0 {
+			continue
+		}
+		allow := func(item *applicant) bool {
+			return item.NeedLevel == reserve.level && item.Awarded == 0
+		}
+		var reservedAwards []*applicant
+		if reserveModeOrDefault(opts.ReserveMode) == reserveModeSpread {
+			reservedAwards = allocateSpread(applicants, reserved, opts, allow)
+		} else {
+			reservedAwards = allocatePass(applicants, reserved, opts, true, allow)
+		}
+		markPass(reservedAwards, "reserve-"+reserve.level)
+		awarded = append(awarded, reservedAwards...)
+		remaining -= totalAwarded(reservedAwards)
+	}
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	remainingAwards := allocateRemaining(applicants, remaining, opts)
+	awarded = append(awarded, remainingAwards...)
+	if opts.Sweep {
+		sweepBudget(awarded, budget-totalAwarded(awarded), opts)
+	}
+	if opts.TopupLeftover {
+		topUpLeftover(applicants, budget-totalAwarded(awarded), opts)
+	}
+	return awarded
+}
+
+const (
+	reserveModePriority = "priority"
+	reserveModeSpread   = "spread"
+)
+
+// reserveModeOrDefault returns the configured reserve mode, defaulting to
+// priority for manifests and runs recorded before -reserve-mode existed.
+// greedy and proportional are accepted as aliases for priority and spread.
+func reserveModeOrDefault(mode string) string {
+	switch mode {
+	case "", "greedy":
+		return reserveModePriority
+	case "proportional":
+		return reserveModeSpread
+	}
+	return mode
+}
+
+// allocateSpread shares a reserve proportionally across every allowed
+// applicant instead of funding them greedily, dropping the lowest-priority
+// applicant while any share would fall below that applicant's minimum award.
+// Scaled shares are floored back onto the award grid, so whatever that leaves
+// of the reserve falls through to the general pass.
+func allocateSpread(applicants []*applicant, budget float64, opts runOptions, allow func(*applicant) bool) []*applicant {
+	var allowed []*applicant
+	for _, item := range applicants {
+		if allow(item) {
+			allowed = append(allowed, item)
+		}
+	}
+	shared := allocateShared(allowed, budget, opts, func(planned []float64, budget float64) []float64 {
+		awards := proportionalAwards(planned, budget)
+		for i, award := range awards {
+			if award < planned[i] {
+				awards[i] = floorToAwardGrid(award, opts)
+			}
+		}
+		return awards
+	})
+	var awarded []*applicant
+	for _, item := range shared {
+		if item.Awarded > 0 {
+			awarded = append(awarded, item)
+		}
+	}
+	for _, item := range awarded {
+		planned, _ := plannedAward(item, opts)
+		if item.Awarded < planned {
+			item.Constraint = constraintBudget
+		} else {
+			item.Constraint = plannedConstraint(item, opts)
+		}
+	}
+	return awarded
+}
+
+// allocateRemaining funds unfunded applicants in priority order. With
+// -tier-strict it instead runs one pass per need tier, high to low, so no
+// medium or low applicant is funded while a higher tier still fits the budget.
+func allocateRemaining(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	if !opts.TierStrict {
+		awarded := allocatePass(applicants, budget, opts, false, func(item *applicant) bool {
+			return item.Awarded == 0
+		})
+		markPass(awarded, "general")
+		return awarded
+	}
+	remaining := budget
+	var awarded []*applicant
+	for _, level := range []string{"high", "medium", "low"} {
+		tierAwards := allocatePass(applicants, remaining, opts, false, func(item *applicant) bool {
+			return item.NeedLevel == level && item.Awarded == 0
+		})
+		markPass(tierAwards, "tier-"+level)
+		awarded = append(awarded, tierAwards...)
+		remaining -= totalAwarded(tierAwards)
+		if remaining <= 0 {
+			break
+		}
+	}
+	return awarded
+}
+
+// markPass records which allocation pass funded each award.
+func markPass(awards []*applicant, pass string) {
+	for _, item := range awards {
+		item.Pass = pass
+	}
+}
+
+// buildPassBreakdown totals spending and funded applicants per allocation
+// pass, in the order the passes first funded someone. Sweep and leftover
+// top-ups are reported as their own passes rather than under the pass that
+// made the award.
+func buildPassBreakdown(awarded []*applicant) []passResult {
+	var results []passResult
+	index := make(map[string]int)
+	var sweep, topup passResult
+	for _, item := range awarded {
+		pos, ok := index[item.Pass]
+		if !ok {
+			pos = len(results)
+			index[item.Pass] = pos
+			results = append(results, passResult{Name: item.Pass})
+		}
+		results[pos].Spent += item.Awarded - item.Swept - item.ToppedUp
+		results[pos].Funded++
+		if item.Swept > 0 {
+			sweep.Spent += item.Swept
+			sweep.Funded++
+		}
+		if item.ToppedUp > 0 {
+			topup.Spent += item.ToppedUp
+			topup.Funded++
+		}
+	}
+	if sweep.Funded > 0 {
+		sweep.Name = "sweep"
+		results = append(results, sweep)
+	}
+	if topup.Funded > 0 {
+		topup.Name = "topup"
+		results = append(results, topup)
+	}
+	return results
+}
+
+// allocateRepresentation funds the highest-priority matching applicants for
+// each -min-represent rule until its award count is reached. Awards made for
+// earlier rules (or already in place) count toward later ones.
+func allocateRepresentation(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	remaining := budget
+	var awarded []*applicant
+	for _, rule := range opts.MinRepresent {
+		have := 0
+		for _, item := range applicants {
+			if item.Awarded > 0 && rule.matches(item) {
+				have++
+			}
+		}
+		for _, item := range applicants {
+			if have >= rule.Count || remaining <= 0 {
+				break
+			}
+			if !item.Eligible || item.Awarded > 0 || !rule.matches(item) {
+				continue
+			}
+			award, _ := plannedAward(item, opts)
+			if award <= 0 {
+				continue
+			}
+			constraint := plannedConstraint(item, opts)
+			if award > remaining {
+				if remaining < opts.MinAward {
+					continue
+				}
+				award = remaining
+				constraint = constraintBudget
+			}
+			item.Awarded = award
+			item.Constraint = constraint
+			remaining -= award
+			awarded = append(awarded, item)
+			have++
+		}
+	}
+	return awarded
+}
+
+func (rule representRule) matches(item *applicant) bool {
+	return strings.EqualFold(strings.TrimSpace(columnValue(item, rule.Column)), rule.Value)
+}
+
+// sweepBudget tops up partially funded awards with leftover budget, closing
+// the smallest funding gaps first. Awards never exceed the applicant's
+// planned award, so every cap and rounding rule still applies.
+func sweepBudget(awarded []*applicant, leftover float64, opts runOptions) float64 {
+	if leftover <= 0 {
+		return 0
+	}
+	type gap struct {
+		item   *applicant
+		amount float64
+	}
+	var gaps []gap
+	for _, item := range awarded {
+		ceiling, _ := plannedAward(item, opts)
+		if item.Awarded > 0 && item.Awarded < ceiling {
+			gaps = append(gaps, gap{item: item, amount: ceiling - item.Awarded})
+		}
+	}
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gaps[i].amount < gaps[j].amount
+	})
+
+	var swept float64
+	spent := levelSpending(awarded)
+	for _, entry := range gaps {
+		if leftover <= 0 {
+			break
+		}
+		topUp := raiseAward(entry.item, entry.amount, leftover, opts, spent)
+		entry.item.Swept += topUp
+		leftover -= topUp
+		swept += topUp
+	}
+	return swept
+}
+
+// topUpLeftover spends leftover budget on partially funded awards in priority
+// order, raising each toward its request before moving to the next. The
+// applicants must already be sorted by priority. Awards never exceed the
+// applicant's planned award, so every cap and rounding rule still applies.
+func topUpLeftover(applicants []*applicant, leftover float64, opts runOptions) float64 {
+	var used float64
+	spent := levelSpending(applicants)
+	for _, item := range applicants {
+		if leftover <= 0 {
+			break
+		}
+		if item.Awarded <= 0 {
+			continue
+		}
+		ceiling, _ := plannedAward(item, opts)
+		if item.Awarded >= ceiling {
+			continue
+		}
+		topUp := raiseAward(item, ceiling-item.Awarded, leftover, opts, spent)
+		item.ToppedUp += topUp
+		leftover -= topUp
+		used += topUp
+	}
+	return used
+}
+
+// raiseAward adds up to gap (limited by leftover and the need level's
+// absolute cap, and floored to the award increment when it falls short) to an
+// award, updates its constraint and the level's spending, and returns the
+// amount added.
+func raiseAward(item *applicant, gap, leftover float64, opts runOptions, spent map[string]float64) float64 {
+	room := levelRoom(opts, item.NeedLevel, spent)
+	topUp := math.Max(0, math.Min(gap, math.Min(leftover, room)))
+	if topUp < gap && opts.AwardIncrement > 0 {
+		topUp = math.Max(0, floorToIncrement(item.Awarded+topUp, opts.AwardIncrement)-item.Awarded)
+	}
+	item.Awarded += topUp
+	spent[item.NeedLevel] += topUp
+	switch {
+	case topUp == gap:
+		item.Constraint = plannedConstraint(item, opts)
+	case room < leftover:
+		item.Constraint = constraintLevelCap
+	default:
+		item.Constraint = constraintBudget
+	}
+	return topUp
+}
+
+// partialAwardCount counts awards below the applicant's unmet need, which
+// -max-partial bounds.
+func partialAwardCount(applicants []*applicant) int {
+	count := 0
+	for _, item := range applicants {
+		if item.Awarded > 0 && item.Awarded < unmetNeed(item) {
+			count++
+		}
+	}
+	return count
+}
+
+// needLevelAmountCap returns the -cap-<level>-amount limit on total awards
+// to a need level, or 0 when the level is uncapped.
+func needLevelAmountCap(opts runOptions, level string) float64 {
+	switch strings.ToLower(level) {
+	case "high":
+		return opts.CapHighAmount
+	case "medium":
+		return opts.CapMediumAmount
+	case "low":
+		return opts.CapLowAmount
+	}
+	return 0
+}
+
+// levelSpending totals the current awards by need level.
+func levelSpending(applicants []*applicant) map[string]float64 {
+	spent := make(map[string]float64)
+	for _, item := range applicants {
+		if item.Awarded > 0 {
+			spent[item.NeedLevel] += item.Awarded
+		}
+	}
+	return spent
+}
+
+// levelRoom is how much more a need level may receive under its absolute
+// cap, or +Inf when the level is uncapped.
+func levelRoom(opts runOptions, level string, spent map[string]float64) float64 {
+	limit := needLevelAmountCap(opts, level)
+	if limit <= 0 {
+		return math.Inf(1)
+	}
+	return math.Max(0, limit-spent[level])
+}
+
+// summarizeLevelCaps reports usage for each capped need level and warns when
+// a cap that was reached left budget unspent while eligible applicants in
+// other levels went unfunded.
+func summarizeLevelCaps(applicants []*applicant, budgetLeft float64, opts runOptions) ([]levelCapUsage, []string) {
+	spent := levelSpending(applicants)
+	unfunded := make(map[string]int)
+	for _, item := range applicants {
+		if item.Eligible && item.Awarded <= 0 {
+			unfunded[item.NeedLevel]++
+		}
+	}
+	var usage []levelCapUsage
+	var warnings []string
+	for _, level := range []string{"high", "medium", "low"} {
+		limit := needLevelAmountCap(opts, level)
+		if limit <= 0 {
+			continue
+		}
+		entry := levelCapUsage{NeedLevel: level, Cap: limit, Used: spent[level]}
+		entry.Reached = limit-entry.Used < math.Max(opts.MinAward, 0.01)
+		usage = append(usage, entry)
+		if !entry.Reached || budgetLeft < 0.01 {
+			continue
+		}
+		others := 0
+		for other, count := range unfunded {
+			if other != level {
+				others += count
+			}
+		}
+		if others > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s-need cap of $%.2f was reached with $%.2f unspent and %d eligible applicants unfunded in other levels",
+				level, limit, budgetLeft, others))
+		}
+	}
+	return usage, warnings
+}
+
+// allocatePass funds allowed applicants in priority order. When fitRemaining
+// is set (reserve passes), an applicant whose award no longer fits is skipped
+// so later applicants with smaller awards can still use the remaining budget.
+func allocatePass(applicants []*applicant, budget float64, opts runOptions, fitRemaining bool, allow func(*applicant) bool) []*applicant {
+	remaining := budget
+	var awarded []*applicant
+	spent := levelSpending(applicants)
+	partials := partialAwardCount(applicants)
+	for _, item := range applicants {
+		if remaining < opts.MinMeaningful {
+			break
+		}
+		if !item.Eligible || !allow(item) {
+			continue
+		}
+		award, _ := plannedAward(item, opts)
+		if award <= 0 {
+			continue
+		}
+		constraint := plannedConstraint(item, opts)
+		if room := levelRoom(opts, item.NeedLevel, spent); award > room {
+			award = floorToIncrement(room, opts.AwardIncrement)
+			if award <= 0 || award < opts.MinAward {
+				continue
+			}
+			constraint = constraintLevelCap
+		}
+		if award > remaining {
+			if remaining < opts.MinAward {
+				if fitRemaining {
+					continue
+				}
+				break
+			}
+			award = floorToIncrement(remaining, opts.AwardIncrement)
+			if award <= 0 || award < opts.MinAward {
+				if fitRemaining {
+					continue
+				}
+				break
+			}
+			constraint = constraintBudget
+		}
+		partial := award < unmetNeed(item)
+		if partial && opts.MaxPartial > 0 && partials >= opts.MaxPartial {
+			continue
+		}
+		if partial {
+			partials++
+		}
+		item.Awarded = award
+		item.Constraint = constraint
+		remaining -= award
+		spent[item.NeedLevel] += award
+		awarded = append(awarded, item)
+		if remaining <= 0 {
+			break
+		}
+	}
+	return awarded
+}
+
+// gapClosedPerDollar is the share of the eligible funding gap closed per
+// budget dollar, a single efficiency number for comparing parameter sets.
+func gapClosedPerDollar(requiredFull, fundingGap, budget float64) float64 {
+	if budget <= 0 {
+		return 0
+	}
+	return (requiredFull - fundingGap) / budget
+}
+
+// strandedBudget is the leftover budget that -min-meaningful-award left
+// unallocated because it was too small to be worth funding.
+func strandedBudget(budgetLeft, minMeaningful float64) float64 {
+	if budgetLeft <= 0 || budgetLeft >= minMeaningful {
+		return 0
+	}
+	return budgetLeft
+}
+
+// invariantTolerance absorbs float rounding when comparing dollar totals.
+const invariantTolerance = 0.005
+
+// checkInvariants validates the core allocation invariants for a finished
+// run: the total awarded stays within the budget and matches the summary, no
+// award is negative or above the applicant's planned award, ineligible
+// applicants are never funded, and each need level reserve was spent before an
+// applicant of that level went unfunded. The reserve check is skipped with
+// per-program budgets, where reserves apply to each program separately. It
+// returns every violation found, joined.
+func checkInvariants(applicants []*applicant, summary allocationSummary, opts runOptions) error {
+	var violations []error
+	var total float64
+	levelAwarded := make(map[string]float64)
+	for _, item := range applicants {
+		if item.Awarded < 0 {
+			violations = append(violations, fmt.Errorf("applicant %s has a negative award ($%.2f)", item.ID, item.Awarded))
+		}
+		if !item.Eligible && item.Awarded != 0 {
+			violations = append(violations, fmt.Errorf("ineligible applicant %s was awarded $%.2f", item.ID, item.Awarded))
+		}
+		if planned, _ := plannedAward(item, opts); item.Eligible && item.Awarded > planned+invariantTolerance {
+			violations = append(violations, fmt.Errorf("applicant %s was awarded $%.2f, above its planned award of $%.2f", item.ID, item.Awarded, planned))
+		}
+		total += item.Awarded
+		levelAwarded[item.NeedLevel] += item.Awarded
+	}
+	if total > summary.Budget+invariantTolerance {
+		violations = append(violations, fmt.Errorf("total awarded $%.2f exceeds budget $%.2f", total, summary.Budget))
+	}
+	if math.Abs(total-summary.BudgetUsed) > invariantTolerance {
+		violations = append(violations, fmt.Errorf("summary budget used $%.2f does not match awards total $%.2f", summary.BudgetUsed, total))
+	}
+
+	if len(opts.ProgramBudgets) == 0 && !hasNeedBudgets(opts) {
+		reserves := map[string]float64{"high": opts.ReserveHigh, "medium": opts.ReserveMedium, "low": opts.ReserveLow}
+		// Like allocatePool, each reserve is capped by what representation
+		// awards and the earlier reserves left of the budget.
+		available := summary.Budget
+		for _, item := range applicants {
+			if item.Pass == "representation" {
+				available -= item.Awarded - item.Swept - item.ToppedUp
+			}
+		}
+		for _, level := range []string{"high", "medium", "low"} {
+			target := math.Max(0, math.Min(summary.Budget*reserves[level], available))
+			available -= target
+			shortfall := target - levelAwarded[level]
+			if reserves[level] <= 0 || shortfall <= invariantTolerance || shortfall < opts.MinAward {
+				continue
+			}
+			for _, item := range applicants {
+				if !item.Eligible || item.NeedLevel != level || item.Awarded > 0 {
+					continue
+				}
+				if award, _ := plannedAward(item, opts); award > 0 {
+					violations = append(violations, fmt.Errorf("applicant %s went unfunded with $%.2f of the %s need reserve unspent", item.ID, shortfall, level))
+				}
+			}
+		}
+	}
+	return errors.Join(violations...)
+}
+
+// plannedAward returns the award an applicant would receive with an unlimited
+// budget, along with the minimum award that applies to them.
+func plannedAward(item *applicant, opts runOptions) (float64, float64) {
+	itemMin, itemMax := itemAwardCaps(item, opts)
+	award := computeAward(awardBasis(item), itemMin, itemMax, opts.RoundTo, opts.RoundSet, opts.MaxPercent, opts.AwardIncrement)
+	if opts.stretchFactor > 0 && opts.stretchFactor < 1 && award > 0 {
+		shaved := floorToIncrement(award*opts.stretchFactor, opts.AwardIncrement)
+		award = math.Max(shaved, math.Min(award, itemMin))
+	}
+	return award, itemMin
+}
+
+// Binding constraints recorded on each award by the priority allocation.
+const (
+	constraintFull       = "full_request"
+	constraintMaxAward   = "max_award"
+	constraintCostOfAtt  = "cost_of_attendance"
+	constraintFTE        = "fte"
+	constraintMaxPercent = "max_percent"
+	constraintRequestCap = "request_cap"
+	constraintRounding   = "rounding"
+	constraintLevelCap   = "level_cap"
+	constraintStretch    = "stretch"
+	constraintBudget     = "budget"
+)
+
+// plannedConstraint reports which limit produced an applicant's planned
+// award: the full unmet need, the max award, the cost of attendance, the max
+// percent of the request, the request-cap percentile, or rounding to the
+// award increment.
+func plannedConstraint(item *applicant, opts runOptions) string {
+	award, itemMin := plannedAward(item, opts)
+	if opts.stretchFactor > 0 && opts.stretchFactor < 1 {
+		opts.stretchFactor = 0
+		if full, _ := plannedAward(item, opts); award < full {
+			return constraintStretch
+		}
+	}
+	need := unmetNeed(item)
+	if award >= need {
+		return constraintFull
+	}
+	_, itemMax := itemAwardCaps(item, opts)
+	basis := awardBasis(item)
+	unrounded := computeAward(basis, itemMin, itemMax, 0, nil, opts.MaxPercent, 0)
+	percentCap := basis * opts.MaxPercent
+	switch {
+	case unrounded >= need:
+		return constraintRounding
+	case itemMax < basis && itemMax <= percentCap && unrounded == itemMax:
+		if itemMax == item.CostOfAttend {
+			return constraintCostOfAtt
+		}
+		if item.FTE > 0 && item.FTE < 1 {
+			return constraintFTE
+		}
+		return constraintMaxAward
+	case percentCap < basis && unrounded == percentCap:
+		return constraintMaxPercent
+	case basis < need:
+		return constraintRequestCap
+	}
+	return constraintRounding
+}
+
+var allocationModes = []string{"priority", "proportional", "equal", "max-recipients"}
+
+func parseModeList(raw string) ([]string, error) {
+	var modes []string
+	for _, part := range strings.Split(raw, ",") {
+		mode := strings.ToLower(strings.TrimSpace(part))
+		if mode == "" {
+			continue
+		}
+		known := false
+		for _, candidate := range allocationModes {
+			if mode == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown allocation mode: %s (expected %s)", mode, strings.Join(allocationModes, ", "))
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+// parseWeightPairs reads -sweep-weights as score/need pairs. Each pair is
+// used with the run's request weight, so it must leave a non-zero total.
+func parseWeightPairs(raw string) ([][2]float64, error) {
+	var pairs [][2]float64
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		scoreText, needText, ok := strings.Cut(part, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid sweep-weights entry %q (expected score/need)", part)
+		}
+		score, scoreErr := strconv.ParseFloat(strings.TrimSpace(scoreText), 64)
+		need, needErr := strconv.ParseFloat(strings.TrimSpace(needText), 64)
+		if scoreErr != nil || needErr != nil || !isFinite(score) || !isFinite(need) || score < 0 || need < 0 {
+			return nil, fmt.Errorf("invalid sweep-weights entry %q (weights must be non-negative numbers)", part)
+		}
+		pairs = append(pairs, [2]float64{score, need})
+	}
+	return pairs, nil
+}
+
+// buildWeightSweep re-prioritizes, re-sorts, and allocates the budget under
+// each score/need pair. Pairs with the same effective weights share one
+// allocation through the scenario cache.
+func buildWeightSweep(applicants []*applicant, budget float64, pairs [][2]float64, opts runOptions) []weightSweepResult {
+	cache := newScenarioCache(applicants, opts)
+	results := make([]weightSweepResult, 0, len(pairs))
+	for _, pair := range pairs {
+		weighted := opts
+		weighted.ScoreWeight, weighted.NeedWeight = pair[0], pair[1]
+		score, need, request := effectiveWeights(weighted)
+		scenario := cache.result(scenarioParams{Budget: budget, ScoreWeight: score, NeedWeight: need, RequestWeight: request})
+		results = append(results, weightSweepResult{
+			ScoreWeight:     pair[0],
+			NeedWeight:      pair[1],
+			AwardedCount:    scenario.AwardedCount,
+			CoverageRate:    scenario.CoverageRate,
+			FullFundingRate: scenario.FullFundingRate,
+			NeedCoverage:    scenario.needCoverage,
+		})
+	}
+	return results
+}
+
+// levelCoverage is the awarded share of eligible requests for each need level.
+func levelCoverage(applicants []*applicant) map[string]float64 {
+	requested := make(map[string]float64)
+	awarded := make(map[string]float64)
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		requested[item.NeedLevel] += item.Requested
+		awarded[item.NeedLevel] += item.Awarded
+	}
+	coverage := make(map[string]float64, len(requested))
+	for level, total := range requested {
+		if total > 0 {
+			coverage[level] = awarded[level] / total
+		}
+	}
+	return coverage
+}
+
+func allocateWithMode(applicants []*applicant, budget float64, mode string, opts runOptions) []*applicant {
+	switch mode {
+	case "proportional":
+		return allocateShared(applicants, budget, opts, proportionalAwards)
+	case "equal":
+		return allocateShared(applicants, budget, opts, equalAwards)
+	case "max-recipients":
+		return allocateMaxRecipients(applicants, budget, opts)
+	default:
+		return allocateBudget(applicants, budget, opts)
+	}
+}
+
+// allocateShared funds every eligible applicant at once using the share
+// function, dropping the lowest-priority applicant while any share would fall
+// below that applicant's minimum award.
+func allocateShared(applicants []*applicant, budget float64, opts runOptions, share func(planned []float64, budget float64) []float64) []*applicant {
+	var candidates []*applicant
+	var planned []float64
+	var minimums []float64
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		award, itemMin := plannedAward(item, opts)
+		if award <= 0 {
+			continue
+		}
+		candidates = append(candidates, item)
+		planned = append(planned, award)
+		minimums = append(minimums, itemMin)
+	}
+
+	for len(candidates) > 0 {
+		awards := share(planned, budget)
+		fits := true
+		for i, award := range awards {
+			if award < minimums[i] && award < planned[i] {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			for i, item := range candidates {
+				item.Awarded = awards[i]
+			}
+			return candidates
+		}
+		last := len(candidates) - 1
+		candidates = candidates[:last]
+		planned = planned[:last]
+		minimums = minimums[:last]
+	}
+	return nil
+}
+
+func proportionalAwards(planned []float64, budget float64) []float64 {
+	var total float64
+	for _, award := range planned {
+		total += award
+	}
+	scale := 1.0
+	if total > budget && total > 0 {
+		scale = budget / total
+	}
+	awards := make([]float64, len(planned))
+	for i, award := range planned {
+		awards[i] = award * scale
+	}
+	return awards
+}
+
+// equalAwards water-fills the budget: everyone gets the same amount, capped at
+// their planned award, with any excess redistributed to the rest.
+func equalAwards(planned []float64, budget float64) []float64 {
+	sorted := append([]float64(nil), planned...)
+	sort.Float64s(sorted)
+	level := 0.0
+	remaining := budget
+	for i, award := range sorted {
+		share := remaining / float64(len(sorted)-i)
+		if award > share {
+			level = share
+			break
+		}
+		remaining -= award
+		level = award
+	}
+	awards := make([]float64, len(planned))
+	for i, award := range planned {
+		awards[i] = math.Min(award, level)
+	}
+	return awards
+}
+
+func allocateMaxRecipients(applicants []*applicant, budget float64, opts runOptions) []*applicant {
+	var candidates []*applicant
+	planned := make(map[*applicant]float64)
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		award, _ := plannedAward(item, opts)
+		if award <= 0 {
+			continue
+		}
+		candidates = append(candidates, item)
+		planned[item] = award
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return planned[candidates[i]] < planned[candidates[j]]
+	})
+
+	remaining := budget
+	var awarded []*applicant
+	for _, item := range candidates {
+		award := planned[item]
+		if award > remaining {
+			break
+		}
+		item.Awarded = award
+		remaining -= award
+		awarded = append(awarded, item)
+	}
+	return awarded
+}
+
+func buildModeResults(applicants []*applicant, budget float64, modes []string, opts runOptions) []modeResult {
+	results := make([]modeResult, 0, len(modes))
+	for _, mode := range modes {
+		clone := cloneApplicants(applicants)
+		awarded := allocateWithMode(clone, budget, mode, opts)
+		scenario := summarizeScenario(clone, awarded, budget)
+		var eligibleAwards []float64
+		for _, item := range clone {
+			if item.Eligible {
+				eligibleAwards = append(eligibleAwards, item.Awarded)
+			}
+		}
+		results = append(results, modeResult{
+			Mode:            mode,
+			AwardedCount:    scenario.AwardedCount,
+			CoverageRate:    scenario.CoverageRate,
+			FullFundingRate: scenario.FullFundingRate,
+			Gini:            giniCoefficient(eligibleAwards),
+			BudgetUsed:      scenario.BudgetUsed,
+			BudgetLeft:      scenario.BudgetLeft,
+		})
+	}
+	return results
+}
+
+// giniCoefficient measures award inequality across eligible applicants,
+// counting unfunded applicants as zero awards.
+func giniCoefficient(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var total float64
+	var weighted float64
+	for i, value := range sorted {
+		total += value
+		weighted += float64(i+1) * value
 	}
-
-	if remaining < 0 {
-		remaining = 0
+	if total == 0 {
+		return 0
 	}
-
-	remainingAwards := allocatePass(applicants, remaining, minAward, maxAward, caps, roundTo, maxPercent, func(item *applicant) bool {
-		return item.Awarded == 0
-	})
-	awarded = append(awarded, remainingAwards...)
-	return awarded
+	n := float64(len(sorted))
+	return (2*weighted)/(n*total) - (n+1)/n
 }
 
-func allocatePass(applicants []*applicant, budget, minAward, maxAward float64, caps needAwardCaps, roundTo, maxPercent float64, allow func(*applicant) bool) []*applicant {
-	remaining := budget
+// allocateRounds runs a full allocation, then returns declined offers to the
+// budget and re-offers it to the highest-priority unfunded applicants.
+func allocateRounds(applicants []*applicant, budget float64, opts runOptions) ([]*applicant, []roundResult) {
+	budget = spendCapBudget(applicants, budget, opts.MaxSpendPct)
+	declined := make(map[string]bool, len(opts.DeclinedIDs))
+	for _, id := range opts.DeclinedIDs {
+		declined[optionIDNormalization(opts).apply(id)] = true
+	}
+
 	var awarded []*applicant
-	for _, item := range applicants {
-		if !item.Eligible || !allow(item) {
-			continue
+	var results []roundResult
+	for round := 1; round <= opts.Rounds; round++ {
+		available := budget - totalAwarded(awarded)
+		if available < 0 {
+			available = 0
 		}
-		itemMin, itemMax := awardCapsForNeed(item.NeedLevel, minAward, maxAward, caps)
-		award := computeAward(item.Requested, itemMin, itemMax, roundTo, maxPercent)
-		if award <= 0 {
-			continue
+		var roundAwards []*applicant
+		if round == 1 {
+			roundAwards = allocateBudget(applicants, available, opts)
+		} else {
+			roundAwards = reofferRemaining(applicants, available, budget, opts)
+			markPass(roundAwards, fmt.Sprintf("round-%d", round))
 		}
-		if award > remaining {
-			if remaining < minAward {
-				break
+
+		result := roundResult{
+			Round:           round,
+			BudgetAvailable: available,
+			Offered:         len(roundAwards),
+			OfferedAmount:   totalAwarded(roundAwards),
+		}
+		for _, item := range roundAwards {
+			if !declined[item.ID] {
+				awarded = append(awarded, item)
+				continue
 			}
-			award = remaining
+			result.Declined++
+			result.DeclinedAmount += item.Awarded
+			item.Awarded = 0
+			// Decliners leave the pool for later rounds but are counted
+			// apart from ineligible applicants.
+			item.Eligible = false
+			item.Declined = true
 		}
-		item.Awarded = award
-		remaining -= award
-		awarded = append(awarded, item)
-		if remaining <= 0 {
+		result.Accepted = result.Offered - result.Declined
+		result.BudgetUsed = totalAwarded(awarded)
+		results = append(results, result)
+		if result.Declined == 0 {
 			break
 		}
 	}
+	return awarded, results
+}
+
+// reofferRemaining allocates a later round's available budget. With
+// need-level budgets each level only re-offers what its own budget has left.
+func reofferRemaining(applicants []*applicant, available, budget float64, opts runOptions) []*applicant {
+	if !hasNeedBudgets(opts) {
+		return allocateRemaining(applicants, available, opts)
+	}
+	budgets := needBudgets(budget, opts)
+	spent := levelSpending(applicants)
+	var awarded []*applicant
+	for _, level := range []string{"high", "medium", "low"} {
+		left := budgets[level] - spent[level]
+		if left <= 0 {
+			continue
+		}
+		var members []*applicant
+		for _, item := range applicants {
+			if item.NeedLevel == level {
+				members = append(members, item)
+			}
+		}
+		awarded = append(awarded, allocateRemaining(members, left, opts)...)
+	}
 	return awarded
 }
 
-func computeAward(requested, minAward, maxAward, roundTo, maxPercent float64) float64 {
+func parseIDList(raw string) []string {
+	var ids []string
+	for _, part := range strings.Split(raw, ",") {
+		id := strings.TrimSpace(part)
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func computeAward(requested, minAward, maxAward, roundTo float64, roundSet []float64, maxPercent, increment float64) float64 {
 	capAmount := maxAward
 	percentCap := requested * maxPercent
 	if percentCap < capAmount {
@@ -602,6 +3752,15 @@ func computeAward(requested, minAward, maxAward, roundTo, maxPercent float64) fl
 		award = roundToIncrement(award, roundTo)
 		award = clamp(award, minAward, capAmount)
 	}
+	if len(roundSet) > 0 {
+		award = roundToSet(award, roundSet, minAward, capAmount)
+	}
+	if increment > 0 {
+		award = floorToIncrement(award, increment)
+		if award < minAward {
+			return 0
+		}
+	}
 	return award
 }
 
@@ -631,6 +3790,22 @@ func validateNeedCaps(globalMin, globalMax float64, caps needAwardCaps) error {
 	return nil
 }
 
+// itemAwardCaps resolves an applicant's min and max award from the global and
+// need-level caps, lowering the max to the median award cap when one is set.
+func itemAwardCaps(item *applicant, opts runOptions) (float64, float64) {
+	itemMin, itemMax := awardCapsForNeed(item.NeedLevel, opts.MinAward, opts.MaxAward, optionCaps(opts))
+	if opts.medianAwardCap > 0 && opts.medianAwardCap < itemMax {
+		itemMax = opts.medianAwardCap
+	}
+	if item.FTE > 0 && item.FTE < 1 {
+		itemMax *= item.FTE
+	}
+	if item.CostOfAttend > 0 && item.CostOfAttend < itemMax {
+		itemMax = item.CostOfAttend
+	}
+	return itemMin, itemMax
+}
+
 func awardCapsForNeed(level string, globalMin, globalMax float64, caps needAwardCaps) (float64, float64) {
 	switch strings.ToLower(level) {
 	case "high":
@@ -664,6 +3839,79 @@ func clamp(value, min, max float64) float64 {
 	return value
 }
 
+// roundToSet snaps value to the nearest standard amount that lies within
+// [minAward, capAmount]. A value equidistant between two amounts snaps to the
+// lower one, so ties never spend more. Values with no amount inside the caps
+// are returned unchanged.
+func roundToSet(value float64, set []float64, minAward, capAmount float64) float64 {
+	best := value
+	bestDistance := math.Inf(1)
+	for _, amount := range set {
+		if amount < minAward || amount > capAmount {
+			continue
+		}
+		distance := math.Abs(amount - value)
+		if distance < bestDistance || (distance == bestDistance && amount < best) {
+			best = amount
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// parseRoundSet parses -round-to-set into ascending, de-duplicated amounts.
+func parseRoundSet(raw string) ([]float64, error) {
+	var amounts []float64
+	for _, part := range strings.Split(raw, ",") {
+		value := strings.TrimSpace(part)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid round-to-set amount: %s", value)
+		}
+		if parsed <= 0 {
+			return nil, fmt.Errorf("round-to-set amounts must be > 0")
+		}
+		amounts = append(amounts, parsed)
+	}
+	sort.Float64s(amounts)
+	var unique []float64
+	for _, amount := range amounts {
+		if len(unique) == 0 || amount != unique[len(unique)-1] {
+			unique = append(unique, amount)
+		}
+	}
+	return unique, nil
+}
+
+// floorToIncrement rounds value down to a multiple of increment, so an award
+// never exceeds what the caps allowed. A small epsilon keeps exact multiples
+// such as 300 from flooring to 200 through float error.
+func floorToIncrement(value, increment float64) float64 {
+	if increment <= 0 {
+		return value
+	}
+	return math.Floor(value/increment+1e-9) * increment
+}
+
+// floorToAwardGrid rounds a scaled-down award to the nearest amount at or
+// below it that -round-to-set, -round, and -award-increment allow.
+func floorToAwardGrid(value float64, opts runOptions) float64 {
+	if len(opts.RoundSet) > 0 {
+		floored := 0.0
+		for _, amount := range opts.RoundSet {
+			if amount <= value+1e-9 {
+				floored = amount
+			}
+		}
+		value = floored
+	}
+	value = floorToIncrement(value, opts.RoundTo)
+	return floorToIncrement(value, opts.AwardIncrement)
+}
+
 func roundToIncrement(value, increment float64) float64 {
 	if increment <= 0 {
 		return value
@@ -672,7 +3920,7 @@ func roundToIncrement(value, increment float64) float64 {
 	return rounded
 }
 
-func summarize(applicants []*applicant, budget float64, awarded []*applicant) allocationSummary {
+func summarize(applicants []*applicant, budget float64, awarded []*applicant, groupBy string) allocationSummary {
 	byNeed := map[string]needAgg{
 		"low":    {},
 		"medium": {},
@@ -694,6 +3942,7 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 	var maxAward float64
 	ineligibleReasons := make(map[string]int)
 	var ineligibleCount int
+	var declinedCount int
 	var eligibleCount int
 	var unfundedCount int
 	var unfundedAmount float64
@@ -702,10 +3951,23 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 	var partiallyFundedCount int
 	var awardAmounts []float64
 	var awardRates []float64
+	var requestAmounts []float64
 	var lastFundedPriority float64
 	var lastFundedScore float64
 	var lastFundedNeed string
 	var lastFundedRequested float64
+	var firstUnfunded *applicant
+	var requestCapAmount float64
+	var requestCappedCount int
+	var sweptAmount float64
+	var sweptCount int
+	var topupAmount float64
+	var topupCount int
+	var stretchShave float64
+	var stretchAdded int
+	constraints := make(map[string]int)
+	var maxCappedCount int
+	var maxCappedTrimmed float64
 	if len(awarded) > 0 {
 		minAward = awarded[0].Awarded
 		maxAward = awarded[0].Awarded
@@ -717,6 +3979,10 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 	}
 
 	for _, item := range applicants {
+		if item.Declined {
+			declinedCount++
+			continue
+		}
 		if !item.Eligible {
 			ineligibleCount++
 			if item.EligibilityMsg != "" {
@@ -726,6 +3992,11 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 		}
 		eligibleCount++
 		eligibleRequestedTotal += item.Requested
+		requestAmounts = append(requestAmounts, item.Requested)
+		if basis := awardBasis(item); basis < unmetNeed(item) {
+			requestCappedCount++
+			requestCapAmount = basis
+		}
 		coverage := needCoverage[item.NeedLevel]
 		coverage.EligibleCount++
 		coverage.RequestedTotal += item.Requested
@@ -742,9 +4013,12 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 			unfundedByNeed[item.NeedLevel] = agg
 			coverage.UnfundedCount++
 			needCoverage[item.NeedLevel] = coverage
+			if firstUnfunded == nil || item.PriorityScore > firstUnfunded.PriorityScore {
+				firstUnfunded = item
+			}
 			continue
 		}
-		if item.Awarded >= item.Requested {
+		if item.Awarded >= unmetNeed(item) {
 			fullyFundedCount++
 		} else {
 			partiallyFundedCount++
@@ -752,8 +4026,29 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 		needCoverage[item.NeedLevel] = coverage
 	}
 
+	var totalEffective float64
 	for _, item := range awarded {
 		budgetUsed += item.Awarded
+		totalEffective += effectiveAwarded(item)
+		if item.Swept > 0 {
+			sweptAmount += item.Swept
+			sweptCount++
+		}
+		if item.ToppedUp > 0 {
+			topupAmount += item.ToppedUp
+			topupCount++
+		}
+		stretchShave = math.Max(stretchShave, item.StretchShave)
+		if item.StretchAdded {
+			stretchAdded++
+		}
+		if item.Constraint != "" {
+			constraints[item.Constraint]++
+		}
+		if item.Constraint == constraintMaxAward {
+			maxCappedCount++
+			maxCappedTrimmed += unmetNeed(item) - item.Awarded
+		}
 		awardAmounts = append(awardAmounts, item.Awarded)
 		if item.Requested > 0 {
 			awardRates = append(awardRates, item.Awarded/item.Requested)
@@ -771,10 +4066,20 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 		byNeed[item.NeedLevel] = agg
 	}
 
+	var firstUnfundedPriority, firstUnfundedScore, firstUnfundedRequested float64
+	var firstUnfundedNeed string
+	if firstUnfunded != nil {
+		firstUnfundedPriority = firstUnfunded.PriorityScore
+		firstUnfundedScore = firstUnfunded.ScoreRaw
+		firstUnfundedNeed = firstUnfunded.NeedLevel
+		firstUnfundedRequested = firstUnfunded.Requested
+	}
+
 	for level, coverage := range needCoverage {
 		if coverage.RequestedTotal > 0 {
 			coverage.CoverageRate = coverage.AwardedTotal / coverage.RequestedTotal
 		}
+		coverage.FundingGap = math.Max(coverage.RequestedTotal-coverage.AwardedTotal, 0)
 		needCoverage[level] = coverage
 	}
 
@@ -814,10 +4119,21 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 	awardP75 := percentile(awardAmounts, 0.75)
 	awardToRequestAvg := averageFloat(awardRates)
 
+	var byGroup map[string]needCoverageAgg
+	if groupBy != "" {
+		byGroup = groupCoverage(applicants, func(item *applicant) string {
+			return columnValue(item, groupBy)
+		})
+	}
+
+	generatedTime := time.Now().UTC()
+
 	return allocationSummary{
-		GeneratedAt:             time.Now().Format(time.RFC3339),
+		GeneratedAt:             generatedTime.Format(time.RFC3339),
+		GeneratedTime:           generatedTime,
 		Budget:                  budget,
 		BudgetUsed:              budgetUsed,
+		TotalEffectiveAwarded:   totalEffective,
 		BudgetLeft:              budget - budgetUsed,
 		BudgetRequiredFull:      eligibleRequestedTotal,
 		BudgetShortfall:         budgetShortfall,
@@ -825,12 +4141,14 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 		EligibleCount:           eligibleCount,
 		AwardedCount:            len(awarded),
 		IneligibleCount:         ineligibleCount,
+		DeclinedCount:           declinedCount,
 		EligibleUnfundedCount:   unfundedCount,
 		EligibleUnfundedAmount:  unfundedAmount,
 		EligibleRequestedTotal:  eligibleRequestedTotal,
 		FullyFundedCount:        fullyFundedCount,
 		PartiallyFundedCount:    partiallyFundedCount,
 		FundingGapTotal:         fundingGapTotal,
+		GapClosedPerDollar:      gapClosedPerDollar(eligibleRequestedTotal, fundingGapTotal, budget),
 		CoverageRate:            coverageRate,
 		FullFundingRate:         fullFundingRate,
 		AverageAward:            averageAward,
@@ -838,54 +4156,554 @@ func summarize(applicants []*applicant, budget float64, awarded []*applicant) al
 		AwardP50:                awardP50,
 		AwardP75:                awardP75,
 		AwardToRequestAvg:       awardToRequestAvg,
+		RequestedTotal:          eligibleRequestedTotal,
+		RequestedMean:           averageFloat(requestAmounts),
+		RequestedP25:            percentile(requestAmounts, 0.25),
+		RequestedP50:            percentile(requestAmounts, 0.50),
+		RequestedP75:            percentile(requestAmounts, 0.75),
 		MinAwarded:              minAward,
 		MaxAwarded:              maxAward,
 		LastFundedPriority:      lastFundedPriority,
 		LastFundedScore:         lastFundedScore,
 		LastFundedNeed:          lastFundedNeed,
 		LastFundedRequested:     lastFundedRequested,
+		FirstUnfundedPriority:   firstUnfundedPriority,
+		FirstUnfundedScore:      firstUnfundedScore,
+		FirstUnfundedNeed:       firstUnfundedNeed,
+		FirstUnfundedRequested:  firstUnfundedRequested,
+		Boundary:                buildBoundaryRecords(applicants, awarded),
+		RequestCapAmount:        requestCapAmount,
+		RequestCappedCount:      requestCappedCount,
+		MaxCappedCount:          maxCappedCount,
+		MaxCappedTrimmed:        maxCappedTrimmed,
+		SweptAmount:             sweptAmount,
+		SweptCount:              sweptCount,
+		TopupAmount:             topupAmount,
+		TopupCount:              topupCount,
+		StretchShave:            stretchShave,
+		StretchAddedCount:       stretchAdded,
 		ByNeed:                  byNeed,
+		GroupBy:                 groupBy,
+		ByGroup:                 byGroup,
 		NeedCoverage:            needCoverage,
 		UnfundedByNeed:          unfundedByNeed,
 		IneligibleReasonSummary: ineligibleReasons,
-		Awards:                  buildAwardRecords(awarded),
-		Unfunded:                buildUnfundedRecords(applicants),
+		ConstraintSummary:       constraints,
+		PassBreakdown:           buildPassBreakdown(awarded),
+		Awards:                  buildAwardRecords(awarded, lastFundedPriority),
+		Unfunded:                buildUnfundedRecords(applicants, lastFundedPriority),
 		Ineligible:              buildIneligibleRecords(applicants),
+		ResultHash:              resultHash(awarded),
+	}
+}
+
+// resultHash is a SHA-256 over one "id,amount" line per award, sorted, with
+// amounts at two decimals. It ignores timestamps and award order so identical
+// allocations always hash the same.
+func resultHash(awarded []*applicant) string {
+	lines := make([]string, 0, len(awarded))
+	for _, item := range awarded {
+		lines = append(lines, fmt.Sprintf("%s,%s\n", item.ID, formatFloat(item.Awarded, 2)))
+	}
+	sort.Strings(lines)
+	hasher := sha256.New()
+	for _, line := range lines {
+		io.WriteString(hasher, line)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// applyAllApplicantRates adds coverage and full-funding rates whose
+// denominators include ineligible applicants, leaving the eligible-only rates
+// untouched.
+func applyAllApplicantRates(summary *allocationSummary, applicants []*applicant) {
+	var requestedTotal float64
+	for _, item := range applicants {
+		requestedTotal += item.Requested
+	}
+	summary.IncludesIneligibleRates = true
+	summary.AllRequestedTotal = requestedTotal
+	summary.CoverageRateAll = 0
+	if requestedTotal > 0 {
+		summary.CoverageRateAll = summary.BudgetUsed / requestedTotal
+	}
+	summary.FullFundingRateAll = 0
+	if summary.Applicants > 0 {
+		summary.FullFundingRateAll = float64(summary.FullyFundedCount) / float64(summary.Applicants)
+	}
+}
+
+func groupCoverage(applicants []*applicant, key func(*applicant) string) map[string]needCoverageAgg {
+	groups := make(map[string]needCoverageAgg)
+	var requestedTotal float64
+	var awardedTotal float64
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		group := key(item)
+		if group == "" {
+			group = "unspecified"
+		}
+		agg := groups[group]
+		agg.EligibleCount++
+		agg.RequestedTotal += item.Requested
+		requestedTotal += item.Requested
+		if item.Awarded > 0 {
+			agg.AwardedCount++
+			agg.AwardedTotal += item.Awarded
+			awardedTotal += item.Awarded
+		} else {
+			agg.UnfundedCount++
+		}
+		groups[group] = agg
+	}
+	for group, agg := range groups {
+		if agg.RequestedTotal > 0 {
+			agg.CoverageRate = agg.AwardedTotal / agg.RequestedTotal
+		}
+		agg.FundingGap = math.Max(agg.RequestedTotal-agg.AwardedTotal, 0)
+		if requestedTotal > 0 {
+			agg.RequestedShare = agg.RequestedTotal / requestedTotal
+		}
+		if awardedTotal > 0 {
+			agg.AwardedShare = agg.AwardedTotal / awardedTotal
+		}
+		agg.ShareDelta = agg.AwardedShare - agg.RequestedShare
+		groups[group] = agg
+	}
+	return groups
+}
+
+func programOf(item *applicant) string {
+	return strings.ToLower(strings.TrimSpace(item.Extras["program"]))
+}
+
+func parseProgramBudgets(raw string) (map[string]float64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	budgets := make(map[string]float64)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid program budget: %s (expected program=amount)", part)
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid program budget: %s", part)
+		}
+		if parsed <= 0 {
+			return nil, fmt.Errorf("program budgets must be > 0")
+		}
+		budgets[name] = parsed
+	}
+	return budgets, nil
+}
+
+func parseRepresentRules(raw string) ([]representRule, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var rules []representRule
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		match, count, ok := strings.Cut(part, "=")
+		column, value, hasValue := strings.Cut(match, ":")
+		column = strings.ToLower(strings.TrimSpace(column))
+		value = strings.TrimSpace(value)
+		if !ok || !hasValue || column == "" || value == "" {
+			return nil, fmt.Errorf("invalid min-represent rule: %s (expected column:value=count)", part)
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid min-represent count: %s (must be a whole number > 0)", part)
+		}
+		rules = append(rules, representRule{Column: column, Value: value, Count: parsed})
+	}
+	return rules, nil
+}
+
+func summarizeRepresentation(applicants []*applicant, rules []representRule) []representResult {
+	var results []representResult
+	for _, rule := range rules {
+		result := representResult{Column: rule.Column, Value: rule.Value, Target: rule.Count}
+		for _, item := range applicants {
+			if !item.Eligible || !rule.matches(item) {
+				continue
+			}
+			result.EligibleCount++
+			if item.Awarded > 0 {
+				result.AwardedCount++
+				result.AwardedTotal += item.Awarded
+			}
+		}
+		result.Met = result.AwardedCount >= rule.Count
+		results = append(results, result)
+	}
+	return results
+}
+
+func unbudgetedProgramWarnings(applicants []*applicant, budgets map[string]float64) []string {
+	if len(budgets) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		program := programOf(item)
+		if _, ok := budgets[program]; !ok {
+			counts[program]++
+		}
+	}
+	var warnings []string
+	for _, program := range slices.Sorted(maps.Keys(counts)) {
+		label := program
+		if label == "" {
+			label = "(blank)"
+		}
+		warnings = append(warnings, fmt.Sprintf("program %s has no budget; %d eligible applicants left unfunded", label, counts[program]))
+	}
+	return warnings
+}
+
+func summarizePrograms(applicants []*applicant, budgets map[string]float64) map[string]programAgg {
+	return summarizeBudgetGroups(applicants, budgets, programOf)
+}
+
+// summarizeNeedBudgets reports each need level's own budget, used, and left
+// when -budget-<level> flags partition the allocation.
+func summarizeNeedBudgets(applicants []*applicant, budget float64, opts runOptions) map[string]programAgg {
+	if !hasNeedBudgets(opts) {
+		return nil
+	}
+	return summarizeBudgetGroups(applicants, needBudgets(budget, opts), func(item *applicant) string {
+		return item.NeedLevel
+	})
+}
+
+// summarizeBudgetGroups totals eligible applicants against independent
+// budgets keyed by group.
+func summarizeBudgetGroups(applicants []*applicant, budgets map[string]float64, groupOf func(*applicant) string) map[string]programAgg {
+	if len(budgets) == 0 {
+		return nil
+	}
+	programs := make(map[string]programAgg)
+	for program, amount := range budgets {
+		programs[program] = programAgg{Budget: amount}
+	}
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		program := groupOf(item)
+		if program == "" {
+			program = "unspecified"
+		}
+		agg := programs[program]
+		agg.EligibleCount++
+		agg.RequestedTotal += item.Requested
+		if item.Awarded > 0 {
+			agg.AwardedCount++
+			agg.BudgetUsed += item.Awarded
+		} else {
+			agg.UnfundedCount++
+		}
+		programs[program] = agg
+	}
+	for program, agg := range programs {
+		agg.BudgetLeft = agg.Budget - agg.BudgetUsed
+		if agg.RequestedTotal > 0 {
+			agg.CoverageRate = agg.BudgetUsed / agg.RequestedTotal
+		}
+		programs[program] = agg
+	}
+	return programs
+}
+
+// parseBudgetList parses -scenario-budgets. Unlike -budget, a zero budget is
+// allowed so the scenario table can include the no-funding baseline.
+func parseBudgetList(raw string) ([]float64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ",")
+	var budgets []float64
+	for _, part := range parts {
+		value := strings.TrimSpace(part)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || !isFinite(parsed) {
+			return nil, fmt.Errorf("invalid scenario budget: %s", value)
+		}
+		if parsed < 0 {
+			return nil, fmt.Errorf("scenario budgets must be >= 0")
+		}
+		budgets = append(budgets, parsed)
+	}
+	return budgets, nil
+}
+
+func buildScenarioResults(applicants []*applicant, budgets []float64, opts runOptions) []scenarioResult {
+	cache := newScenarioCache(applicants, opts)
+	results := make([]scenarioResult, 0, len(budgets))
+	for _, budget := range budgets {
+		results = append(results, cache.result(cache.params(budget)))
+	}
+	return results
+}
+
+// scenarioParams identifies one scenario configuration: the budget and the
+// effective priority weights it is allocated under.
+type scenarioParams struct {
+	Budget        float64
+	ScoreWeight   float64
+	NeedWeight    float64
+	RequestWeight float64
+}
+
+// scenarioCache memoizes scenario allocations over the prioritized
+// applicants, so parameter grids that repeat a configuration, or share
+// weights across budgets, do not re-prioritize and re-sort. It is safe for
+// concurrent use; each configuration is computed once.
+type scenarioCache struct {
+	applicants []*applicant
+	opts       runOptions
+	mu         sync.Mutex
+	orders     map[scenarioParams]*scenarioOrder
+	results    map[scenarioParams]*scenarioEntry
+}
+
+type scenarioOrder struct {
+	once       sync.Once
+	applicants []*applicant
+}
+
+type scenarioEntry struct {
+	once   sync.Once
+	result scenarioResult
+}
+
+func newScenarioCache(applicants []*applicant, opts runOptions) *scenarioCache {
+	return &scenarioCache{
+		applicants: applicants,
+		opts:       opts,
+		orders:     make(map[scenarioParams]*scenarioOrder),
+		results:    make(map[scenarioParams]*scenarioEntry),
+	}
+}
+
+// params returns the configuration for budget under the run's own weights.
+func (c *scenarioCache) params(budget float64) scenarioParams {
+	score, need, request := effectiveWeights(c.opts)
+	return scenarioParams{Budget: budget, ScoreWeight: score, NeedWeight: need, RequestWeight: request}
+}
+
+// ordered returns the applicants prioritized and sorted under the weights in
+// params. The slice is shared, so callers must clone it before allocating.
+func (c *scenarioCache) ordered(params scenarioParams) []*applicant {
+	params.Budget = 0
+	c.mu.Lock()
+	entry, ok := c.orders[params]
+	if !ok {
+		entry = &scenarioOrder{}
+		c.orders[params] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		if base := c.params(0); params == base {
+			entry.applicants = c.applicants
+			return
+		}
+		opts := c.weighted(params)
+		entry.applicants = cloneApplicants(c.applicants)
+		assignPriority(entry.applicants, opts)
+		sortApplicants(entry.applicants, opts.Tiebreak)
+	})
+	return entry.applicants
+}
+
+// result allocates the configuration in params, reusing an earlier result
+// for the same configuration.
+func (c *scenarioCache) result(params scenarioParams) scenarioResult {
+	c.mu.Lock()
+	entry, ok := c.results[params]
+	if !ok {
+		entry = &scenarioEntry{}
+		c.results[params] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		clone := cloneApplicants(c.ordered(params))
+		awarded := allocateBudget(clone, params.Budget, c.weighted(params))
+		entry.result = summarizeScenario(clone, awarded, params.Budget)
+		entry.result.needCoverage = levelCoverage(clone)
+		for _, item := range clone {
+			if item.Awarded > 0 {
+				entry.result.fundedIDs = append(entry.result.fundedIDs, item.ID)
+			}
+		}
+	})
+	return entry.result
+}
+
+func (c *scenarioCache) weighted(params scenarioParams) runOptions {
+	opts := c.opts
+	opts.ScoreWeight = params.ScoreWeight
+	opts.NeedWeight = params.NeedWeight
+	opts.RequestWeight = params.RequestWeight
+	return opts
+}
+
+// buildScenarioSteps compares each scenario with the one before it in the
+// list and returns the applicants it newly funds, in priority order.
+func buildScenarioSteps(results []scenarioResult) []scenarioStep {
+	var steps []scenarioStep
+	for i := 1; i < len(results); i++ {
+		previous := make(map[string]bool, len(results[i-1].fundedIDs))
+		for _, id := range results[i-1].fundedIDs {
+			previous[id] = true
+		}
+		step := scenarioStep{FromBudget: results[i-1].Budget, ToBudget: results[i].Budget, NewlyFundedIDs: []string{}}
+		for _, id := range results[i].fundedIDs {
+			if !previous[id] {
+				step.NewlyFundedIDs = append(step.NewlyFundedIDs, id)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// buildShadowComparison pairs the actual allocation with a one-off scenario
+// at the shadow budget.
+func buildShadowComparison(applicants []*applicant, awarded []*applicant, budget, shadowBudget float64, opts runOptions) *shadowComparison {
+	actual := summarizeScenario(applicants, awarded, budget)
+	shadow := scenarioCoverage(applicants, shadowBudget, opts)
+	return &shadowComparison{
+		Actual:           actual,
+		Shadow:           shadow,
+		AdditionalFunded: shadow.AwardedCount - actual.AwardedCount,
+	}
+}
+
+// buildWithdrawal allocates the budget with and without the named applicant
+// and reports who moves up when they withdraw. Priorities are kept as scored,
+// so only the freed money changes the outcome.
+func buildWithdrawal(applicants []*applicant, id string, budget float64, opts runOptions) (*withdrawalImpact, error) {
+	var withdrawn *applicant
+	var remaining []*applicant
+	for _, item := range applicants {
+		if item.ID == id && withdrawn == nil {
+			withdrawn = item
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	if withdrawn == nil {
+		return nil, fmt.Errorf("withdraw-id %q not found in input", id)
 	}
-}
 
-func parseBudgetList(raw string) ([]float64, error) {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return nil, nil
+	before := cloneApplicants(applicants)
+	allocateBudget(before, budget, opts)
+	after := cloneApplicants(remaining)
+	allocateBudget(after, budget, opts)
+
+	impact := &withdrawalImpact{ApplicantID: withdrawn.ID, Name: withdrawn.Name, Gains: []withdrawalGain{}}
+	previous := make(map[string]float64, len(before))
+	for _, item := range before {
+		if item.ID == withdrawn.ID {
+			impact.BudgetFreed = item.Awarded
+			continue
+		}
+		previous[item.ID] = item.Awarded
 	}
-	parts := strings.Split(raw, ",")
-	var budgets []float64
-	for _, part := range parts {
-		value := strings.TrimSpace(part)
-		if value == "" {
+	for _, item := range after {
+		if item.Awarded-previous[item.ID] <= invariantTolerance {
 			continue
 		}
-		parsed, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid scenario budget: %s", value)
+		impact.Gains = append(impact.Gains, withdrawalGain{
+			ApplicantID: item.ID,
+			Name:        item.Name,
+			Before:      previous[item.ID],
+			After:       item.Awarded,
+			NewlyFunded: previous[item.ID] <= 0,
+		})
+	}
+	return impact, nil
+}
+
+// buildCoverageLadder finds the minimum budget that reaches each 10% coverage
+// step. Steps above the coverage reachable with unlimited budget (bounded by
+// award caps) are reported as unreachable.
+func buildCoverageLadder(applicants []*applicant, opts runOptions) []ladderStep {
+	var requestedTotal float64
+	for _, item := range applicants {
+		if item.Eligible {
+			requestedTotal += item.Requested
 		}
-		if parsed <= 0 {
-			return nil, fmt.Errorf("scenario budgets must be > 0")
+	}
+	if requestedTotal <= 0 {
+		return nil
+	}
+	maxCoverage := scenarioCoverage(applicants, requestedTotal, opts).CoverageRate
+
+	var steps []ladderStep
+	var previous float64
+	for step := 1; step <= 10; step++ {
+		target := float64(step) / 10
+		entry := ladderStep{TargetCoverage: target}
+		if target <= maxCoverage+1e-9 {
+			budget := minBudgetForCoverage(applicants, target, requestedTotal, opts)
+			result := scenarioCoverage(applicants, budget, opts)
+			entry.Reachable = true
+			entry.Budget = budget
+			entry.MarginalBudget = budget - previous
+			entry.CoverageRate = result.CoverageRate
+			entry.AwardedCount = result.AwardedCount
+			previous = budget
 		}
-		budgets = append(budgets, parsed)
+		steps = append(steps, entry)
 	}
-	return budgets, nil
+	return steps
 }
 
-func buildScenarioResults(applicants []*applicant, budgets []float64, minAward, maxAward float64, caps needAwardCaps, reserveHigh, reserveMedium, reserveLow, roundTo, maxPercent float64) []scenarioResult {
-	results := make([]scenarioResult, 0, len(budgets))
-	for _, budget := range budgets {
-		clone := cloneApplicants(applicants)
-		awarded := allocateBudget(clone, budget, minAward, maxAward, caps, reserveHigh, reserveMedium, reserveLow, roundTo, maxPercent)
-		results = append(results, summarizeScenario(clone, awarded, budget))
+// minBudgetForCoverage binary searches budgets up to maxBudget for the
+// smallest one (to the cent) whose allocation reaches the target coverage.
+func minBudgetForCoverage(applicants []*applicant, target, maxBudget float64, opts runOptions) float64 {
+	low, high := int64(0), int64(math.Ceil(maxBudget*100))
+	for low < high {
+		mid := (low + high) / 2
+		if scenarioCoverage(applicants, float64(mid)/100, opts).CoverageRate+1e-9 >= target {
+			high = mid
+		} else {
+			low = mid + 1
+		}
 	}
-	return results
+	return float64(high) / 100
+}
+
+func scenarioCoverage(applicants []*applicant, budget float64, opts runOptions) scenarioResult {
+	clone := cloneApplicants(applicants)
+	awarded := allocateBudget(clone, budget, opts)
+	return summarizeScenario(clone, awarded, budget)
 }
 
 func cloneApplicants(applicants []*applicant) []*applicant {
@@ -893,6 +4711,11 @@ func cloneApplicants(applicants []*applicant) []*applicant {
 	for _, item := range applicants {
 		copyItem := *item
 		copyItem.Awarded = 0
+		copyItem.Swept = 0
+		copyItem.ToppedUp = 0
+		copyItem.StretchShave = 0
+		copyItem.StretchAdded = false
+		copyItem.Constraint = ""
 		clone = append(clone, &copyItem)
 	}
 	return clone
@@ -915,7 +4738,7 @@ func summarizeScenario(applicants []*applicant, awarded []*applicant, budget flo
 			unfundedCount++
 			continue
 		}
-		if item.Awarded >= item.Requested {
+		if item.Awarded >= unmetNeed(item) {
 			fullyFundedCount++
 		} else {
 			partiallyFundedCount++
@@ -961,10 +4784,68 @@ func summarizeScenario(applicants []*applicant, awarded []*applicant, budget flo
 	}
 }
 
-func buildAwardRecords(awarded []*applicant) []awardRecord {
+// buildAwardRecords lists funded applicants in allocation order. Each record's
+// margin is its priority minus the cutoff (last-funded) priority.
+func buildAwardRecords(awarded []*applicant, cutoff float64) []awardRecord {
 	records := make([]awardRecord, 0, len(awarded))
-	for _, item := range awarded {
+	for i, item := range awarded {
 		records = append(records, awardRecord{
+			Rank:        i + 1,
+			ApplicantID: item.ID,
+			OriginalID:  item.OriginalID,
+			SourceLine:  item.SourceLine,
+			Name:        item.Name,
+			NeedLevel:   item.NeedLevel,
+			Score:       item.ScoreRaw,
+			Requested:   item.Requested,
+			Awarded:     item.Awarded,
+			Effective:   effectiveAwarded(item),
+			Priority:    item.PriorityScore,
+			Margin:      item.PriorityScore - cutoff,
+			Constraint:  item.Constraint,
+		})
+	}
+	return records
+}
+
+// applyPriorityPrecision rounds the priority values carried by the summary so
+// JSON output matches the decimals shown in the console, CSV, and report.
+func applyPriorityPrecision(summary *allocationSummary, precision int) {
+	summary.PriorityPrecision = precision
+	scale := math.Pow(10, float64(precision))
+	round := func(value float64) float64 {
+		return math.Round(value*scale) / scale
+	}
+	summary.LastFundedPriority = round(summary.LastFundedPriority)
+	summary.FirstUnfundedPriority = round(summary.FirstUnfundedPriority)
+	for i := range summary.Awards {
+		summary.Awards[i].Priority = round(summary.Awards[i].Priority)
+		summary.Awards[i].Margin = round(summary.Awards[i].Priority - summary.LastFundedPriority)
+	}
+	for i := range summary.Unfunded {
+		summary.Unfunded[i].Priority = round(summary.Unfunded[i].Priority)
+		summary.Unfunded[i].Margin = round(summary.Unfunded[i].Priority - summary.LastFundedPriority)
+	}
+	for i := range summary.Boundary {
+		summary.Boundary[i].Priority = round(summary.Boundary[i].Priority)
+	}
+}
+
+// buildBoundaryRecords lists every eligible applicant whose priority equals
+// the last-funded priority, in allocation order. It returns nil unless at
+// least two applicants share that priority, since only then did tie-breaking
+// decide who was funded.
+func buildBoundaryRecords(applicants []*applicant, awarded []*applicant) []boundaryRecord {
+	if len(awarded) == 0 {
+		return nil
+	}
+	priority := awarded[len(awarded)-1].PriorityScore
+	var records []boundaryRecord
+	for _, item := range applicants {
+		if !item.Eligible || item.PriorityScore != priority {
+			continue
+		}
+		records = append(records, boundaryRecord{
 			ApplicantID: item.ID,
 			Name:        item.Name,
 			NeedLevel:   item.NeedLevel,
@@ -972,12 +4853,16 @@ func buildAwardRecords(awarded []*applicant) []awardRecord {
 			Requested:   item.Requested,
 			Awarded:     item.Awarded,
 			Priority:    item.PriorityScore,
+			Funded:      item.Awarded > 0,
 		})
 	}
+	if len(records) < 2 {
+		return nil
+	}
 	return records
 }
 
-func buildUnfundedRecords(applicants []*applicant) []awardRecord {
+func buildUnfundedRecords(applicants []*applicant, cutoff float64) []awardRecord {
 	var records []awardRecord
 	for _, item := range applicants {
 		if !item.Eligible || item.Awarded > 0 {
@@ -985,12 +4870,15 @@ func buildUnfundedRecords(applicants []*applicant) []awardRecord {
 		}
 		records = append(records, awardRecord{
 			ApplicantID: item.ID,
+			OriginalID:  item.OriginalID,
+			SourceLine:  item.SourceLine,
 			Name:        item.Name,
 			NeedLevel:   item.NeedLevel,
 			Score:       item.ScoreRaw,
 			Requested:   item.Requested,
 			Awarded:     item.Awarded,
 			Priority:    item.PriorityScore,
+			Margin:      item.PriorityScore - cutoff,
 		})
 	}
 	return records
@@ -999,11 +4887,13 @@ func buildUnfundedRecords(applicants []*applicant) []awardRecord {
 func buildIneligibleRecords(applicants []*applicant) []ineligibleRecord {
 	var records []ineligibleRecord
 	for _, item := range applicants {
-		if item.Eligible {
+		if item.Eligible || item.Declined {
 			continue
 		}
 		records = append(records, ineligibleRecord{
 			ApplicantID: item.ID,
+			OriginalID:  item.OriginalID,
+			SourceLine:  item.SourceLine,
 			Name:        item.Name,
 			NeedLevel:   item.NeedLevel,
 			Score:       item.ScoreRaw,
@@ -1014,6 +4904,317 @@ func buildIneligibleRecords(applicants []*applicant) []ineligibleRecord {
 	return records
 }
 
+// buildNearMisses returns the ineligible applicants whose only reason is a
+// score below the minimum and who fell within delta points of the threshold
+// that applied to them, highest score first.
+func buildNearMisses(records []ineligibleRecord, delta, minScore float64, tiers needMinScores) []nearMissRecord {
+	if delta <= 0 {
+		return nil
+	}
+	var misses []nearMissRecord
+	for _, record := range records {
+		if !strings.HasPrefix(record.Reason, "score below ") || strings.Contains(record.Reason, "; ") {
+			continue
+		}
+		threshold, _ := tiers.forNeed(record.NeedLevel, minScore)
+		belowBy := threshold - record.Score
+		if belowBy <= 0 || belowBy > delta {
+			continue
+		}
+		misses = append(misses, nearMissRecord{ineligibleRecord: record, Threshold: threshold, BelowBy: belowBy})
+	}
+	sort.SliceStable(misses, func(i, j int) bool {
+		if misses[i].Score != misses[j].Score {
+			return misses[i].Score > misses[j].Score
+		}
+		return misses[i].ApplicantID < misses[j].ApplicantID
+	})
+	return misses
+}
+
+const cutoffCandidateCount = 3
+
+// buildAppeal gathers the decision inputs for one applicant after allocation.
+// The applicant must have survived parsing; rows dropped with a warning
+// cannot be found.
+func buildAppeal(applicants []*applicant, id string, summary allocationSummary, opts runOptions) (appealDocument, error) {
+	id = optionIDNormalization(opts).apply(id)
+	var item *applicant
+	for _, candidate := range applicants {
+		if candidate.ID == id {
+			item = candidate
+			break
+		}
+	}
+	if item == nil {
+		return appealDocument{}, fmt.Errorf("appeal-export: applicant %s not found among loaded applicants", id)
+	}
+	totalWeight := opts.ScoreWeight + opts.NeedWeight + opts.RequestWeight
+	doc := appealDocument{
+		GeneratedAt: summary.GeneratedAt,
+		Applicant:   item,
+		ScoreMaxRef: opts.ScoreMaxRef,
+		ScoreTerm:   opts.ScoreWeight * item.ScoreNorm / totalWeight,
+		NeedTerm:    opts.NeedWeight * applicantNeedScore(item) / totalWeight,
+		RequestTerm: opts.RequestWeight * item.RequestNorm / totalWeight,
+		Cutoff:      summary.LastFundedPriority,
+		BudgetLeft:  summary.BudgetLeft,
+	}
+	if item.Eligible && item.Awarded == 0 {
+		doc.PlannedAward, _ = plannedAward(item, opts)
+	}
+	params, err := appealParameters(opts)
+	if err != nil {
+		return appealDocument{}, err
+	}
+	doc.Parameters = params
+	return doc, nil
+}
+
+// appealParameters lists every run option that is set, by its JSON name, so
+// the record matches what a manifest would reproduce.
+func appealParameters(opts runOptions) ([]appealParameter, error) {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("appeal-export: encode parameters: %w", err)
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("appeal-export: decode parameters: %w", err)
+	}
+	params := make([]appealParameter, 0, len(values))
+	for name, value := range values {
+		encoded, _ := json.Marshal(value)
+		params = append(params, appealParameter{Name: name, Value: string(encoded)})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name < params[j].Name
+	})
+	return params, nil
+}
+
+// writeAppealDocument renders an appeal record as Markdown.
+func writeAppealDocument(out io.Writer, doc appealDocument, precision int, anonymize bool) error {
+	item := doc.Applicant
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Award Decision: %s\n\n", formatApplicantLabel(item.ID, item.Name, anonymize))
+	if doc.GeneratedAt != "" {
+		fmt.Fprintf(&buf, "Generated: %s\n", doc.GeneratedAt)
+	}
+
+	fmt.Fprintln(&buf, "\n## Inputs")
+	fmt.Fprintf(&buf, "- Need level: %s\n", strings.Title(item.NeedLevel))
+	fmt.Fprintf(&buf, "- Raw score: %.1f\n", item.ScoreRaw)
+	if doc.ScoreMaxRef > 0 {
+		fmt.Fprintf(&buf, "- Normalized score: %.4f (score / reference maximum %.1f)\n", item.ScoreNorm, doc.ScoreMaxRef)
+	} else {
+		fmt.Fprintf(&buf, "- Normalized score: %.4f (score / highest score in the run)\n", item.ScoreNorm)
+	}
+	fmt.Fprintf(&buf, "- Requested: %s\n", formatCurrency(item.Requested))
+	if item.OtherAid > 0 {
+		fmt.Fprintf(&buf, "- Other aid: %s (unmet need %s)\n", formatCurrency(item.OtherAid), formatCurrency(unmetNeed(item)))
+	}
+	fmt.Fprintf(&buf, "- Score contribution: %.4f\n", doc.ScoreTerm)
+	fmt.Fprintf(&buf, "- Need contribution: %.4f\n", doc.NeedTerm)
+	if doc.RequestTerm != 0 {
+		fmt.Fprintf(&buf, "- Request contribution: %.4f\n", doc.RequestTerm)
+	}
+	if item.Rank > 0 {
+		fmt.Fprintf(&buf, "- External rank: %d (normalized %.4f)\n", item.Rank, item.RankNorm)
+	}
+	fmt.Fprintf(&buf, "- Priority: %s\n", formatFloat(item.PriorityScore, precision))
+
+	fmt.Fprintln(&buf, "\n## Outcome")
+	switch {
+	case item.Declined:
+		fmt.Fprintln(&buf, "- Declined the award offer")
+	case !item.Eligible:
+		fmt.Fprintf(&buf, "- Ineligible: %s\n", item.EligibilityMsg)
+	case item.Awarded > 0:
+		fmt.Fprintf(&buf, "- Awarded: %s\n", formatCurrency(item.Awarded))
+		if item.Constraint != "" {
+			fmt.Fprintf(&buf, "- Binding constraint: %s\n", item.Constraint)
+		}
+		fmt.Fprintf(&buf, "- Margin above the last-funded priority (%s): %s\n",
+			formatFloat(doc.Cutoff, precision), formatFloat(item.PriorityScore-doc.Cutoff, precision))
+	default:
+		fmt.Fprintln(&buf, "- Not funded")
+		fmt.Fprintf(&buf, "- Last-funded priority (cutoff): %s\n", formatFloat(doc.Cutoff, precision))
+		fmt.Fprintf(&buf, "- Priority below the cutoff by: %s\n", formatFloat(doc.Cutoff-item.PriorityScore, precision))
+		fmt.Fprintf(&buf, "- Planned award if funded: %s (budget left: %s)\n", formatCurrency(doc.PlannedAward), formatCurrency(doc.BudgetLeft))
+	}
+
+	fmt.Fprintln(&buf, "\n## Parameters")
+	for _, param := range doc.Parameters {
+		fmt.Fprintf(&buf, "- %s: %s\n", param.Name, param.Value)
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to write appeal record: %w", err)
+	}
+	return nil
+}
+
+func writeAppeal(path string, doc appealDocument, precision int, anonymize bool) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		return writeAppealDocument(out, doc, precision, anonymize)
+	})
+}
+
+// buildCutoffExplanation describes the funding boundary from the priority
+// sorted applicants: the lowest-priority funded applicant and the next
+// unfunded eligible ones. AdditionalToFund is the extra budget needed to fund
+// every listed applicant up to and including that one at their planned award.
+func buildCutoffExplanation(applicants []*applicant, budgetLeft float64, opts runOptions, count int) cutoffExplanation {
+	explanation := cutoffExplanation{BudgetLeft: budgetLeft}
+	var needed float64
+	for _, item := range applicants {
+		if !item.Eligible {
+			continue
+		}
+		if item.Awarded > 0 {
+			explanation.LastFunded = item
+			continue
+		}
+		if len(explanation.Next) >= count {
+			continue
+		}
+		award, _ := plannedAward(item, opts)
+		if award <= 0 {
+			continue
+		}
+		needed += award
+		explanation.Next = append(explanation.Next, cutoffCandidate{
+			Applicant:        item,
+			PlannedAward:     award,
+			AdditionalToFund: math.Max(0, needed-budgetLeft),
+		})
+	}
+	return explanation
+}
+
+func printCutoffExplanation(explanation cutoffExplanation, precision int, anonymize bool) {
+	fmt.Println("\nFunding Cutoff")
+	fmt.Println(strings.Repeat("-", 14))
+	describe := func(item *applicant) string {
+		return fmt.Sprintf("%s | Need: %s | Score: %.1f | Requested: $%.2f | Priority: %s",
+			formatApplicantLabel(item.ID, item.Name, anonymize),
+			strings.Title(item.NeedLevel),
+			item.ScoreRaw,
+			item.Requested,
+			formatFloat(item.PriorityScore, precision),
+		)
+	}
+	if explanation.LastFunded != nil {
+		fmt.Printf("Last funded: %s | Awarded: $%.2f\n", describe(explanation.LastFunded), explanation.LastFunded.Awarded)
+	} else {
+		fmt.Println("Last funded: none")
+	}
+	fmt.Printf("Budget left: $%.2f\n", explanation.BudgetLeft)
+	if len(explanation.Next) == 0 {
+		fmt.Println("No eligible unfunded applicants.")
+		return
+	}
+	fmt.Println("Next unfunded:")
+	for i, candidate := range explanation.Next {
+		fmt.Printf("%d. %s | Planned award: $%.2f | Additional budget to fund: $%.2f\n",
+			i+1,
+			describe(candidate.Applicant),
+			candidate.PlannedAward,
+			candidate.AdditionalToFund,
+		)
+	}
+}
+
+func printPriorityBreakdown(applicants []*applicant, opts runOptions, topN int, showAll bool) {
+	if len(applicants) == 0 {
+		return
+	}
+	fmt.Println("Priority Breakdown")
+	fmt.Println(strings.Repeat("-", 18))
+	limit := len(applicants)
+	if !showAll && topN > 0 && topN < limit {
+		limit = topN
+	}
+	totalWeight := opts.ScoreWeight + opts.NeedWeight + opts.RequestWeight
+	for i := 0; i < limit; i++ {
+		item := applicants[i]
+		factor := efficiencyFactor(item, opts)
+		need := opts.NeedWeight * applicantNeedScore(item)
+		base := (opts.ScoreWeight*item.ScoreNorm + need + opts.RequestWeight*item.RequestNorm) / totalWeight
+		if opts.RequestWeight > 0 {
+			fmt.Printf("%d. %s | score %.1f -> %.3f | need %s -> %.2f | request $%.2f -> %.3f | (%.2f x %.3f + %.2f x %.2f + %.2f x %.3f) / %.2f = %.4f\n",
+				i+1,
+				item.ID,
+				item.ScoreRaw,
+				item.ScoreNorm,
+				item.NeedLevel,
+				applicantNeedScore(item),
+				unmetNeed(item),
+				item.RequestNorm,
+				opts.ScoreWeight,
+				item.ScoreNorm,
+				opts.NeedWeight,
+				applicantNeedScore(item),
+				opts.RequestWeight,
+				item.RequestNorm,
+				totalWeight,
+				base,
+			)
+			printEfficiencyStep(factor, opts, base*factor)
+			printRepeatPenaltyStep(item, opts)
+			printRankStep(item, opts)
+			continue
+		}
+		fmt.Printf("%d. %s | score %.1f -> %.3f | need %s -> %.2f | (%.2f x %.3f + %.2f x %.2f) / %.2f = %.4f\n",
+			i+1,
+			item.ID,
+			item.ScoreRaw,
+			item.ScoreNorm,
+			item.NeedLevel,
+			applicantNeedScore(item),
+			opts.ScoreWeight,
+			item.ScoreNorm,
+			opts.NeedWeight,
+			applicantNeedScore(item),
+			totalWeight,
+			base,
+		)
+		printEfficiencyStep(factor, opts, base*factor)
+		printRepeatPenaltyStep(item, opts)
+		printRankStep(item, opts)
+	}
+	if limit < len(applicants) {
+		fmt.Printf("... %d more\n", len(applicants)-limit)
+	}
+	fmt.Println()
+}
+
+func printEfficiencyStep(factor float64, opts runOptions, priority float64) {
+	if opts.EfficiencyBias <= 0 {
+		return
+	}
+	fmt.Printf("   x efficiency %.3f (bias %.2f) = %.4f\n", factor, opts.EfficiencyBias, priority)
+}
+
+func printRepeatPenaltyStep(item *applicant, opts runOptions) {
+	if opts.RepeatPenalty <= 0 || item.PriorAwards == 0 {
+		return
+	}
+	fmt.Printf("   - repeat penalty %.3f x %d prior awards = %.4f\n", opts.RepeatPenalty, item.PriorAwards, computedPriority(item, opts))
+}
+
+// printRankStep shows how an external rank replaced or was blended into the
+// computed priority.
+func printRankStep(item *applicant, opts runOptions) {
+	switch prioritySourceOrDefault(opts.PrioritySource) {
+	case prioritySourceExternal:
+		fmt.Printf("   - external rank %d -> %.3f replaces the computed priority = %.4f\n", item.Rank, item.RankNorm, item.PriorityScore)
+	case prioritySourceBlend:
+		fmt.Printf("   - blend (1 - %.2f) x %.4f + %.2f x rank %d -> %.3f = %.4f\n",
+			opts.RankWeight, computedPriority(item, opts), opts.RankWeight, item.Rank, item.RankNorm, item.PriorityScore)
+	}
+}
+
 func printSummary(summary allocationSummary) {
 	fmt.Println("Award Allocation Summary")
 	fmt.Println(strings.Repeat("-", 26))
@@ -1021,29 +5222,101 @@ func printSummary(summary allocationSummary) {
 	fmt.Printf("Eligible:     %d\n", summary.EligibleCount)
 	fmt.Printf("Awarded:      %d\n", summary.AwardedCount)
 	fmt.Printf("Ineligible:   %d\n", summary.IneligibleCount)
+	if summary.DeclinedCount > 0 {
+		fmt.Printf("Declined:     %d\n", summary.DeclinedCount)
+	}
+	if summary.TermYears > 1 {
+		fmt.Printf("Term: %d years (amounts are %d-year totals)\n", summary.TermYears, summary.TermYears)
+		fmt.Printf("Annual Budget: $%.2f | Annual Used: $%.2f | Annual Eligible Requested: $%.2f\n",
+			summary.AnnualBudget, summary.AnnualBudgetUsed, summary.AnnualRequestedTotal)
+	}
 	fmt.Printf("Eligible Unfunded: %d ($%.2f requested)\n", summary.EligibleUnfundedCount, summary.EligibleUnfundedAmount)
 	fmt.Printf("Eligible Requested: $%.2f\n", summary.EligibleRequestedTotal)
 	fmt.Printf("Budget Required (Full Funding): $%.2f\n", summary.BudgetRequiredFull)
 	fmt.Printf("Budget Shortfall: $%.2f\n", summary.BudgetShortfall)
 	fmt.Printf("Coverage Rate: %.1f%%\n", summary.CoverageRate*100)
 	fmt.Printf("Fully Funded: %d (%.1f%% of eligible)\n", summary.FullyFundedCount, summary.FullFundingRate*100)
-	fmt.Printf("Partially Funded: %d\n", summary.PartiallyFundedCount)
+	if summary.IncludesIneligibleRates {
+		fmt.Printf("Coverage Rate (All Applicants): %.1f%%\n", summary.CoverageRateAll*100)
+		fmt.Printf("Fully Funded (All Applicants): %.1f%%\n", summary.FullFundingRateAll*100)
+	}
+	if summary.MaxPartial > 0 {
+		fmt.Printf("Partially Funded: %d (max %d)\n", summary.PartiallyFundedCount, summary.MaxPartial)
+	} else {
+		fmt.Printf("Partially Funded: %d\n", summary.PartiallyFundedCount)
+	}
 	fmt.Printf("Funding Gap:  $%.2f\n", summary.FundingGapTotal)
+	fmt.Printf("Gap Closed per Dollar: %.4f\n", summary.GapClosedPerDollar)
+	if summary.EffectiveBudgetNote != "" {
+		fmt.Printf("Effective Budget: $%.2f (%s)\n", summary.EffectiveBudget, summary.EffectiveBudgetNote)
+	}
 	fmt.Printf("Budget Used:  $%.2f\n", summary.BudgetUsed)
+	if summary.TotalEffectiveAwarded != summary.BudgetUsed {
+		fmt.Printf("Effective Awarded (with match): $%.2f\n", summary.TotalEffectiveAwarded)
+	}
 	fmt.Printf("Budget Left:  $%.2f\n", summary.BudgetLeft)
+	if summary.StrandedBudget > 0 {
+		fmt.Printf("Stranded Budget: $%.2f (below the minimum meaningful award)\n", summary.StrandedBudget)
+	}
 	fmt.Printf("Average Award $%.2f\n", summary.AverageAward)
 	fmt.Printf("Award Percentiles: P25 $%.2f | P50 $%.2f | P75 $%.2f\n", summary.AwardP25, summary.AwardP50, summary.AwardP75)
 	fmt.Printf("Avg Award/Request: %.1f%%\n", summary.AwardToRequestAvg*100)
 	fmt.Printf("Award Range:  $%.2f - $%.2f\n", summary.MinAwarded, summary.MaxAwarded)
+	fmt.Printf("Result Hash:  %s\n", summary.ResultHash)
 	if summary.AwardedCount > 0 {
-		fmt.Printf("Last Funded Cutoff: %.2f priority | %.1f score | %s need | $%.2f requested\n",
-			summary.LastFundedPriority,
+		fmt.Printf("Last Funded Cutoff: %s priority | %.1f score | %s need | $%.2f requested\n",
+			formatFloat(summary.LastFundedPriority, summary.PriorityPrecision),
 			summary.LastFundedScore,
 			strings.Title(summary.LastFundedNeed),
 			summary.LastFundedRequested,
 		)
 	}
-	printIneligibleReasons(summary.IneligibleReasonSummary)
+	if summary.EligibleUnfundedCount > 0 {
+		fmt.Printf("First Unfunded: %s priority | %.1f score | %s need | $%.2f requested\n",
+			formatFloat(summary.FirstUnfundedPriority, summary.PriorityPrecision),
+			summary.FirstUnfundedScore,
+			strings.Title(summary.FirstUnfundedNeed),
+			summary.FirstUnfundedRequested,
+		)
+	}
+	if summary.SweptCount > 0 {
+		fmt.Printf("Budget Sweep: $%.2f topped up across %d awards\n", summary.SweptAmount, summary.SweptCount)
+	}
+	if summary.TopupCount > 0 {
+		fmt.Printf("Leftover Top-up: $%.2f added across %d awards\n", summary.TopupAmount, summary.TopupCount)
+	}
+	if summary.StretchShave > 0 {
+		fmt.Printf("Stretch: awards shaved %.0f%% to fund %d more applicants\n", summary.StretchShave*100, summary.StretchAddedCount)
+	}
+	for _, entry := range summary.LevelCaps {
+		fmt.Printf("%s Need Cap: $%.2f of $%.2f used\n", strings.Title(entry.NeedLevel), entry.Used, entry.Cap)
+	}
+	for _, warning := range summary.LevelCapWarnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	if len(summary.PassBreakdown) > 0 {
+		parts := make([]string, 0, len(summary.PassBreakdown))
+		for _, pass := range summary.PassBreakdown {
+			parts = append(parts, fmt.Sprintf("%s $%.2f (%d)", pass.Name, pass.Spent, pass.Funded))
+		}
+		fmt.Printf("Allocation Passes: %s\n", strings.Join(parts, " | "))
+	}
+	if summary.FlagCapped && summary.MaxCappedCount > 0 {
+		fmt.Printf("Max-Capped: %d awards trimmed by the max award ($%.2f below unmet need)\n", summary.MaxCappedCount, summary.MaxCappedTrimmed)
+	}
+	if summary.RequestCappedCount > 0 {
+		fmt.Printf("Request Cap: %d requests capped at $%.2f for award computation\n", summary.RequestCappedCount, summary.RequestCapAmount)
+	}
+	if summary.MedianAwardCap > 0 {
+		fmt.Printf("Median Award Cap: $%.2f\n", summary.MedianAwardCap)
+	}
+	printIneligibleReasons(summary.IneligibleReasonSummary, summary.IneligibleReasonsTop)
+	printConstraintSummary(summary.ConstraintSummary, summary.AwardedCount)
+	fmt.Println("\nDemand (Eligible Requests)")
+	fmt.Println(strings.Repeat("-", 26))
+	fmt.Printf("Requested Total: $%.2f\n", summary.RequestedTotal)
+	fmt.Printf("Requested Mean:  $%.2f\n", summary.RequestedMean)
+	fmt.Printf("Request Percentiles: P25 $%.2f | P50 $%.2f | P75 $%.2f\n", summary.RequestedP25, summary.RequestedP50, summary.RequestedP75)
 	fmt.Println("\nBy Need Level")
 	fmt.Println(strings.Repeat("-", 13))
 	needKeys := []string{"high", "medium", "low"}
@@ -1054,6 +5327,142 @@ func printSummary(summary allocationSummary) {
 	printNeedCoverage(summary.NeedCoverage)
 	printNeedEquity(summary.NeedCoverage)
 	printUnfundedByNeed(summary.UnfundedByNeed)
+	printGroupCoverage(summary.GroupBy, summary.ByGroup)
+	printProgramBudgets(summary.ByProgram)
+	printNeedBudgets(summary.ByNeedBudget)
+	printRepresentation(summary.Representation)
+}
+
+func printRepresentation(results []representResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println("\nMinimum Representation")
+	fmt.Println(strings.Repeat("-", 22))
+	for _, result := range results {
+		status := "met"
+		if !result.Met {
+			status = fmt.Sprintf("short by %d", result.Target-result.AwardedCount)
+		}
+		fmt.Printf("%s=%s: %d of %d awarded (%d eligible, $%.2f) | %s\n",
+			result.Column,
+			result.Value,
+			result.AwardedCount,
+			result.Target,
+			result.EligibleCount,
+			result.AwardedTotal,
+			status,
+		)
+	}
+}
+
+func printNeedBudgets(levels map[string]programAgg) {
+	if len(levels) == 0 {
+		return
+	}
+	fmt.Println("\nNeed-Level Budgets")
+	fmt.Println(strings.Repeat("-", 18))
+	for _, level := range []string{"high", "medium", "low"} {
+		agg := levels[level]
+		fmt.Printf("%s: $%.2f budget | $%.2f used | $%.2f left | %d awarded | %d unfunded\n",
+			strings.Title(level), agg.Budget, agg.BudgetUsed, agg.BudgetLeft, agg.AwardedCount, agg.UnfundedCount)
+	}
+}
+
+func printProgramBudgets(programs map[string]programAgg) {
+	if len(programs) == 0 {
+		return
+	}
+	fmt.Println("\nBy Program")
+	fmt.Println(strings.Repeat("-", 10))
+	for _, program := range slices.Sorted(maps.Keys(programs)) {
+		agg := programs[program]
+		fmt.Printf("%s: $%.2f budget | $%.2f used | $%.2f left | %d awarded | %d unfunded | %.1f%% coverage\n",
+			program,
+			agg.Budget,
+			agg.BudgetUsed,
+			agg.BudgetLeft,
+			agg.AwardedCount,
+			agg.UnfundedCount,
+			agg.CoverageRate*100,
+		)
+	}
+}
+
+func printGroupCoverage(column string, groups map[string]needCoverageAgg) {
+	if column == "" || len(groups) == 0 {
+		return
+	}
+	title := fmt.Sprintf("By %s", column)
+	fmt.Printf("\n%s\n", title)
+	fmt.Println(strings.Repeat("-", len(title)))
+	for _, key := range slices.Sorted(maps.Keys(groups)) {
+		agg := groups[key]
+		fmt.Printf("%s: %d eligible | %d awarded ($%.2f) | %d unfunded | %.1f%% coverage\n",
+			key,
+			agg.EligibleCount,
+			agg.AwardedCount,
+			agg.AwardedTotal,
+			agg.UnfundedCount,
+			agg.CoverageRate*100,
+		)
+	}
+}
+
+func printShadowComparison(comparison *shadowComparison) {
+	if comparison == nil {
+		return
+	}
+	actual, shadow := comparison.Actual, comparison.Shadow
+	fmt.Println("\nActual vs Shadow Budget")
+	fmt.Println(strings.Repeat("-", 23))
+	fmt.Printf("%-11s | %-12s | %-12s\n", "", "Actual", "Shadow")
+	fmt.Printf("%-11s | %-12s | %-12s\n", "Budget", formatCurrency(actual.Budget), formatCurrency(shadow.Budget))
+	fmt.Printf("%-11s | %-12d | %-12d\n", "Awarded", actual.AwardedCount, shadow.AwardedCount)
+	fmt.Printf("%-11s | %-12d | %-12d\n", "Unfunded", actual.EligibleUnfundedCount, shadow.EligibleUnfundedCount)
+	fmt.Printf("%-11s | %-12s | %-12s\n", "Coverage", formatPercent(actual.CoverageRate), formatPercent(shadow.CoverageRate))
+	fmt.Printf("%-11s | %-12s | %-12s\n", "Full Funded", formatPercent(actual.FullFundingRate), formatPercent(shadow.FullFundingRate))
+	fmt.Printf("Additional applicants funded at shadow budget: %+d\n", comparison.AdditionalFunded)
+}
+
+func printWithdrawal(impact *withdrawalImpact, anonymize bool) {
+	if impact == nil {
+		return
+	}
+	fmt.Printf("\nWithdrawal of %s\n", formatApplicantLabel(impact.ApplicantID, impact.Name, anonymize))
+	fmt.Println(strings.Repeat("-", 13))
+	fmt.Printf("Budget Freed: $%.2f\n", impact.BudgetFreed)
+	if len(impact.Gains) == 0 {
+		fmt.Println("No other applicant gains funding.")
+		return
+	}
+	for _, gain := range impact.Gains {
+		status := "Raised"
+		if gain.NewlyFunded {
+			status = "Newly funded"
+		}
+		fmt.Printf("- %s | %s | $%.2f -> $%.2f\n", formatApplicantLabel(gain.ApplicantID, gain.Name, anonymize), status, gain.Before, gain.After)
+	}
+}
+
+func printRoundResults(results []roundResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println("\nAllocation Rounds")
+	fmt.Println(strings.Repeat("-", 17))
+	fmt.Printf("%-5s | %-12s | %-7s | %-8s | %-12s | %-11s\n",
+		"Round", "Available", "Offered", "Declined", "Returned", "Budget Used")
+	for _, result := range results {
+		fmt.Printf("%-5d | %-12s | %-7d | %-8d | %-12s | %-11s\n",
+			result.Round,
+			formatCurrency(result.BudgetAvailable),
+			result.Offered,
+			result.Declined,
+			formatCurrency(result.DeclinedAmount),
+			formatCurrency(result.BudgetUsed),
+		)
+	}
 }
 
 func printScenarioResults(results []scenarioResult) {
@@ -1077,6 +5486,71 @@ func printScenarioResults(results []scenarioResult) {
 	}
 }
 
+func printModeComparison(results []modeResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println("\nAllocation Mode Comparison")
+	fmt.Println(strings.Repeat("-", 26))
+	fmt.Printf("%-14s | %-7s | %-8s | %-11s | %-5s | %-11s\n",
+		"Mode", "Awarded", "Coverage", "Full Funded", "Gini", "Budget Used")
+	for _, result := range results {
+		fmt.Printf("%-14s | %-7d | %-8s | %-11s | %-5.3f | %-11s\n",
+			result.Mode,
+			result.AwardedCount,
+			formatPercent(result.CoverageRate),
+			formatPercent(result.FullFundingRate),
+			result.Gini,
+			formatCurrency(result.BudgetUsed),
+		)
+	}
+}
+
+func printWeightSweep(results []weightSweepResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println("\nWeight Sweep")
+	fmt.Println(strings.Repeat("-", 12))
+	fmt.Printf("%-11s | %-7s | %-8s | %-11s | %-8s | %-8s | %-8s\n",
+		"Score/Need", "Awarded", "Coverage", "Full Funded", "High", "Medium", "Low")
+	for _, result := range results {
+		fmt.Printf("%-11s | %-7d | %-8s | %-11s | %-8s | %-8s | %-8s\n",
+			formatFloat(result.ScoreWeight, 2)+"/"+formatFloat(result.NeedWeight, 2),
+			result.AwardedCount,
+			formatPercent(result.CoverageRate),
+			formatPercent(result.FullFundingRate),
+			formatPercent(result.NeedCoverage["high"]),
+			formatPercent(result.NeedCoverage["medium"]),
+			formatPercent(result.NeedCoverage["low"]),
+		)
+	}
+}
+
+func printCoverageLadder(steps []ladderStep) {
+	if len(steps) == 0 {
+		return
+	}
+	fmt.Println("\nCoverage Ladder")
+	fmt.Println(strings.Repeat("-", 15))
+	fmt.Printf("%-8s | %-12s | %-12s | %-8s | %-7s\n",
+		"Target", "Min Budget", "Marginal", "Coverage", "Awarded")
+	for _, step := range steps {
+		if !step.Reachable {
+			fmt.Printf("%-8s | %-12s | %-12s | %-8s | %-7s\n",
+				formatPercent(step.TargetCoverage), "unreachable", "-", "-", "-")
+			continue
+		}
+		fmt.Printf("%-8s | %-12s | %-12s | %-8s | %-7d\n",
+			formatPercent(step.TargetCoverage),
+			formatCurrency(step.Budget),
+			formatCurrency(step.MarginalBudget),
+			formatPercent(step.CoverageRate),
+			step.AwardedCount,
+		)
+	}
+}
+
 func printNeedCoverage(coverage map[string]needCoverageAgg) {
 	if len(coverage) == 0 {
 		return
@@ -1086,13 +5560,14 @@ func printNeedCoverage(coverage map[string]needCoverageAgg) {
 	needKeys := []string{"high", "medium", "low"}
 	for _, level := range needKeys {
 		agg := coverage[level]
-		fmt.Printf("%s: %d eligible | %d awarded | %d unfunded | $%.2f requested | $%.2f awarded | %.1f%% coverage\n",
+		fmt.Printf("%s: %d eligible | %d awarded | %d unfunded | $%.2f requested | $%.2f awarded | $%.2f gap | %.1f%% coverage\n",
 			strings.Title(level),
 			agg.EligibleCount,
 			agg.AwardedCount,
 			agg.UnfundedCount,
 			agg.RequestedTotal,
 			agg.AwardedTotal,
+			agg.FundingGap,
 			agg.CoverageRate*100,
 		)
 	}
@@ -1116,216 +5591,1039 @@ func printNeedEquity(coverage map[string]needCoverageAgg) {
 	}
 }
 
-func printIneligibleReasons(reasons map[string]int) {
+var constraintOrder = []string{constraintFull, constraintMaxAward, constraintCostOfAtt, constraintFTE, constraintMaxPercent, constraintRequestCap, constraintRounding, constraintStretch, constraintLevelCap, constraintBudget}
+
+func printConstraintSummary(constraints map[string]int, awardedCount int) {
+	if len(constraints) == 0 || awardedCount == 0 {
+		return
+	}
+	fmt.Println("\nBinding Constraints")
+	fmt.Println(strings.Repeat("-", 19))
+	for _, constraint := range constraintOrder {
+		count := constraints[constraint]
+		if count == 0 {
+			continue
+		}
+		fmt.Printf("%s: %d (%.1f%% of awards)\n", constraint, count, float64(count)/float64(awardedCount)*100)
+	}
+}
+
+func printIneligibleReasons(reasons map[string]int, top int) {
 	if len(reasons) == 0 {
 		return
 	}
-	type reasonCount struct {
-		Reason string
-		Count  int
+	fmt.Println("\nIneligible Reasons")
+	fmt.Println(strings.Repeat("-", 18))
+	shown, hidden := limitReasonSummary(sortReasonSummary(reasons), top)
+	for _, item := range shown {
+		fmt.Printf("%s: %d\n", item.Reason, item.Count)
 	}
-	var list []reasonCount
-	for reason, count := range reasons {
-		list = append(list, reasonCount{Reason: reason, Count: count})
+	if hidden > 0 {
+		fmt.Printf("... %d more\n", hidden)
 	}
-	sort.Slice(list, func(i, j int) bool {
-		if list[i].Count == list[j].Count {
-			return list[i].Reason < list[j].Reason
+}
+
+func totalAwarded(awarded []*applicant) float64 {
+	var total float64
+	for _, item := range awarded {
+		total += item.Awarded
+	}
+	return total
+}
+
+// printAwards lists awards in the given display order. Each line starts with
+// the award's funding rank, which keeps allocation order when re-sorted.
+func printAwards(awarded []awardRecord, topN int, showAll bool, precision int, anonymize bool) {
+	fmt.Println()
+	writeAwardsTable(os.Stdout, awarded, topN, showAll, precision, anonymize)
+}
+
+// writeAwardsTable writes the awarded applicants list shown on the console,
+// limited to topN rows unless showAll is set.
+func writeAwardsTable(out io.Writer, awarded []awardRecord, topN int, showAll bool, precision int, anonymize bool) {
+	if len(awarded) == 0 {
+		fmt.Fprintln(out, "No awards allocated.")
+		return
+	}
+	fmt.Fprintln(out, "Awarded Applicants")
+	fmt.Fprintln(out, strings.Repeat("-", 19))
+	limit := len(awarded)
+	if !showAll && topN > 0 && topN < limit {
+		limit = topN
+	}
+	for i := 0; i < limit; i++ {
+		item := awarded[i]
+		match := ""
+		if item.Effective != item.Awarded {
+			match = fmt.Sprintf(" | Effective: $%.2f", item.Effective)
+		}
+		fmt.Fprintf(out, "%d. %s | Need: %s | Score: %.1f | Requested: $%.2f | Awarded: $%.2f%s | Priority: %s\n",
+			item.Rank, formatApplicantLabel(item.ApplicantID, item.Name, anonymize), strings.Title(item.NeedLevel), item.Score, item.Requested, item.Awarded, match, formatFloat(item.Priority, precision))
+	}
+	if limit < len(awarded) {
+		fmt.Fprintf(out, "... %d more\n", len(awarded)-limit)
+	}
+}
+
+// writeAwardsText saves the console awards list to a file so it can be
+// pasted into notes without the rest of the run output.
+// fixedWidthField is one column of a -fixed-width-spec record layout.
+type fixedWidthField struct {
+	Name  string
+	Width int
+}
+
+var fixedWidthFields = map[string]bool{
+	"id":        true,
+	"name":      true,
+	"need":      true,
+	"score":     true,
+	"requested": true,
+	"amount":    true,
+}
+
+// parseFixedWidthSpec parses -fixed-width-spec into an ordered record layout.
+func parseFixedWidthSpec(raw string) ([]fixedWidthField, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var fields []fixedWidthField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid fixed-width field: %s (expected field:width)", part)
+		}
+		if !fixedWidthFields[name] {
+			return nil, fmt.Errorf("unknown fixed-width field: %s (expected id, name, need, score, requested, or amount)", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate fixed-width field: %s", name)
+		}
+		width, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("invalid fixed-width width for %s: %s", name, strings.TrimSpace(value))
+		}
+		seen[name] = true
+		fields = append(fields, fixedWidthField{Name: name, Width: width})
+	}
+	return fields, nil
+}
+
+// formatFixedWidthRecord lays out one award per the spec. Numbers are
+// zero-padded on the left and text is space-padded on the right. Names and
+// need levels are truncated to fit; an ID or number that does not fit is an
+// error rather than a silently corrupted record.
+func formatFixedWidthRecord(item *applicant, spec []fixedWidthField) (string, error) {
+	var line strings.Builder
+	for _, field := range spec {
+		var value string
+		switch field.Name {
+		case "id":
+			if len(item.ID) > field.Width {
+				return "", fmt.Errorf("applicant_id %s does not fit fixed-width field id (width %d)", item.ID, field.Width)
+			}
+			value = fmt.Sprintf("%-*s", field.Width, item.ID)
+		case "name", "need":
+			text := item.Name
+			if field.Name == "need" {
+				text = item.NeedLevel
+			}
+			if len(text) > field.Width {
+				text = text[:field.Width]
+			}
+			value = fmt.Sprintf("%-*s", field.Width, text)
+		default:
+			amount, decimals := item.Awarded, 2
+			switch field.Name {
+			case "score":
+				amount, decimals = item.ScoreRaw, 1
+			case "requested":
+				amount = item.Requested
+			}
+			value = fmt.Sprintf("%0*.*f", field.Width, decimals, amount)
+			if len(value) > field.Width {
+				return "", fmt.Errorf("%s %s for %s does not fit fixed-width field %s (width %d)", field.Name, value, item.ID, field.Name, field.Width)
+			}
+		}
+		line.WriteString(value)
+	}
+	return line.String(), nil
+}
+
+// writeFixedWidth writes one fixed-width record per award for importers that
+// cannot read CSV. Every record is validated before the file is replaced.
+func writeFixedWidth(path string, awarded []*applicant, spec []fixedWidthField) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		var buf bytes.Buffer
+		for _, item := range awarded {
+			line, err := formatFixedWidthRecord(item, spec)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+		if _, err := out.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("unable to write fixed-width awards: %w", err)
+		}
+		return nil
+	})
+}
+
+func writeAwardsText(path string, awarded []awardRecord, topN int, showAll bool, precision int, anonymize bool) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		var buf bytes.Buffer
+		writeAwardsTable(&buf, awarded, topN, showAll, precision, anonymize)
+		if _, err := out.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("unable to write awards text: %w", err)
+		}
+		return nil
+	})
+}
+
+func printUnfunded(unfunded []awardRecord, topN int, showAll bool, precision int, anonymize bool) {
+	if len(unfunded) == 0 {
+		fmt.Println("\nNo eligible unfunded applicants.")
+		return
+	}
+	fmt.Println("\nUnfunded Eligible Applicants")
+	fmt.Println(strings.Repeat("-", 28))
+	limit := len(unfunded)
+	if !showAll && topN > 0 && topN < limit {
+		limit = topN
+	}
+	for i := 0; i < limit; i++ {
+		item := unfunded[i]
+		fmt.Printf("%d. %s | Need: %s | Score: %.1f | Requested: $%.2f | Priority: %s\n",
+			i+1, formatApplicantLabel(item.ApplicantID, item.Name, anonymize), strings.Title(item.NeedLevel), item.Score, item.Requested, formatFloat(item.Priority, precision))
+	}
+	if limit < len(unfunded) {
+		fmt.Printf("... %d more\n", len(unfunded)-limit)
+	}
+}
+
+func printBoundary(boundary []boundaryRecord, precision int, anonymize bool) {
+	if len(boundary) == 0 {
+		return
+	}
+	fmt.Printf("\nBoundary (%d tied at priority %s)\n", len(boundary), formatFloat(boundary[0].Priority, precision))
+	fmt.Println(strings.Repeat("-", 8))
+	for _, item := range boundary {
+		status := "Unfunded"
+		if item.Funded {
+			status = fmt.Sprintf("Funded $%.2f", item.Awarded)
+		}
+		fmt.Printf("- %s | Need: %s | Score: %.1f | Requested: $%.2f | %s\n",
+			formatApplicantLabel(item.ApplicantID, item.Name, anonymize), strings.Title(item.NeedLevel), item.Score, item.Requested, status)
+	}
+}
+
+func printNearMisses(misses []nearMissRecord, anonymize bool) {
+	if len(misses) == 0 {
+		return
+	}
+	fmt.Printf("\nNear Misses (%d below the minimum score)\n", len(misses))
+	fmt.Println(strings.Repeat("-", 11))
+	for _, item := range misses {
+		fmt.Printf("- %s | Need: %s | Score: %.1f | Minimum: %.1f | Below by: %.1f | Requested: $%.2f\n",
+			formatApplicantLabel(item.ApplicantID, item.Name, anonymize), strings.Title(item.NeedLevel), item.Score, item.Threshold, item.BelowBy, item.Requested)
+	}
+}
+
+func printUnfundedByNeed(byNeed map[string]needUnfundedAgg) {
+	if len(byNeed) == 0 {
+		return
+	}
+	fmt.Println("\nUnfunded By Need Level")
+	fmt.Println(strings.Repeat("-", 23))
+	needKeys := []string{"high", "medium", "low"}
+	for _, level := range needKeys {
+		agg := byNeed[level]
+		fmt.Printf("%s: %d unfunded ($%.2f requested)\n", strings.Title(level), agg.Count, agg.Requested)
+	}
+}
+
+// writeFileAtomic writes path through a temporary file in the same directory
+// and renames it into place only once write, sync, and close all succeed. On
+// any error the temporary file is removed, so a reader of path sees either the
+// previous file or the complete new one, never a partial write.
+func writeFileAtomic(path string, write func(io.Writer) error) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", path, err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	if err = file.Chmod(0o644); err != nil {
+		return fmt.Errorf("unable to set permissions on %s: %w", path, err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync %s: %w", path, err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("unable to close %s: %w", path, err)
+	}
+	if err = os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("unable to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// newJSONEncoder returns an encoder for the JSON outputs: indented by default,
+// or one line with -json-compact. encoding/json writes map keys (need levels,
+// reasons, groups) in sorted order, so the bytes are stable across runs.
+func newJSONEncoder(out io.Writer, compact bool) *json.Encoder {
+	encoder := json.NewEncoder(out)
+	if !compact {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder
+}
+
+func writeJSON(path string, summary allocationSummary, awarded []*applicant, compact bool) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		encoder := newJSONEncoder(out, compact)
+		if err := encoder.Encode(summary); err != nil {
+			return fmt.Errorf("unable to write JSON output: %w", err)
+		}
+		return nil
+	})
+}
+
+// summaryOnlyJSON shadows the per-applicant arrays of allocationSummary so they
+// are dropped from the encoded output while every aggregate is kept.
+type summaryOnlyJSON struct {
+	allocationSummary
+	Awards     []awardRecord      `json:"awards,omitempty"`
+	Unfunded   []awardRecord      `json:"unfunded,omitempty"`
+	Ineligible []ineligibleRecord `json:"ineligible,omitempty"`
+}
+
+func writeSummaryJSON(path string, summary allocationSummary, compact bool) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		encoder := newJSONEncoder(out, compact)
+		if err := encoder.Encode(summaryOnlyJSON{allocationSummary: summary}); err != nil {
+			return fmt.Errorf("unable to write summary JSON output: %w", err)
+		}
+		return nil
+	})
+}
+
+type summaryMetric struct {
+	name  string
+	value string
+}
+
+// summaryMetrics flattens the summary's scalar fields and per-need-level maps
+// into metric,value rows. Per-need metrics are named need.<level>.<metric>.
+func summaryMetrics(summary allocationSummary) []summaryMetric {
+	money := func(value float64) string { return formatFloat(value, 2) }
+	rate := func(value float64) string { return formatFloat(value, 4) }
+	count := strconv.Itoa
+	metrics := []summaryMetric{
+		{"generated_at", summary.GeneratedAt},
+		{"result_hash", summary.ResultHash},
+		{"budget", money(summary.Budget)},
+		{"budget_used", money(summary.BudgetUsed)},
+		{"effective_budget", money(summary.EffectiveBudget)},
+		{"term_years", count(summary.TermYears)},
+		{"annual_budget", money(summary.AnnualBudget)},
+		{"annual_budget_used", money(summary.AnnualBudgetUsed)},
+		{"annual_requested_total", money(summary.AnnualRequestedTotal)},
+		{"total_effective_awarded", money(summary.TotalEffectiveAwarded)},
+		{"budget_left", money(summary.BudgetLeft)},
+		{"stranded_budget", money(summary.StrandedBudget)},
+		{"budget_required_full", money(summary.BudgetRequiredFull)},
+		{"budget_shortfall", money(summary.BudgetShortfall)},
+		{"applicants", count(summary.Applicants)},
+		{"eligible_count", count(summary.EligibleCount)},
+		{"awarded_count", count(summary.AwardedCount)},
+		{"ineligible_count", count(summary.IneligibleCount)},
+		{"declined_count", count(summary.DeclinedCount)},
+		{"eligible_unfunded_count", count(summary.EligibleUnfundedCount)},
+		{"eligible_unfunded_amount", money(summary.EligibleUnfundedAmount)},
+		{"eligible_requested_total", money(summary.EligibleRequestedTotal)},
+		{"fully_funded_count", count(summary.FullyFundedCount)},
+		{"partially_funded_count", count(summary.PartiallyFundedCount)},
+		{"max_partial", count(summary.MaxPartial)},
+		{"funding_gap_total", money(summary.FundingGapTotal)},
+		{"gap_closed_per_dollar", rate(summary.GapClosedPerDollar)},
+		{"coverage_rate", rate(summary.CoverageRate)},
+		{"full_funding_rate", rate(summary.FullFundingRate)},
+	}
+	if summary.IncludesIneligibleRates {
+		metrics = append(metrics,
+			summaryMetric{"all_requested_total", money(summary.AllRequestedTotal)},
+			summaryMetric{"coverage_rate_all", rate(summary.CoverageRateAll)},
+			summaryMetric{"full_funding_rate_all", rate(summary.FullFundingRateAll)},
+		)
+	}
+	metrics = append(metrics,
+		summaryMetric{"average_award", money(summary.AverageAward)},
+		summaryMetric{"award_p25", money(summary.AwardP25)},
+		summaryMetric{"award_p50", money(summary.AwardP50)},
+		summaryMetric{"award_p75", money(summary.AwardP75)},
+		summaryMetric{"award_to_request_avg", rate(summary.AwardToRequestAvg)},
+		summaryMetric{"requested_total", money(summary.RequestedTotal)},
+		summaryMetric{"requested_mean", money(summary.RequestedMean)},
+		summaryMetric{"requested_p25", money(summary.RequestedP25)},
+		summaryMetric{"requested_p50", money(summary.RequestedP50)},
+		summaryMetric{"requested_p75", money(summary.RequestedP75)},
+		summaryMetric{"min_awarded", money(summary.MinAwarded)},
+		summaryMetric{"max_awarded", money(summary.MaxAwarded)},
+		summaryMetric{"last_funded_priority", formatFloat(summary.LastFundedPriority, summary.PriorityPrecision)},
+		summaryMetric{"last_funded_score", formatFloat(summary.LastFundedScore, 1)},
+		summaryMetric{"last_funded_need", summary.LastFundedNeed},
+		summaryMetric{"last_funded_requested", money(summary.LastFundedRequested)},
+		summaryMetric{"first_unfunded_priority", formatFloat(summary.FirstUnfundedPriority, summary.PriorityPrecision)},
+		summaryMetric{"first_unfunded_score", formatFloat(summary.FirstUnfundedScore, 1)},
+		summaryMetric{"first_unfunded_need", summary.FirstUnfundedNeed},
+		summaryMetric{"first_unfunded_requested", money(summary.FirstUnfundedRequested)},
+		summaryMetric{"request_cap_amount", money(summary.RequestCapAmount)},
+		summaryMetric{"request_capped_count", count(summary.RequestCappedCount)},
+		summaryMetric{"median_award_cap", money(summary.MedianAwardCap)},
+		summaryMetric{"max_capped_count", count(summary.MaxCappedCount)},
+		summaryMetric{"max_capped_trimmed", money(summary.MaxCappedTrimmed)},
+		summaryMetric{"swept_amount", money(summary.SweptAmount)},
+		summaryMetric{"swept_count", count(summary.SweptCount)},
+		summaryMetric{"topup_amount", money(summary.TopupAmount)},
+		summaryMetric{"topup_count", count(summary.TopupCount)},
+		summaryMetric{"stretch_shave", rate(summary.StretchShave)},
+		summaryMetric{"stretch_added_count", count(summary.StretchAddedCount)},
+	)
+	for _, level := range []string{"high", "medium", "low"} {
+		prefix := "need." + level + "."
+		coverage := summary.NeedCoverage[level]
+		metrics = append(metrics,
+			summaryMetric{prefix + "eligible_count", count(coverage.EligibleCount)},
+			summaryMetric{prefix + "awarded_count", count(coverage.AwardedCount)},
+			summaryMetric{prefix + "unfunded_count", count(coverage.UnfundedCount)},
+			summaryMetric{prefix + "requested_total", money(coverage.RequestedTotal)},
+			summaryMetric{prefix + "awarded_total", money(coverage.AwardedTotal)},
+			summaryMetric{prefix + "funding_gap", money(coverage.FundingGap)},
+			summaryMetric{prefix + "unfunded_requested", money(summary.UnfundedByNeed[level].Requested)},
+			summaryMetric{prefix + "coverage_rate", rate(coverage.CoverageRate)},
+			summaryMetric{prefix + "requested_share", rate(coverage.RequestedShare)},
+			summaryMetric{prefix + "awarded_share", rate(coverage.AwardedShare)},
+			summaryMetric{prefix + "share_delta", rate(coverage.ShareDelta)},
+		)
+	}
+	if len(summary.ByNeedBudget) > 0 {
+		for _, level := range []string{"high", "medium", "low"} {
+			prefix := "need." + level + "."
+			metrics = append(metrics,
+				summaryMetric{prefix + "budget", money(summary.ByNeedBudget[level].Budget)},
+				summaryMetric{prefix + "budget_left", money(summary.ByNeedBudget[level].BudgetLeft)},
+			)
+		}
+	}
+	for _, entry := range summary.LevelCaps {
+		prefix := "need." + entry.NeedLevel + "."
+		metrics = append(metrics,
+			summaryMetric{prefix + "amount_cap", money(entry.Cap)},
+			summaryMetric{prefix + "amount_cap_used", money(entry.Used)},
+		)
+	}
+	for _, constraint := range constraintOrder {
+		if value, ok := summary.ConstraintSummary[constraint]; ok {
+			metrics = append(metrics, summaryMetric{"constraint." + constraint, count(value)})
+		}
+	}
+	return metrics
+}
+
+func writeSummaryCSV(path string, summary allocationSummary) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		writer := csv.NewWriter(out)
+		if err := writer.Write([]string{"metric", "value"}); err != nil {
+			return fmt.Errorf("write summary CSV header: %w", err)
+		}
+		for _, metric := range summaryMetrics(summary) {
+			if err := writer.Write([]string{metric.name, metric.value}); err != nil {
+				return fmt.Errorf("write summary CSV row: %w", err)
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("flush summary CSV: %w", err)
+		}
+		return nil
+	})
+}
+
+func writeAwardsCSV(path string, awarded []awardRecord, precision int, flagCapped, sourceLines bool) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		writer := csv.NewWriter(out)
+		header := []string{"applicant_id", "name", "need_level", "score", "requested_amount", "awarded_amount", "priority", "effective_awarded", "margin_to_cutoff"}
+		if flagCapped {
+			header = append(header, "capped_by")
+		}
+		if sourceLines {
+			header = append(header, "source_line")
+		}
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("write awards CSV header: %w", err)
+		}
+		for _, item := range awarded {
+			row := []string{
+				item.ApplicantID,
+				item.Name,
+				item.NeedLevel,
+				formatFloat(item.Score, 1),
+				formatFloat(item.Requested, 2),
+				formatFloat(item.Awarded, 2),
+				formatFloat(item.Priority, precision),
+				formatFloat(item.Effective, 2),
+				formatFloat(item.Margin, precision),
+			}
+			if flagCapped {
+				row = append(row, cappedBy(item.Constraint))
+			}
+			if sourceLines {
+				row = append(row, formatSourceLine(item.SourceLine))
+			}
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("write awards CSV row: %w", err)
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("flush awards CSV: %w", err)
+		}
+		return nil
+	})
+}
+
+// formatSourceLine renders an input line number, or "" for applicants rebuilt
+// from the database, which have none.
+func formatSourceLine(line int) string {
+	if line <= 0 {
+		return ""
+	}
+	return strconv.Itoa(line)
+}
+
+// cappedBy names the cap that trimmed an award below the unmet need, or is
+// empty for full and budget-truncated awards.
+func cappedBy(constraint string) string {
+	switch constraint {
+	case constraintMaxAward, constraintFTE, constraintMaxPercent, constraintRequestCap, constraintRounding:
+		return constraint
+	}
+	return ""
+}
+
+func writeUnfundedCSV(path string, unfunded []awardRecord, precision int, sourceLines bool) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		writer := csv.NewWriter(out)
+		header := []string{"applicant_id", "name", "need_level", "score", "requested_amount", "priority", "margin_to_cutoff"}
+		if sourceLines {
+			header = append(header, "source_line")
+		}
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("write unfunded CSV header: %w", err)
+		}
+		for _, item := range unfunded {
+			row := []string{
+				item.ApplicantID,
+				item.Name,
+				item.NeedLevel,
+				formatFloat(item.Score, 1),
+				formatFloat(item.Requested, 2),
+				formatFloat(item.Priority, precision),
+				formatFloat(item.Margin, precision),
+			}
+			if sourceLines {
+				row = append(row, formatSourceLine(item.SourceLine))
+			}
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("write unfunded CSV row: %w", err)
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("flush unfunded CSV: %w", err)
+		}
+		return nil
+	})
+}
+
+func writeIneligibleCSV(path string, ineligible []ineligibleRecord, sourceLines bool) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		writer := csv.NewWriter(out)
+		header := []string{"applicant_id", "name", "need_level", "score", "requested_amount", "eligibility_reason"}
+		if sourceLines {
+			header = append(header, "source_line")
+		}
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("write ineligible CSV header: %w", err)
+		}
+		for _, item := range ineligible {
+			row := []string{
+				item.ApplicantID,
+				item.Name,
+				item.NeedLevel,
+				formatFloat(item.Score, 1),
+				formatFloat(item.Requested, 2),
+				item.Reason,
+			}
+			if sourceLines {
+				row = append(row, formatSourceLine(item.SourceLine))
+			}
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("write ineligible CSV row: %w", err)
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("flush ineligible CSV: %w", err)
+		}
+		return nil
+	})
+}
+
+// writePriorityBreakdownCSV writes how each eligible applicant's priority was
+// derived, in priority order. The request columns appear only when
+// -request-weight is set.
+func writePriorityBreakdownCSV(path string, applicants []*applicant, withRequest bool, precision int) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		writer := csv.NewWriter(out)
+		header := []string{"applicant_id", "score_raw", "score_norm", "need_level", "need_score", "score_weight_contribution", "need_weight_contribution"}
+		if withRequest {
+			header = append(header, "request_norm", "request_weight_contribution")
+		}
+		header = append(header, "priority")
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("write priority breakdown CSV header: %w", err)
+		}
+		for _, item := range applicants {
+			if !item.Eligible {
+				continue
+			}
+			row := []string{
+				item.ID,
+				formatFloat(item.ScoreRaw, 1),
+				formatFloat(item.ScoreNorm, precision),
+				item.NeedLevel,
+				formatFloat(applicantNeedScore(item), 2),
+				formatFloat(item.ScoreContrib, precision),
+				formatFloat(item.NeedContrib, precision),
+			}
+			if withRequest {
+				row = append(row, formatFloat(item.RequestNorm, precision), formatFloat(item.RequestContrib, precision))
+			}
+			row = append(row, formatFloat(item.PriorityScore, precision))
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("write priority breakdown CSV row: %w", err)
+			}
 		}
-		return list[i].Count > list[j].Count
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("flush priority breakdown CSV: %w", err)
+		}
+		return nil
 	})
-	fmt.Println("\nIneligible Reasons")
-	fmt.Println(strings.Repeat("-", 18))
-	limit := len(list)
-	if limit > 3 {
-		limit = 3
-	}
-	for i := 0; i < limit; i++ {
-		fmt.Printf("%s: %d\n", list[i].Reason, list[i].Count)
-	}
-	if limit < len(list) {
-		fmt.Printf("... %d more\n", len(list)-limit)
-	}
 }
 
-func totalAwarded(awarded []*applicant) float64 {
-	var total float64
-	for _, item := range awarded {
-		total += item.Awarded
-	}
-	return total
+// xlsxCell is one workbook cell. Numeric cells are stored as numbers so they
+// stay summable in Excel; currency cells also get a #,##0.00 display format.
+type xlsxCell struct {
+	text     string
+	number   float64
+	numeric  bool
+	currency bool
 }
 
-func printAwards(awarded []*applicant, topN int, showAll bool) {
-	if len(awarded) == 0 {
-		fmt.Println("\nNo awards allocated.")
-		return
+func xlsxText(value string) xlsxCell { return xlsxCell{text: value} }
+
+// xlsxNumber rounds value to the given decimals, matching the CSV exports.
+func xlsxNumber(value float64, decimals int) xlsxCell {
+	scale := math.Pow(10, float64(decimals))
+	return xlsxCell{number: math.Round(value*scale) / scale, numeric: true}
+}
+
+func xlsxMoney(value float64) xlsxCell {
+	cell := xlsxNumber(value, 2)
+	cell.currency = true
+	return cell
+}
+
+type xlsxSheet struct {
+	name string
+	rows [][]xlsxCell
+}
+
+// workbookSheets lays out the awards, unfunded, ineligible, and summary
+// sections with the same columns as the matching CSV exports.
+func workbookSheets(summary allocationSummary) []xlsxSheet {
+	precision := summary.PriorityPrecision
+	header := func(names ...string) []xlsxCell {
+		row := make([]xlsxCell, len(names))
+		for i, name := range names {
+			row[i] = xlsxText(name)
+		}
+		return row
+	}
+
+	awardHeader := header("applicant_id", "name", "need_level", "score", "requested_amount", "awarded_amount", "priority", "effective_awarded", "margin_to_cutoff")
+	if summary.FlagCapped {
+		awardHeader = append(awardHeader, xlsxText("capped_by"))
+	}
+	awards := xlsxSheet{name: "Awards", rows: [][]xlsxCell{awardHeader}}
+	for _, item := range summary.Awards {
+		row := []xlsxCell{
+			xlsxText(item.ApplicantID),
+			xlsxText(item.Name),
+			xlsxText(item.NeedLevel),
+			xlsxNumber(item.Score, 1),
+			xlsxMoney(item.Requested),
+			xlsxMoney(item.Awarded),
+			xlsxNumber(item.Priority, precision),
+			xlsxMoney(item.Effective),
+			xlsxNumber(item.Margin, precision),
+		}
+		if summary.FlagCapped {
+			row = append(row, xlsxText(cappedBy(item.Constraint)))
+		}
+		awards.rows = append(awards.rows, row)
+	}
+
+	unfunded := xlsxSheet{name: "Unfunded", rows: [][]xlsxCell{header("applicant_id", "name", "need_level", "score", "requested_amount", "priority", "margin_to_cutoff")}}
+	for _, item := range summary.Unfunded {
+		unfunded.rows = append(unfunded.rows, []xlsxCell{
+			xlsxText(item.ApplicantID),
+			xlsxText(item.Name),
+			xlsxText(item.NeedLevel),
+			xlsxNumber(item.Score, 1),
+			xlsxMoney(item.Requested),
+			xlsxNumber(item.Priority, precision),
+			xlsxNumber(item.Margin, precision),
+		})
 	}
-	fmt.Println("\nAwarded Applicants")
-	fmt.Println(strings.Repeat("-", 19))
-	limit := len(awarded)
-	if !showAll && topN > 0 && topN < limit {
-		limit = topN
+
+	ineligible := xlsxSheet{name: "Ineligible", rows: [][]xlsxCell{header("applicant_id", "name", "need_level", "score", "requested_amount", "eligibility_reason")}}
+	for _, item := range summary.Ineligible {
+		ineligible.rows = append(ineligible.rows, []xlsxCell{
+			xlsxText(item.ApplicantID),
+			xlsxText(item.Name),
+			xlsxText(item.NeedLevel),
+			xlsxNumber(item.Score, 1),
+			xlsxMoney(item.Requested),
+			xlsxText(item.Reason),
+		})
 	}
-	for i := 0; i < limit; i++ {
-		item := awarded[i]
-		label := item.ID
-		if item.Name != "" {
-			label = fmt.Sprintf("%s (%s)", item.Name, item.ID)
+
+	metrics := xlsxSheet{name: "Summary", rows: [][]xlsxCell{header("metric", "value")}}
+	for _, metric := range summaryMetrics(summary) {
+		value := xlsxText(metric.value)
+		if number, err := strconv.ParseFloat(metric.value, 64); err == nil {
+			value = xlsxCell{number: number, numeric: true}
 		}
-		fmt.Printf("%d. %s | Need: %s | Score: %.1f | Requested: $%.2f | Awarded: $%.2f | Priority: %.2f\n",
-			i+1, label, strings.Title(item.NeedLevel), item.ScoreRaw, item.Requested, item.Awarded, item.PriorityScore)
-	}
-	if limit < len(awarded) {
-		fmt.Printf("... %d more\n", len(awarded)-limit)
+		metrics.rows = append(metrics.rows, []xlsxCell{xlsxText(metric.name), value})
 	}
+
+	return []xlsxSheet{awards, unfunded, ineligible, metrics}
 }
 
-func printUnfunded(unfunded []awardRecord, topN int, showAll bool) {
-	if len(unfunded) == 0 {
-		fmt.Println("\nNo eligible unfunded applicants.")
-		return
+// writeXLSX writes a minimal Office Open XML workbook, one worksheet per
+// sheet, using inline strings so no shared-string table is needed.
+func writeXLSX(path string, sheets []xlsxSheet) error {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	add := func(name, content string) error {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(entry, content)
+		return err
 	}
-	fmt.Println("\nUnfunded Eligible Applicants")
-	fmt.Println(strings.Repeat("-", 28))
-	limit := len(unfunded)
-	if !showAll && topN > 0 && topN < limit {
-		limit = topN
+
+	var overrides, sheetEntries, rels strings.Builder
+	for i := range sheets {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheetEntries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheets[i].name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheetEntries.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, struct{ name, content string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheetXML(sheet)})
 	}
-	for i := 0; i < limit; i++ {
-		item := unfunded[i]
-		label := item.ApplicantID
-		if item.Name != "" {
-			label = fmt.Sprintf("%s (%s)", item.Name, item.ApplicantID)
+	for _, part := range parts {
+		if err := add(part.name, part.content); err != nil {
+			return fmt.Errorf("write xlsx part %s: %w", part.name, err)
 		}
-		fmt.Printf("%d. %s | Need: %s | Score: %.1f | Requested: $%.2f | Priority: %.2f\n",
-			i+1, label, strings.Title(item.NeedLevel), item.Score, item.Requested, item.Priority)
 	}
-	if limit < len(unfunded) {
-		fmt.Printf("... %d more\n", len(unfunded)-limit)
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("close xlsx archive: %w", err)
 	}
+	return writeFileAtomic(path, func(out io.Writer) error {
+		if _, err := out.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("unable to write xlsx workbook: %w", err)
+		}
+		return nil
+	})
 }
 
-func printUnfundedByNeed(byNeed map[string]needUnfundedAgg) {
-	if len(byNeed) == 0 {
-		return
-	}
-	fmt.Println("\nUnfunded By Need Level")
-	fmt.Println(strings.Repeat("-", 23))
-	needKeys := []string{"high", "medium", "low"}
-	for _, level := range needKeys {
-		agg := byNeed[level]
-		fmt.Printf("%s: %d unfunded ($%.2f requested)\n", strings.Title(level), agg.Count, agg.Requested)
+func worksheetXML(sheet xlsxSheet) string {
+	var out strings.Builder
+	out.WriteString(xml.Header)
+	out.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range sheet.rows {
+		fmt.Fprintf(&out, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			switch {
+			case cell.currency:
+				fmt.Fprintf(&out, `<c r="%s" s="1"><v>%s</v></c>`, ref, strconv.FormatFloat(cell.number, 'f', -1, 64))
+			case cell.numeric:
+				fmt.Fprintf(&out, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(cell.number, 'f', -1, 64))
+			default:
+				fmt.Fprintf(&out, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(cell.text))
+			}
+		}
+		out.WriteString(`</row>`)
 	}
+	out.WriteString(`</sheetData></worksheet>`)
+	return out.String()
 }
 
-func writeJSON(path string, summary allocationSummary, awarded []*applicant) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("unable to create JSON output: %w", err)
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(summary); err != nil {
-		return fmt.Errorf("unable to write JSON output: %w", err)
+// xlsxColumn converts a zero-based column index to a spreadsheet column
+// name (0 is A, 26 is AA).
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
 	}
-	return nil
+	return name
 }
 
-func writeAwardsCSV(path string, awarded []*applicant) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("unable to create awards CSV: %w", err)
-	}
-	defer file.Close()
+func xmlEscape(value string) string {
+	var out strings.Builder
+	xml.EscapeText(&out, []byte(value))
+	return out.String()
+}
 
-	writer := csv.NewWriter(file)
-	if err := writer.Write([]string{"applicant_id", "name", "need_level", "score", "requested_amount", "awarded_amount", "priority"}); err != nil {
-		return fmt.Errorf("write awards CSV header: %w", err)
-	}
-	for _, item := range awarded {
-		row := []string{
-			item.ID,
-			item.Name,
-			item.NeedLevel,
-			formatFloat(item.ScoreRaw, 1),
-			formatFloat(item.Requested, 2),
-			formatFloat(item.Awarded, 2),
-			formatFloat(item.PriorityScore, 4),
+func writeCoverageLadderCSV(path string, steps []ladderStep) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		writer := csv.NewWriter(out)
+		if err := writer.Write([]string{"target_coverage", "reachable", "min_budget", "marginal_budget", "coverage_rate", "awarded_count"}); err != nil {
+			return fmt.Errorf("write coverage ladder CSV header: %w", err)
+		}
+		for _, step := range steps {
+			row := []string{
+				formatFloat(step.TargetCoverage, 2),
+				strconv.FormatBool(step.Reachable),
+				formatFloat(step.Budget, 2),
+				formatFloat(step.MarginalBudget, 2),
+				formatFloat(step.CoverageRate, 4),
+				strconv.Itoa(step.AwardedCount),
+			}
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("write coverage ladder CSV row: %w", err)
+			}
 		}
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("write awards CSV row: %w", err)
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("flush coverage ladder CSV: %w", err)
 		}
-	}
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return fmt.Errorf("flush awards CSV: %w", err)
-	}
-	return nil
+		return nil
+	})
 }
 
-func writeUnfundedCSV(path string, unfunded []awardRecord) error {
-	file, err := os.Create(path)
+type letterData struct {
+	ApplicantID      string
+	Name             string
+	NeedLevel        string
+	Score            float64
+	Requested        float64
+	Awarded          float64
+	PercentCovered   float64
+	GeneratedAt      string
+	AwardedDisplay   string
+	RequestDisplay   string
+	CoveredDisplay   string
+	NeedLevelDisplay string
+}
+
+// writeLetters renders the template once per funded applicant into dir. The
+// letter extension follows the template's (.md stays Markdown, else .txt).
+// writeLetters renders one letter per funded award and returns the paths
+// written.
+func writeLetters(dir, templatePath string, summary allocationSummary) ([]string, error) {
+	tmpl, err := template.ParseFiles(templatePath)
 	if err != nil {
-		return fmt.Errorf("unable to create unfunded CSV: %w", err)
+		return nil, fmt.Errorf("unable to parse letter template: %w", err)
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	if err := writer.Write([]string{"applicant_id", "name", "need_level", "score", "requested_amount", "priority"}); err != nil {
-		return fmt.Errorf("write unfunded CSV header: %w", err)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create letters directory: %w", err)
 	}
-	for _, item := range unfunded {
-		row := []string{
-			item.ApplicantID,
-			item.Name,
-			item.NeedLevel,
-			formatFloat(item.Score, 1),
-			formatFloat(item.Requested, 2),
-			formatFloat(item.Priority, 4),
+	ext := ".txt"
+	if strings.EqualFold(filepath.Ext(templatePath), ".md") {
+		ext = ".md"
+	}
+	var paths []string
+	for _, record := range summary.Awards {
+		if record.Awarded <= 0 {
+			continue
 		}
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("write unfunded CSV row: %w", err)
+		data := buildLetterData(record, summary.GeneratedAt)
+		var builder strings.Builder
+		if err := tmpl.Execute(&builder, data); err != nil {
+			return paths, fmt.Errorf("render letter for %s: %w", record.ApplicantID, err)
 		}
+		path := filepath.Join(dir, letterFileName(record.ApplicantID)+ext)
+		if err := os.WriteFile(path, []byte(builder.String()), 0o644); err != nil {
+			return paths, fmt.Errorf("write letter for %s: %w", record.ApplicantID, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func buildLetterData(record awardRecord, generatedAt string) letterData {
+	covered := 0.0
+	if record.Requested > 0 {
+		covered = record.Awarded / record.Requested
 	}
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return fmt.Errorf("flush unfunded CSV: %w", err)
+	name := record.Name
+	if name == "" {
+		name = record.ApplicantID
+	}
+	return letterData{
+		ApplicantID:      record.ApplicantID,
+		Name:             name,
+		NeedLevel:        record.NeedLevel,
+		Score:            record.Score,
+		Requested:        record.Requested,
+		Awarded:          record.Awarded,
+		PercentCovered:   covered * 100,
+		GeneratedAt:      generatedAt,
+		AwardedDisplay:   formatCurrency(record.Awarded),
+		RequestDisplay:   formatCurrency(record.Requested),
+		CoveredDisplay:   formatPercent(covered),
+		NeedLevelDisplay: strings.Title(record.NeedLevel),
 	}
-	return nil
 }
 
-func writeIneligibleCSV(path string, ineligible []ineligibleRecord) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("unable to create ineligible CSV: %w", err)
+// letterFileName keeps applicant IDs usable as file names by replacing any
+// character outside letters, digits, dot, dash, and underscore.
+func letterFileName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, id)
+	if name == "" || strings.Trim(name, ".") == "" {
+		return "applicant"
 	}
-	defer file.Close()
+	return name
+}
 
-	writer := csv.NewWriter(file)
-	if err := writer.Write([]string{"applicant_id", "name", "need_level", "score", "requested_amount", "eligibility_reason"}); err != nil {
-		return fmt.Errorf("write ineligible CSV header: %w", err)
+func writePromFile(path string, summary allocationSummary) error {
+	if err := os.WriteFile(path, []byte(formatPrometheus(summary)), 0o644); err != nil {
+		return fmt.Errorf("unable to write Prometheus metrics: %w", err)
 	}
-	for _, item := range ineligible {
-		row := []string{
-			item.ApplicantID,
-			item.Name,
-			item.NeedLevel,
-			formatFloat(item.Score, 1),
-			formatFloat(item.Requested, 2),
-			item.Reason,
+	return nil
+}
+
+// formatPrometheus renders summary gauges in the Prometheus text exposition
+// format read by the node_exporter textfile collector.
+func formatPrometheus(summary allocationSummary) string {
+	var builder strings.Builder
+	gauge := func(name, help string) {
+		fmt.Fprintf(&builder, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&builder, "# TYPE %s gauge\n", name)
+	}
+	sample := func(name, labels string, value float64) {
+		fmt.Fprintf(&builder, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	totals := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"gs_award_budget", "Total allocation budget.", summary.Budget},
+		{"gs_award_budget_used", "Budget allocated to awards.", summary.BudgetUsed},
+		{"gs_award_budget_left", "Budget remaining after allocation.", summary.BudgetLeft},
+		{"gs_award_applicants", "Applicants read from the input.", float64(summary.Applicants)},
+		{"gs_award_eligible", "Eligible applicants.", float64(summary.EligibleCount)},
+		{"gs_award_ineligible", "Ineligible applicants.", float64(summary.IneligibleCount)},
+		{"gs_award_awarded", "Applicants receiving an award.", float64(summary.AwardedCount)},
+		{"gs_award_fully_funded", "Applicants awarded their full request.", float64(summary.FullyFundedCount)},
+		{"gs_award_eligible_unfunded", "Eligible applicants without an award.", float64(summary.EligibleUnfundedCount)},
+		{"gs_award_eligible_unfunded_amount", "Requested amount of eligible unfunded applicants.", summary.EligibleUnfundedAmount},
+		{"gs_award_funding_gap", "Requested amount not covered by awards.", summary.FundingGapTotal},
+		{"gs_award_coverage_rate", "Awarded share of eligible requested amount.", summary.CoverageRate},
+		{"gs_award_full_funding_rate", "Share of eligible applicants fully funded.", summary.FullFundingRate},
+	}
+	for _, metric := range totals {
+		gauge(metric.name, metric.help)
+		sample(metric.name, "", metric.value)
+	}
+
+	needs := slices.Sorted(maps.Keys(summary.NeedCoverage))
+	if len(needs) > 0 {
+		gauge("gs_award_need_coverage_rate", "Awarded share of eligible requested amount by need level.")
+		for _, need := range needs {
+			sample("gs_award_need_coverage_rate", fmt.Sprintf("{need=%q}", need), summary.NeedCoverage[need].CoverageRate)
 		}
-		if err := writer.Write(row); err != nil {
-			return fmt.Errorf("write ineligible CSV row: %w", err)
+		gauge("gs_award_need_awarded_total", "Amount awarded by need level.")
+		for _, need := range needs {
+			sample("gs_award_need_awarded_total", fmt.Sprintf("{need=%q}", need), summary.NeedCoverage[need].AwardedTotal)
+		}
+		gauge("gs_award_need_unfunded", "Eligible unfunded applicants by need level.")
+		for _, need := range needs {
+			sample("gs_award_need_unfunded", fmt.Sprintf("{need=%q}", need), float64(summary.NeedCoverage[need].UnfundedCount))
 		}
 	}
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return fmt.Errorf("flush ineligible CSV: %w", err)
-	}
-	return nil
+	return builder.String()
 }
 
 func writeReport(path string, summary allocationSummary, topN int, showAll bool, unfundedTop int, showAllUnfunded bool) error {
@@ -1337,36 +6635,121 @@ func writeReport(path string, summary allocationSummary, topN int, showAll bool,
 
 	fmt.Fprintln(file, "# Award Allocation Report")
 	fmt.Fprintf(file, "\nGenerated: %s\n", summary.GeneratedAt)
+	if summary.Preview != nil {
+		fmt.Fprintf(file, "\n> **Preview:** %d of %d applicants (%s); budget scaled from %s to %s.\n",
+			summary.Preview.Sampled,
+			summary.Preview.Total,
+			previewMethod(summary.Preview),
+			formatCurrency(summary.Preview.FullBudget),
+			formatCurrency(summary.Budget),
+		)
+	}
 
 	fmt.Fprintln(file, "\n## Budget")
+	if summary.TermYears > 1 {
+		fmt.Fprintf(file, "- Term: %d years; budget, request, and award amounts are %d-year totals\n", summary.TermYears, summary.TermYears)
+	}
 	fmt.Fprintf(file, "- Budget: %s\n", formatCurrency(summary.Budget))
+	if summary.EffectiveBudgetNote != "" {
+		fmt.Fprintf(file, "- Effective budget: %s (%s)\n", formatCurrency(summary.EffectiveBudget), summary.EffectiveBudgetNote)
+	}
 	fmt.Fprintf(file, "- Budget used: %s\n", formatCurrency(summary.BudgetUsed))
+	if summary.TermYears > 1 {
+		fmt.Fprintf(file, "- Annual budget: %s\n", formatCurrency(summary.AnnualBudget))
+		fmt.Fprintf(file, "- Annual budget used: %s\n", formatCurrency(summary.AnnualBudgetUsed))
+		fmt.Fprintf(file, "- Annual eligible requested: %s\n", formatCurrency(summary.AnnualRequestedTotal))
+	}
+	if summary.TotalEffectiveAwarded != summary.BudgetUsed {
+		fmt.Fprintf(file, "- Effective awarded (with match): %s\n", formatCurrency(summary.TotalEffectiveAwarded))
+	}
 	fmt.Fprintf(file, "- Budget left: %s\n", formatCurrency(summary.BudgetLeft))
+	if summary.StrandedBudget > 0 {
+		fmt.Fprintf(file, "- Stranded budget: %s (below the minimum meaningful award)\n", formatCurrency(summary.StrandedBudget))
+	}
 
 	fmt.Fprintln(file, "\n## Eligibility")
 	fmt.Fprintf(file, "- Applicants: %d\n", summary.Applicants)
 	fmt.Fprintf(file, "- Eligible: %d\n", summary.EligibleCount)
 	fmt.Fprintf(file, "- Awarded: %d\n", summary.AwardedCount)
 	fmt.Fprintf(file, "- Ineligible: %d\n", summary.IneligibleCount)
+	if summary.DeclinedCount > 0 {
+		fmt.Fprintf(file, "- Declined offers: %d\n", summary.DeclinedCount)
+	}
 	fmt.Fprintf(file, "- Eligible unfunded: %d (%s requested)\n", summary.EligibleUnfundedCount, formatCurrency(summary.EligibleUnfundedAmount))
 	fmt.Fprintf(file, "- Eligible requested: %s\n", formatCurrency(summary.EligibleRequestedTotal))
 	fmt.Fprintf(file, "- Coverage rate: %s\n", formatPercent(summary.CoverageRate))
 	fmt.Fprintf(file, "- Fully funded: %d (%s of eligible)\n", summary.FullyFundedCount, formatPercent(summary.FullFundingRate))
-	fmt.Fprintf(file, "- Partially funded: %d\n", summary.PartiallyFundedCount)
+	if summary.IncludesIneligibleRates {
+		fmt.Fprintf(file, "- Coverage rate (all applicants): %s\n", formatPercent(summary.CoverageRateAll))
+		fmt.Fprintf(file, "- Fully funded (all applicants): %s\n", formatPercent(summary.FullFundingRateAll))
+	}
+	if summary.MaxPartial > 0 {
+		fmt.Fprintf(file, "- Partially funded: %d (max %d)\n", summary.PartiallyFundedCount, summary.MaxPartial)
+	} else {
+		fmt.Fprintf(file, "- Partially funded: %d\n", summary.PartiallyFundedCount)
+	}
 	fmt.Fprintf(file, "- Funding gap: %s\n", formatCurrency(summary.FundingGapTotal))
+	fmt.Fprintf(file, "- Gap closed per dollar: %s\n", formatFloat(summary.GapClosedPerDollar, 4))
 	fmt.Fprintf(file, "- Average award: %s\n", formatCurrency(summary.AverageAward))
 	fmt.Fprintf(file, "- Award percentiles: P25 %s | P50 %s | P75 %s\n", formatCurrency(summary.AwardP25), formatCurrency(summary.AwardP50), formatCurrency(summary.AwardP75))
 	fmt.Fprintf(file, "- Avg award/request: %s\n", formatPercent(summary.AwardToRequestAvg))
 	fmt.Fprintf(file, "- Award range: %s - %s\n", formatCurrency(summary.MinAwarded), formatCurrency(summary.MaxAwarded))
 
 	if summary.AwardedCount > 0 {
-		fmt.Fprintf(file, "- Last funded cutoff: %.2f priority | %.1f score | %s need | %s requested\n",
-			summary.LastFundedPriority,
+		fmt.Fprintf(file, "- Last funded cutoff: %s priority | %.1f score | %s need | %s requested\n",
+			formatFloat(summary.LastFundedPriority, summary.PriorityPrecision),
 			summary.LastFundedScore,
 			strings.Title(summary.LastFundedNeed),
 			formatCurrency(summary.LastFundedRequested),
 		)
 	}
+	if summary.EligibleUnfundedCount > 0 {
+		fmt.Fprintf(file, "- First unfunded: %s priority | %.1f score | %s need | %s requested\n",
+			formatFloat(summary.FirstUnfundedPriority, summary.PriorityPrecision),
+			summary.FirstUnfundedScore,
+			strings.Title(summary.FirstUnfundedNeed),
+			formatCurrency(summary.FirstUnfundedRequested),
+		)
+	}
+
+	if summary.SweptCount > 0 {
+		fmt.Fprintf(file, "- Budget sweep: %s topped up across %d awards\n", formatCurrency(summary.SweptAmount), summary.SweptCount)
+	}
+	if summary.TopupCount > 0 {
+		fmt.Fprintf(file, "- Leftover top-up: %s added across %d awards\n", formatCurrency(summary.TopupAmount), summary.TopupCount)
+	}
+	if summary.StretchShave > 0 {
+		fmt.Fprintf(file, "- Stretch: awards shaved %.0f%% to fund %d more applicants\n", summary.StretchShave*100, summary.StretchAddedCount)
+	}
+	for _, entry := range summary.LevelCaps {
+		fmt.Fprintf(file, "- %s need cap: %s of %s used\n", strings.Title(entry.NeedLevel), formatCurrency(entry.Used), formatCurrency(entry.Cap))
+	}
+	for _, warning := range summary.LevelCapWarnings {
+		fmt.Fprintf(file, "- Warning: %s\n", warning)
+	}
+	if summary.FlagCapped && summary.MaxCappedCount > 0 {
+		fmt.Fprintf(file, "- Max-capped: %d awards trimmed by the max award (%s below unmet need)\n", summary.MaxCappedCount, formatCurrency(summary.MaxCappedTrimmed))
+	}
+	if summary.RequestCappedCount > 0 {
+		fmt.Fprintf(file, "- Request cap: %d requests capped at %s for award computation\n", summary.RequestCappedCount, formatCurrency(summary.RequestCapAmount))
+	}
+	if summary.MedianAwardCap > 0 {
+		fmt.Fprintf(file, "- Median award cap: %s\n", formatCurrency(summary.MedianAwardCap))
+	}
+
+	fmt.Fprintln(file, "\n## Demand")
+	fmt.Fprintf(file, "- Requested total (eligible): %s\n", formatCurrency(summary.RequestedTotal))
+	fmt.Fprintf(file, "- Requested mean: %s\n", formatCurrency(summary.RequestedMean))
+	fmt.Fprintf(file, "- Request percentiles: P25 %s | P50 %s | P75 %s\n", formatCurrency(summary.RequestedP25), formatCurrency(summary.RequestedP50), formatCurrency(summary.RequestedP75))
+
+	if len(summary.PassBreakdown) > 0 {
+		fmt.Fprintln(file, "\n## Allocation Passes")
+		fmt.Fprintln(file, "| Pass | Spent | Applicants |")
+		fmt.Fprintln(file, "| --- | --- | --- |")
+		for _, pass := range summary.PassBreakdown {
+			fmt.Fprintf(file, "| %s | %s | %d |\n", pass.Name, formatCurrency(pass.Spent), pass.Funded)
+		}
+	}
 
 	fmt.Fprintln(file, "\n## Awards")
 	awardRows := limitAwardRecords(summary.Awards, topN, showAll)
@@ -1375,15 +6758,15 @@ func writeReport(path string, summary allocationSummary, topN int, showAll bool,
 	} else {
 		fmt.Fprintln(file, "| Rank | Applicant | Need | Score | Requested | Awarded | Priority |")
 		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- | --- |")
-		for i, item := range awardRows {
-			fmt.Fprintf(file, "| %d | %s | %s | %.1f | %s | %s | %.2f |\n",
-				i+1,
-				formatApplicantLabel(item.ApplicantID, item.Name),
+		for _, item := range awardRows {
+			fmt.Fprintf(file, "| %d | %s | %s | %.1f | %s | %s | %s |\n",
+				item.Rank,
+				formatApplicantLabel(item.ApplicantID, item.Name, summary.AnonymizeNames),
 				strings.Title(item.NeedLevel),
 				item.Score,
 				formatCurrency(item.Requested),
 				formatCurrency(item.Awarded),
-				item.Priority,
+				formatFloat(item.Priority, summary.PriorityPrecision),
 			)
 		}
 		if !showAll && topN > 0 && len(summary.Awards) > len(awardRows) {
@@ -1391,6 +6774,28 @@ func writeReport(path string, summary allocationSummary, topN int, showAll bool,
 		}
 	}
 
+	if len(summary.Boundary) > 0 {
+		fmt.Fprintln(file, "\n## Boundary")
+		fmt.Fprintf(file, "%d eligible applicants share the last-funded priority (%s); sort tie-breaking decided which were funded.\n\n",
+			len(summary.Boundary), formatFloat(summary.Boundary[0].Priority, summary.PriorityPrecision))
+		fmt.Fprintln(file, "| Applicant | Need | Score | Requested | Awarded | Funded |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- |")
+		for _, item := range summary.Boundary {
+			funded := "No"
+			if item.Funded {
+				funded = "Yes"
+			}
+			fmt.Fprintf(file, "| %s | %s | %.1f | %s | %s | %s |\n",
+				formatApplicantLabel(item.ApplicantID, item.Name, summary.AnonymizeNames),
+				strings.Title(item.NeedLevel),
+				item.Score,
+				formatCurrency(item.Requested),
+				formatCurrency(item.Awarded),
+				funded,
+			)
+		}
+	}
+
 	fmt.Fprintln(file, "\n## Unfunded Eligible Applicants")
 	unfundedRows := limitAwardRecords(summary.Unfunded, unfundedTop, showAllUnfunded)
 	if len(unfundedRows) == 0 {
@@ -1399,13 +6804,13 @@ func writeReport(path string, summary allocationSummary, topN int, showAll bool,
 		fmt.Fprintln(file, "| Rank | Applicant | Need | Score | Requested | Priority |")
 		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- |")
 		for i, item := range unfundedRows {
-			fmt.Fprintf(file, "| %d | %s | %s | %.1f | %s | %.2f |\n",
+			fmt.Fprintf(file, "| %d | %s | %s | %.1f | %s | %s |\n",
 				i+1,
-				formatApplicantLabel(item.ApplicantID, item.Name),
+				formatApplicantLabel(item.ApplicantID, item.Name, summary.AnonymizeNames),
 				strings.Title(item.NeedLevel),
 				item.Score,
 				formatCurrency(item.Requested),
-				item.Priority,
+				formatFloat(item.Priority, summary.PriorityPrecision),
 			)
 		}
 		if !showAllUnfunded && unfundedTop > 0 && len(summary.Unfunded) > len(unfundedRows) {
@@ -1414,22 +6819,183 @@ func writeReport(path string, summary allocationSummary, topN int, showAll bool,
 	}
 
 	fmt.Fprintln(file, "\n## Need Coverage")
-	fmt.Fprintln(file, "| Need Level | Eligible | Awarded | Unfunded | Requested | Awarded Total | Coverage |")
-	fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- | --- |")
+	fmt.Fprintln(file, "| Need Level | Eligible | Awarded | Unfunded | Requested | Awarded Total | Funding Gap | Coverage |")
+	fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- | --- | --- |")
 	needKeys := []string{"high", "medium", "low"}
 	for _, level := range needKeys {
 		agg := summary.NeedCoverage[level]
-		fmt.Fprintf(file, "| %s | %d | %d | %d | %s | %s | %s |\n",
+		fmt.Fprintf(file, "| %s | %d | %d | %d | %s | %s | %s | %s |\n",
 			strings.Title(level),
 			agg.EligibleCount,
 			agg.AwardedCount,
 			agg.UnfundedCount,
 			formatCurrency(agg.RequestedTotal),
 			formatCurrency(agg.AwardedTotal),
+			formatCurrency(agg.FundingGap),
 			formatPercent(agg.CoverageRate),
 		)
 	}
 
+	if len(summary.ByProgram) > 0 {
+		fmt.Fprintln(file, "\n## Program Budgets")
+		fmt.Fprintln(file, "| Program | Budget | Used | Left | Awarded | Unfunded | Coverage |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- | --- |")
+		for _, program := range slices.Sorted(maps.Keys(summary.ByProgram)) {
+			agg := summary.ByProgram[program]
+			fmt.Fprintf(file, "| %s | %s | %s | %s | %d | %d | %s |\n",
+				program,
+				formatCurrency(agg.Budget),
+				formatCurrency(agg.BudgetUsed),
+				formatCurrency(agg.BudgetLeft),
+				agg.AwardedCount,
+				agg.UnfundedCount,
+				formatPercent(agg.CoverageRate),
+			)
+		}
+	}
+
+	if len(summary.ByNeedBudget) > 0 {
+		fmt.Fprintln(file, "\n## Need-Level Budgets")
+		fmt.Fprintln(file, "| Need Level | Budget | Used | Left | Awarded | Unfunded |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- |")
+		for _, level := range []string{"high", "medium", "low"} {
+			agg := summary.ByNeedBudget[level]
+			fmt.Fprintf(file, "| %s | %s | %s | %s | %d | %d |\n",
+				strings.Title(level),
+				formatCurrency(agg.Budget),
+				formatCurrency(agg.BudgetUsed),
+				formatCurrency(agg.BudgetLeft),
+				agg.AwardedCount,
+				agg.UnfundedCount,
+			)
+		}
+	}
+
+	if len(summary.Representation) > 0 {
+		fmt.Fprintln(file, "\n## Minimum Representation")
+		fmt.Fprintln(file, "| Column | Value | Target | Awarded | Eligible | Awarded Total | Met |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- | --- |")
+		for _, result := range summary.Representation {
+			met := "yes"
+			if !result.Met {
+				met = "no"
+			}
+			fmt.Fprintf(file, "| %s | %s | %d | %d | %d | %s | %s |\n",
+				result.Column,
+				result.Value,
+				result.Target,
+				result.AwardedCount,
+				result.EligibleCount,
+				formatCurrency(result.AwardedTotal),
+				met,
+			)
+		}
+	}
+
+	if len(summary.ModeComparison) > 0 {
+		fmt.Fprintln(file, "\n## Allocation Mode Comparison")
+		fmt.Fprintln(file, "| Mode | Awarded | Coverage | Full Funding | Gini | Budget Used |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- |")
+		for _, result := range summary.ModeComparison {
+			fmt.Fprintf(file, "| %s | %d | %s | %s | %.3f | %s |\n",
+				result.Mode,
+				result.AwardedCount,
+				formatPercent(result.CoverageRate),
+				formatPercent(result.FullFundingRate),
+				result.Gini,
+				formatCurrency(result.BudgetUsed),
+			)
+		}
+	}
+
+	if len(summary.WeightSweep) > 0 {
+		fmt.Fprintln(file, "\n## Weight Sweep")
+		fmt.Fprintln(file, "| Score/Need | Awarded | Coverage | Full Funding | High Coverage | Medium Coverage | Low Coverage |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- | --- |")
+		for _, result := range summary.WeightSweep {
+			fmt.Fprintf(file, "| %s/%s | %d | %s | %s | %s | %s | %s |\n",
+				formatFloat(result.ScoreWeight, 2),
+				formatFloat(result.NeedWeight, 2),
+				result.AwardedCount,
+				formatPercent(result.CoverageRate),
+				formatPercent(result.FullFundingRate),
+				formatPercent(result.NeedCoverage["high"]),
+				formatPercent(result.NeedCoverage["medium"]),
+				formatPercent(result.NeedCoverage["low"]),
+			)
+		}
+	}
+
+	if summary.GroupBy != "" && len(summary.ByGroup) > 0 {
+		fmt.Fprintf(file, "\n## Coverage by %s\n", summary.GroupBy)
+		fmt.Fprintln(file, "| Group | Eligible | Awarded | Unfunded | Requested | Awarded Total | Coverage |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- | --- |")
+		for _, key := range slices.Sorted(maps.Keys(summary.ByGroup)) {
+			agg := summary.ByGroup[key]
+			fmt.Fprintf(file, "| %s | %d | %d | %d | %s | %s | %s |\n",
+				key,
+				agg.EligibleCount,
+				agg.AwardedCount,
+				agg.UnfundedCount,
+				formatCurrency(agg.RequestedTotal),
+				formatCurrency(agg.AwardedTotal),
+				formatPercent(agg.CoverageRate),
+			)
+		}
+	}
+
+	if summary.ShadowComparison != nil {
+		actual, shadow := summary.ShadowComparison.Actual, summary.ShadowComparison.Shadow
+		fmt.Fprintln(file, "\n## Actual vs Shadow Budget")
+		fmt.Fprintln(file, "| | Actual | Shadow |")
+		fmt.Fprintln(file, "| --- | --- | --- |")
+		fmt.Fprintf(file, "| Budget | %s | %s |\n", formatCurrency(actual.Budget), formatCurrency(shadow.Budget))
+		fmt.Fprintf(file, "| Awarded | %d | %d |\n", actual.AwardedCount, shadow.AwardedCount)
+		fmt.Fprintf(file, "| Unfunded | %d | %d |\n", actual.EligibleUnfundedCount, shadow.EligibleUnfundedCount)
+		fmt.Fprintf(file, "| Coverage | %s | %s |\n", formatPercent(actual.CoverageRate), formatPercent(shadow.CoverageRate))
+		fmt.Fprintf(file, "| Full funding | %s | %s |\n", formatPercent(actual.FullFundingRate), formatPercent(shadow.FullFundingRate))
+		fmt.Fprintf(file, "\nAdditional applicants funded at shadow budget: %+d\n", summary.ShadowComparison.AdditionalFunded)
+	}
+
+	if summary.Withdrawal != nil {
+		fmt.Fprintf(file, "\n## Withdrawal of %s\n", formatApplicantLabel(summary.Withdrawal.ApplicantID, summary.Withdrawal.Name, summary.AnonymizeNames))
+		fmt.Fprintf(file, "- Budget freed: %s\n", formatCurrency(summary.Withdrawal.BudgetFreed))
+		if len(summary.Withdrawal.Gains) == 0 {
+			fmt.Fprintln(file, "\n_No other applicant gains funding._")
+		} else {
+			fmt.Fprintln(file, "\n| Applicant | Before | After | Newly Funded |")
+			fmt.Fprintln(file, "| --- | --- | --- | --- |")
+			for _, gain := range summary.Withdrawal.Gains {
+				newly := "No"
+				if gain.NewlyFunded {
+					newly = "Yes"
+				}
+				fmt.Fprintf(file, "| %s | %s | %s | %s |\n",
+					formatApplicantLabel(gain.ApplicantID, gain.Name, summary.AnonymizeNames),
+					formatCurrency(gain.Before),
+					formatCurrency(gain.After),
+					newly,
+				)
+			}
+		}
+	}
+
+	if len(summary.Rounds) > 0 {
+		fmt.Fprintln(file, "\n## Allocation Rounds")
+		fmt.Fprintln(file, "| Round | Available | Offered | Declined | Returned | Budget Used |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- |")
+		for _, result := range summary.Rounds {
+			fmt.Fprintf(file, "| %d | %s | %d | %d | %s | %s |\n",
+				result.Round,
+				formatCurrency(result.BudgetAvailable),
+				result.Offered,
+				result.Declined,
+				formatCurrency(result.DeclinedAmount),
+				formatCurrency(result.BudgetUsed),
+			)
+		}
+	}
+
 	if len(summary.ScenarioResults) > 0 {
 		fmt.Fprintln(file, "\n## Scenario Analysis")
 		fmt.Fprintln(file, "| Budget | Awarded | Unfunded | Coverage | Full Funding | Budget Used | Budget Left |")
@@ -1447,17 +7013,199 @@ func writeReport(path string, summary allocationSummary, topN int, showAll bool,
 		}
 	}
 
-	if len(summary.IneligibleReasonSummary) > 0 {
-		fmt.Fprintln(file, "\n## Ineligible Reasons")
-		reasonRows := sortReasonSummary(summary.IneligibleReasonSummary)
-		for _, item := range reasonRows {
-			fmt.Fprintf(file, "- %s: %d\n", item.Reason, item.Count)
+	if len(summary.CoverageLadder) > 0 {
+		fmt.Fprintln(file, "\n## Coverage Ladder")
+		fmt.Fprintln(file, "| Target | Min Budget | Marginal | Coverage | Awarded |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- |")
+		for _, step := range summary.CoverageLadder {
+			if !step.Reachable {
+				fmt.Fprintf(file, "| %s | unreachable | - | - | - |\n", formatPercent(step.TargetCoverage))
+				continue
+			}
+			fmt.Fprintf(file, "| %s | %s | %s | %s | %d |\n",
+				formatPercent(step.TargetCoverage),
+				formatCurrency(step.Budget),
+				formatCurrency(step.MarginalBudget),
+				formatPercent(step.CoverageRate),
+				step.AwardedCount,
+			)
+		}
+	}
+
+	if len(summary.ConstraintSummary) > 0 && summary.AwardedCount > 0 {
+		fmt.Fprintln(file, "\n## Binding Constraints")
+		for _, constraint := range constraintOrder {
+			if count := summary.ConstraintSummary[constraint]; count > 0 {
+				fmt.Fprintf(file, "- %s: %d (%s of awards)\n", constraint, count, formatPercent(float64(count)/float64(summary.AwardedCount)))
+			}
+		}
+	}
+
+	if len(summary.IneligibleReasonSummary) > 0 {
+		fmt.Fprintln(file, "\n## Ineligible Reasons")
+		reasonRows, hidden := limitReasonSummary(sortReasonSummary(summary.IneligibleReasonSummary), summary.IneligibleReasonsTop)
+		for _, item := range reasonRows {
+			fmt.Fprintf(file, "- %s: %d\n", item.Reason, item.Count)
+		}
+		if hidden > 0 {
+			fmt.Fprintf(file, "- ... %d more\n", hidden)
+		}
+	}
+
+	if len(summary.NearMisses) > 0 {
+		fmt.Fprintln(file, "\n## Near Misses")
+		fmt.Fprintln(file, "Applicants excluded only by the minimum score, highest score first.")
+		fmt.Fprintln(file)
+		fmt.Fprintln(file, "| Applicant | Need | Score | Minimum | Below By | Requested |")
+		fmt.Fprintln(file, "| --- | --- | --- | --- | --- | --- |")
+		for _, item := range summary.NearMisses {
+			fmt.Fprintf(file, "| %s | %s | %.1f | %.1f | %.1f | %s |\n",
+				formatApplicantLabel(item.ApplicantID, item.Name, summary.AnonymizeNames),
+				strings.Title(item.NeedLevel),
+				item.Score,
+				item.Threshold,
+				item.BelowBy,
+				formatCurrency(item.Requested),
+			)
+		}
+	}
+
+	return nil
+}
+
+type runManifest struct {
+	GeneratedAt string     `json:"generated_at"`
+	InputPath   string     `json:"input_path"`
+	InputSHA256 string     `json:"input_sha256"`
+	Options     runOptions `json:"options"`
+}
+
+func buildManifest(generatedAt, inputPath string, opts runOptions) (runManifest, error) {
+	hash, err := fileSHA256(inputPath)
+	if err != nil {
+		return runManifest{}, err
+	}
+	return runManifest{
+		GeneratedAt: generatedAt,
+		InputPath:   inputPath,
+		InputSHA256: hash,
+		Options:     opts,
+	}, nil
+}
+
+func writeManifest(path string, manifest runManifest) error {
+	return writeFileAtomic(path, func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(manifest); err != nil {
+			return fmt.Errorf("unable to write manifest: %w", err)
+		}
+		return nil
+	})
+}
+
+// outputFile is one artifact listed in the outputs manifest.
+type outputFile struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	SHA256 string `json:"sha256"`
+}
+
+type outputsManifest struct {
+	GeneratedAt string       `json:"generated_at"`
+	Files       []outputFile `json:"files"`
+}
+
+// writeOutputsManifest hashes each written output so pipelines can check that
+// every expected artifact exists and was not truncated.
+func writeOutputsManifest(path, generatedAt string, files []outputFile) error {
+	manifest := outputsManifest{GeneratedAt: generatedAt, Files: make([]outputFile, 0, len(files))}
+	for _, entry := range files {
+		hash, err := fileSHA256(entry.Path)
+		if err != nil {
+			return err
+		}
+		entry.SHA256 = hash
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	return writeFileAtomic(path, func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(manifest); err != nil {
+			return fmt.Errorf("unable to write outputs manifest: %w", err)
 		}
-	}
+		return nil
+	})
+}
+
+func loadManifest(path string) (runManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return runManifest{}, fmt.Errorf("unable to read manifest: %w", err)
+	}
+	// Options missing from older manifests keep their flag defaults.
+	manifest := runManifest{Options: runOptions{
+		AmountScale:    1,
+		Rounds:         1,
+		MinScoreHigh:   -1,
+		MinScoreMedium: -1,
+		MinScoreLow:    -1,
+	}}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return runManifest{}, fmt.Errorf("unable to parse manifest: %w", err)
+	}
+	if manifest.InputPath == "" {
+		return runManifest{}, errors.New("manifest is missing input_path")
+	}
+	return manifest, nil
+}
 
+func verifyManifestInput(manifest runManifest, ignoreHash bool) error {
+	if ignoreHash {
+		return nil
+	}
+	if manifest.InputSHA256 == "" {
+		return errors.New("manifest is missing input_sha256 (use -ignore-hash to skip verification)")
+	}
+	hash, err := fileSHA256(manifest.InputPath)
+	if err != nil {
+		return err
+	}
+	if hash != manifest.InputSHA256 {
+		return fmt.Errorf("input hash mismatch for %s: manifest %s, file %s (use -ignore-hash to override)", manifest.InputPath, manifest.InputSHA256, hash)
+	}
 	return nil
 }
 
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to open %s for hashing: %w", path, err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("unable to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func formatTimestamp(value time.Time, format string, location *time.Location) string {
+	layout := format
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "rfc3339":
+		layout = time.RFC3339
+	case "date":
+		layout = "2006-01-02"
+	}
+	if location != nil {
+		value = value.In(location)
+	}
+	return value.Format(layout)
+}
+
 func formatFloat(value float64, decimals int) string {
 	return strconv.FormatFloat(value, 'f', decimals, 64)
 }
@@ -1470,13 +7218,83 @@ func formatPercent(value float64) string {
 	return fmt.Sprintf("%.1f%%", value*100)
 }
 
-func formatApplicantLabel(id, name string) string {
+func formatApplicantLabel(id, name string, anonymize bool) string {
+	if anonymize {
+		name = maskName(name)
+	}
 	if name == "" {
 		return id
 	}
 	return fmt.Sprintf("%s (%s)", name, id)
 }
 
+// maskName reduces a name to its initials (e.g. "Jordan Lee" becomes "J. L.")
+// for output shown on shared screens.
+func maskName(name string) string {
+	var initials []string
+	for _, part := range strings.Fields(name) {
+		first := []rune(part)[0]
+		initials = append(initials, strings.ToUpper(string(first))+".")
+	}
+	return strings.Join(initials, " ")
+}
+
+var awardSortFields = []string{"priority", "name", "need", "awarded-desc", "id"}
+
+func validAwardSort(field string) bool {
+	for _, candidate := range awardSortFields {
+		if field == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// sortAwardRecords reorders award records for display only. Ties, and the
+// default priority order, fall back to the funding rank.
+func sortAwardRecords(records []awardRecord, field string) {
+	needRank := map[string]int{"high": 0, "medium": 1, "low": 2}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		switch field {
+		case "name":
+			if !strings.EqualFold(a.Name, b.Name) {
+				return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+			}
+		case "need":
+			if needRank[a.NeedLevel] != needRank[b.NeedLevel] {
+				return needRank[a.NeedLevel] < needRank[b.NeedLevel]
+			}
+		case "awarded-desc":
+			if a.Awarded != b.Awarded {
+				return a.Awarded > b.Awarded
+			}
+		case "id":
+			if a.ApplicantID != b.ApplicantID {
+				return a.ApplicantID < b.ApplicantID
+			}
+		}
+		return a.Rank < b.Rank
+	})
+}
+
+// sortOutputByID returns a copy of summary whose awards, unfunded, and
+// ineligible lists are ordered by applicant ID, so files from two runs diff
+// cleanly. The console keeps using the original summary.
+func sortOutputByID(summary allocationSummary) allocationSummary {
+	summary.Awards = append([]awardRecord(nil), summary.Awards...)
+	sortAwardRecords(summary.Awards, "id")
+	summary.Unfunded = append([]awardRecord(nil), summary.Unfunded...)
+	sort.SliceStable(summary.Unfunded, func(i, j int) bool {
+		return summary.Unfunded[i].ApplicantID < summary.Unfunded[j].ApplicantID
+	})
+	summary.Ineligible = append([]ineligibleRecord(nil), summary.Ineligible...)
+	sort.SliceStable(summary.Ineligible, func(i, j int) bool {
+		return summary.Ineligible[i].ApplicantID < summary.Ineligible[j].ApplicantID
+	})
+	return summary
+}
+
 func limitAwardRecords(records []awardRecord, limit int, showAll bool) []awardRecord {
 	if showAll || limit <= 0 || limit >= len(records) {
 		return records
@@ -1503,6 +7321,15 @@ func sortReasonSummary(reasons map[string]int) []reasonSummary {
 	return list
 }
 
+// limitReasonSummary keeps the first top reasons and reports how many were
+// left out. A top of 0 keeps them all.
+func limitReasonSummary(list []reasonSummary, top int) ([]reasonSummary, int) {
+	if top <= 0 || top >= len(list) {
+		return list, 0
+	}
+	return list[:top], len(list) - top
+}
+
 func percentile(values []float64, p float64) float64 {
 	if len(values) == 0 {
 		return 0
@@ -1568,23 +7395,173 @@ type dbConfig struct {
 	Schema  string
 }
 
-type dbRunOptions struct {
-	MinAward      float64
-	MaxAward      float64
-	MinHigh       float64
-	MaxHigh       float64
-	MinMedium     float64
-	MaxMedium     float64
-	MinLow        float64
-	MaxLow        float64
-	ScoreWeight   float64
-	NeedWeight    float64
-	ReserveHigh   float64
-	ReserveMedium float64
-	ReserveLow    float64
-	RoundTo       float64
-	MaxPercent    float64
-	MinScore      float64
+type runOptions struct {
+	Budget          float64            `json:"budget"`
+	MinAward        float64            `json:"min_award"`
+	MaxAward        float64            `json:"max_award"`
+	MinHigh         float64            `json:"min_high"`
+	MaxHigh         float64            `json:"max_high"`
+	MinMedium       float64            `json:"min_medium"`
+	MaxMedium       float64            `json:"max_medium"`
+	MinLow          float64            `json:"min_low"`
+	MaxLow          float64            `json:"max_low"`
+	ScoreWeight     float64            `json:"score_weight"`
+	NeedWeight      float64            `json:"need_weight"`
+	RequestWeight   float64            `json:"request_weight"`
+	EfficiencyBias  float64            `json:"efficiency_bias"`
+	RepeatPenalty   float64            `json:"repeat_penalty"`
+	PrioritySource  string             `json:"priority_source,omitempty"`
+	RankWeight      float64            `json:"rank_weight,omitempty"`
+	ScoreMaxRef     float64            `json:"score_max_ref"`
+	ReserveHigh     float64            `json:"reserve_high"`
+	ReserveMedium   float64            `json:"reserve_medium"`
+	ReserveLow      float64            `json:"reserve_low"`
+	CapHighAmount   float64            `json:"cap_high_amount,omitempty"`
+	CapMediumAmount float64            `json:"cap_medium_amount,omitempty"`
+	CapLowAmount    float64            `json:"cap_low_amount,omitempty"`
+	ReserveMode     string             `json:"reserve_mode,omitempty"`
+	RoundTo         float64            `json:"round_to"`
+	RoundSet        []float64          `json:"round_set,omitempty"`
+	AwardIncrement  float64            `json:"award_increment,omitempty"`
+	NeedBins        []float64          `json:"need_bins,omitempty"`
+	NeedCodes       map[string]string  `json:"need_codes,omitempty"`
+	NormalizeIDs    bool               `json:"normalize_ids,omitempty"`
+	IDStrip         string             `json:"id_strip,omitempty"`
+	AsOf            string             `json:"as_of,omitempty"`
+	MaxPercent      float64            `json:"max_percent"`
+	MedianMultiple  float64            `json:"max_award_median_multiple,omitempty"`
+	MaxSpendPct     float64            `json:"max_spend_percent,omitempty"`
+	MinScore        float64            `json:"min_score"`
+	MinScoreHigh    float64            `json:"min_score_high"`
+	MinScoreMedium  float64            `json:"min_score_medium"`
+	MinScoreLow     float64            `json:"min_score_low"`
+	EligibleTopPct  float64            `json:"eligible_top_percent,omitempty"`
+	AmountScale     float64            `json:"amount_scale"`
+	DecimalComma    bool               `json:"decimal_comma,omitempty"`
+	RequestCapPct   float64            `json:"request_cap_percentile"`
+	Sweep           bool               `json:"sweep"`
+	TopupLeftover   bool               `json:"topup_leftover,omitempty"`
+	StretchPct      float64            `json:"stretch_percent,omitempty"`
+	MaxPartial      int                `json:"max_partial,omitempty"`
+	TierStrict      bool               `json:"tier_strict"`
+	Tiebreak        []string           `json:"tiebreak,omitempty"`
+	MinMeaningful   float64            `json:"min_meaningful_award"`
+	Rounds          int                `json:"rounds"`
+	TermYears       int                `json:"term_years"`
+	DeclinedIDs     []string           `json:"declined_ids,omitempty"`
+	ProgramBudgets  map[string]float64 `json:"program_budgets,omitempty"`
+	BudgetHigh      float64            `json:"budget_high,omitempty"`
+	BudgetMedium    float64            `json:"budget_medium,omitempty"`
+	BudgetLow       float64            `json:"budget_low,omitempty"`
+	MinRepresent    []representRule    `json:"min_represent,omitempty"`
+	ScenarioBudgets []float64          `json:"scenario_budgets,omitempty"`
+
+	// medianAwardCap is derived from MedianMultiple and the loaded cohort
+	// before allocation; it is not part of the recorded options.
+	medianAwardCap float64
+	// stretchFactor scales planned awards during a stretched allocation; 0
+	// or 1 leaves them unchanged.
+	stretchFactor float64
+}
+
+// applyOptionOverrides replaces stored run options with the values of flags
+// that were set explicitly on the command line.
+func applyOptionOverrides(stored, flagged runOptions, set map[string]bool) runOptions {
+	overrides := map[string]func(){
+		"budget":                 func() { stored.Budget = flagged.Budget },
+		"min":                    func() { stored.MinAward = flagged.MinAward },
+		"max":                    func() { stored.MaxAward = flagged.MaxAward },
+		"min-high":               func() { stored.MinHigh = flagged.MinHigh },
+		"max-high":               func() { stored.MaxHigh = flagged.MaxHigh },
+		"min-medium":             func() { stored.MinMedium = flagged.MinMedium },
+		"max-medium":             func() { stored.MaxMedium = flagged.MaxMedium },
+		"min-low":                func() { stored.MinLow = flagged.MinLow },
+		"max-low":                func() { stored.MaxLow = flagged.MaxLow },
+		"score-weight":           func() { stored.ScoreWeight = flagged.ScoreWeight },
+		"need-weight":            func() { stored.NeedWeight = flagged.NeedWeight },
+		"request-weight":         func() { stored.RequestWeight = flagged.RequestWeight },
+		"efficiency-bias":        func() { stored.EfficiencyBias = flagged.EfficiencyBias },
+		"repeat-penalty":         func() { stored.RepeatPenalty = flagged.RepeatPenalty },
+		"score-max-ref":          func() { stored.ScoreMaxRef = flagged.ScoreMaxRef },
+		"reserve-high":           func() { stored.ReserveHigh = flagged.ReserveHigh },
+		"reserve-medium":         func() { stored.ReserveMedium = flagged.ReserveMedium },
+		"reserve-low":            func() { stored.ReserveLow = flagged.ReserveLow },
+		"cap-high-amount":        func() { stored.CapHighAmount = flagged.CapHighAmount },
+		"cap-medium-amount":      func() { stored.CapMediumAmount = flagged.CapMediumAmount },
+		"cap-low-amount":         func() { stored.CapLowAmount = flagged.CapLowAmount },
+		"round":                  func() { stored.RoundTo = flagged.RoundTo },
+		"round-to-set":           func() { stored.RoundSet = flagged.RoundSet },
+		"award-increment":        func() { stored.AwardIncrement = flagged.AwardIncrement },
+		"need-bins":              func() { stored.NeedBins = flagged.NeedBins },
+		"need-codes":             func() { stored.NeedCodes = flagged.NeedCodes },
+		"normalize-ids":          func() { stored.NormalizeIDs = flagged.NormalizeIDs },
+		"id-strip":               func() { stored.IDStrip = flagged.IDStrip },
+		"as-of":                  func() { stored.AsOf = flagged.AsOf },
+		"max-percent":            func() { stored.MaxPercent = flagged.MaxPercent },
+		"min-score":              func() { stored.MinScore = flagged.MinScore },
+		"min-score-high":         func() { stored.MinScoreHigh = flagged.MinScoreHigh },
+		"min-score-medium":       func() { stored.MinScoreMedium = flagged.MinScoreMedium },
+		"min-score-low":          func() { stored.MinScoreLow = flagged.MinScoreLow },
+		"eligible-top-percent":   func() { stored.EligibleTopPct = flagged.EligibleTopPct },
+		"request-cap-percentile": func() { stored.RequestCapPct = flagged.RequestCapPct },
+		"sweep":                  func() { stored.Sweep = flagged.Sweep },
+		"topup-leftover":         func() { stored.TopupLeftover = flagged.TopupLeftover },
+		"stretch-percent":        func() { stored.StretchPct = flagged.StretchPct },
+		"max-partial":            func() { stored.MaxPartial = flagged.MaxPartial },
+		"tier-strict":            func() { stored.TierStrict = flagged.TierStrict },
+		"reserve-mode":           func() { stored.ReserveMode = flagged.ReserveMode },
+		"priority-source":        func() { stored.PrioritySource = flagged.PrioritySource },
+		"rank-weight":            func() { stored.RankWeight = flagged.RankWeight },
+		"tiebreak":               func() { stored.Tiebreak = flagged.Tiebreak },
+		"min-meaningful-award":   func() { stored.MinMeaningful = flagged.MinMeaningful },
+		"rounds":                 func() { stored.Rounds = flagged.Rounds },
+		"term-years":             func() { stored.TermYears = flagged.TermYears },
+		"declined-ids":           func() { stored.DeclinedIDs = flagged.DeclinedIDs },
+		"program-budgets": func() {
+			stored.ProgramBudgets = flagged.ProgramBudgets
+			stored.Budget = flagged.Budget
+		},
+		"budget-high": func() {
+			stored.BudgetHigh = flagged.BudgetHigh
+			stored.Budget = flagged.Budget
+		},
+		"budget-medium": func() {
+			stored.BudgetMedium = flagged.BudgetMedium
+			stored.Budget = flagged.Budget
+		},
+		"budget-low": func() {
+			stored.BudgetLow = flagged.BudgetLow
+			stored.Budget = flagged.Budget
+		},
+		"max-award-median-multiple": func() { stored.MedianMultiple = flagged.MedianMultiple },
+		"max-spend-percent":         func() { stored.MaxSpendPct = flagged.MaxSpendPct },
+		"min-represent":             func() { stored.MinRepresent = flagged.MinRepresent },
+		"scenario-budgets":          func() { stored.ScenarioBudgets = flagged.ScenarioBudgets },
+	}
+	for name, apply := range overrides {
+		if set[name] {
+			apply()
+		}
+	}
+	return stored
+}
+
+// resolveBudget picks the budget from -budget when it was set explicitly,
+// otherwise from GS_AWARD_ALLOCATOR_BUDGET, so sensitive budgets can stay out
+// of process listings. It also names the source for verbose output.
+func resolveBudget(flagValue float64, flagSet bool) (float64, string, error) {
+	if flagSet {
+		return flagValue, "flag", nil
+	}
+	raw := strings.TrimSpace(os.Getenv("GS_AWARD_ALLOCATOR_BUDGET"))
+	if raw == "" {
+		return flagValue, "unset", nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid GS_AWARD_ALLOCATOR_BUDGET %q", raw)
+	}
+	return value, "environment (GS_AWARD_ALLOCATOR_BUDGET)", nil
 }
 
 func loadDBConfig() (dbConfig, error) {
@@ -1621,7 +7598,7 @@ func sanitizeIdentifier(value string) (string, error) {
 	return value, nil
 }
 
-func logRunToDatabase(ctx context.Context, cfg dbConfig, summary allocationSummary, applicants []*applicant, inputPath string, opts dbRunOptions) error {
+func logRunToDatabase(ctx context.Context, cfg dbConfig, summary allocationSummary, applicants []*applicant, inputPath string, opts runOptions) error {
 	pool, err := pgxpool.New(ctx, cfg.URL)
 	if err != nil {
 		return fmt.Errorf("open pool: %w", err)
@@ -1632,26 +7609,32 @@ func logRunToDatabase(ctx context.Context, cfg dbConfig, summary allocationSumma
 		return err
 	}
 
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	runID := uuid.New()
-	if err := insertRun(ctx, pool, cfg.Schema, runID, summary, inputPath, opts); err != nil {
+	if err := insertRun(ctx, tx, cfg.Schema, runID, summary, inputPath, opts); err != nil {
 		return err
 	}
-	if err := insertApplicants(ctx, pool, cfg.Schema, runID, applicants); err != nil {
+	if err := insertApplicants(ctx, tx, cfg.Schema, runID, applicants); err != nil {
 		return err
 	}
-	if err := insertNeedCoverage(ctx, pool, cfg.Schema, runID, summary.NeedCoverage); err != nil {
+	if err := insertNeedCoverage(ctx, tx, cfg.Schema, runID, summary.NeedCoverage); err != nil {
 		return err
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
-func ensureDBSchema(ctx context.Context, pool *pgxpool.Pool, schema string) error {
-	_, err := pool.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schema))
-	if err != nil {
-		return fmt.Errorf("create schema: %w", err)
-	}
-
-	runTable := fmt.Sprintf(`
+// The schema DDL templates take the schema name for each %s. They are also
+// parsed by expectedColumnTypes, so a column added here is checked too.
+const (
+	runTableDDL = `
 CREATE TABLE IF NOT EXISTS %s.runs (
   run_id uuid PRIMARY KEY,
   generated_at timestamptz NOT NULL,
@@ -1678,12 +7661,20 @@ CREATE TABLE IF NOT EXISTS %s.runs (
   award_p50 numeric NOT NULL,
   award_p75 numeric NOT NULL,
   award_to_request_avg numeric NOT NULL,
+  requested_mean numeric NOT NULL DEFAULT 0,
+  requested_p25 numeric NOT NULL DEFAULT 0,
+  requested_p50 numeric NOT NULL DEFAULT 0,
+  requested_p75 numeric NOT NULL DEFAULT 0,
   min_awarded numeric NOT NULL,
   max_awarded numeric NOT NULL,
   last_funded_priority numeric NOT NULL,
   last_funded_score numeric NOT NULL,
   last_funded_need text NOT NULL,
   last_funded_requested numeric NOT NULL,
+  first_unfunded_priority numeric NOT NULL DEFAULT 0,
+  first_unfunded_score numeric NOT NULL DEFAULT 0,
+  first_unfunded_need text NOT NULL DEFAULT '',
+  first_unfunded_requested numeric NOT NULL DEFAULT 0,
   min_award_option numeric NOT NULL,
   max_award_option numeric NOT NULL,
   min_high numeric NOT NULL,
@@ -1694,22 +7685,47 @@ CREATE TABLE IF NOT EXISTS %s.runs (
   max_low numeric NOT NULL,
   score_weight numeric NOT NULL,
   need_weight numeric NOT NULL,
+  request_weight numeric NOT NULL DEFAULT 0,
+  efficiency_bias numeric NOT NULL DEFAULT 0,
+  score_max_ref numeric NOT NULL DEFAULT 0,
   reserve_high numeric NOT NULL,
   reserve_medium numeric NOT NULL,
   reserve_low numeric NOT NULL,
+  cap_high_amount numeric NOT NULL DEFAULT 0,
+  cap_medium_amount numeric NOT NULL DEFAULT 0,
+  cap_low_amount numeric NOT NULL DEFAULT 0,
   round_to numeric NOT NULL,
   max_percent numeric NOT NULL,
   min_score numeric NOT NULL,
+  min_score_high numeric NOT NULL DEFAULT -1,
+  min_score_medium numeric NOT NULL DEFAULT -1,
+  min_score_low numeric NOT NULL DEFAULT -1,
+  eligible_top_percent numeric NOT NULL DEFAULT 0,
+  amount_scale numeric NOT NULL DEFAULT 1,
+  request_cap_percentile numeric NOT NULL DEFAULT 0,
+  rounds int NOT NULL DEFAULT 1,
+  term_years int NOT NULL DEFAULT 1,
+  sweep boolean NOT NULL DEFAULT false,
+  topup_leftover boolean NOT NULL DEFAULT false,
+  stretch_percent numeric NOT NULL DEFAULT 0,
+  max_partial integer NOT NULL DEFAULT 0,
+  budget_high numeric NOT NULL DEFAULT 0,
+  budget_medium numeric NOT NULL DEFAULT 0,
+  budget_low numeric NOT NULL DEFAULT 0,
+  tier_strict boolean NOT NULL DEFAULT false,
+  min_meaningful_award numeric NOT NULL DEFAULT 0,
+  tiebreak text NOT NULL DEFAULT 'score',
+  repeat_penalty numeric NOT NULL DEFAULT 0,
+  reserve_mode text NOT NULL DEFAULT 'priority',
+  priority_source text NOT NULL DEFAULT 'computed',
+  rank_weight numeric NOT NULL DEFAULT 0,
+  award_increment numeric NOT NULL DEFAULT 0,
+  max_award_median_multiple numeric NOT NULL DEFAULT 0,
+  max_spend_percent numeric NOT NULL DEFAULT 0,
+  effective_budget numeric NOT NULL DEFAULT 0,
   created_at timestamptz NOT NULL DEFAULT now()
-);`, schema)
-	if _, err := pool.Exec(ctx, runTable); err != nil {
-		return fmt.Errorf("create runs table: %w", err)
-	}
-	if err := ensureRunColumns(ctx, pool, schema); err != nil {
-		return err
-	}
-
-	applicantTable := fmt.Sprintf(`
+);`
+	applicantTableDDL = `
 CREATE TABLE IF NOT EXISTS %s.applicants (
   id bigserial PRIMARY KEY,
   run_id uuid NOT NULL REFERENCES %s.runs(run_id) ON DELETE CASCADE,
@@ -1720,20 +7736,18 @@ CREATE TABLE IF NOT EXISTS %s.applicants (
   score_norm numeric,
   priority numeric,
   requested numeric,
+  other_aid numeric NOT NULL DEFAULT 0,
+  cost_of_attendance numeric NOT NULL DEFAULT 0,
   awarded numeric,
   eligible boolean,
-  eligibility_msg text
-);`, schema, schema)
-	if _, err := pool.Exec(ctx, applicantTable); err != nil {
-		return fmt.Errorf("create applicants table: %w", err)
-	}
-
-	indexSQL := fmt.Sprintf("CREATE INDEX IF NOT EXISTS applicants_run_id_idx ON %s.applicants(run_id);", schema)
-	if _, err := pool.Exec(ctx, indexSQL); err != nil {
-		return fmt.Errorf("create index: %w", err)
-	}
-
-	needCoverageTable := fmt.Sprintf(`
+  eligibility_msg text,
+  fte numeric NOT NULL DEFAULT 1
+);`
+	applicantColumnsDDL = `ALTER TABLE %s.applicants
+  ADD COLUMN IF NOT EXISTS other_aid numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS cost_of_attendance numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS fte numeric NOT NULL DEFAULT 1;`
+	needCoverageTableDDL = `
 CREATE TABLE IF NOT EXISTS %s.need_coverage (
   id bigserial PRIMARY KEY,
   run_id uuid NOT NULL REFERENCES %s.runs(run_id) ON DELETE CASCADE,
@@ -1743,28 +7757,13 @@ CREATE TABLE IF NOT EXISTS %s.need_coverage (
   unfunded_count int NOT NULL,
   requested_total numeric NOT NULL,
   awarded_total numeric NOT NULL,
+  funding_gap numeric NOT NULL DEFAULT 0,
   coverage_rate numeric NOT NULL,
   requested_share numeric NOT NULL,
   awarded_share numeric NOT NULL,
   share_delta numeric NOT NULL
-);`, schema, schema)
-	if _, err := pool.Exec(ctx, needCoverageTable); err != nil {
-		return fmt.Errorf("create need_coverage table: %w", err)
-	}
-
-	if err := ensureNeedCoverageColumns(ctx, pool, schema); err != nil {
-		return err
-	}
-
-	coverageIndex := fmt.Sprintf("CREATE INDEX IF NOT EXISTS need_coverage_run_id_idx ON %s.need_coverage(run_id);", schema)
-	if _, err := pool.Exec(ctx, coverageIndex); err != nil {
-		return fmt.Errorf("create need_coverage index: %w", err)
-	}
-	return nil
-}
-
-func ensureRunColumns(ctx context.Context, pool *pgxpool.Pool, schema string) error {
-	alter := fmt.Sprintf(`
+);`
+	runColumnsDDL = `
 ALTER TABLE %s.runs
   ADD COLUMN IF NOT EXISTS eligible_count int NOT NULL DEFAULT 0,
   ADD COLUMN IF NOT EXISTS fully_funded_count int NOT NULL DEFAULT 0,
@@ -1779,6 +7778,10 @@ ALTER TABLE %s.runs
   ADD COLUMN IF NOT EXISTS last_funded_score numeric NOT NULL DEFAULT 0,
   ADD COLUMN IF NOT EXISTS last_funded_need text NOT NULL DEFAULT '',
   ADD COLUMN IF NOT EXISTS last_funded_requested numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS first_unfunded_priority numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS first_unfunded_score numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS first_unfunded_need text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS first_unfunded_requested numeric NOT NULL DEFAULT 0,
   ADD COLUMN IF NOT EXISTS budget_required_full numeric NOT NULL DEFAULT 0,
   ADD COLUMN IF NOT EXISTS budget_shortfall numeric NOT NULL DEFAULT 0,
   ADD COLUMN IF NOT EXISTS min_high numeric NOT NULL DEFAULT -1,
@@ -1788,7 +7791,180 @@ ALTER TABLE %s.runs
   ADD COLUMN IF NOT EXISTS min_low numeric NOT NULL DEFAULT -1,
   ADD COLUMN IF NOT EXISTS max_low numeric NOT NULL DEFAULT -1,
   ADD COLUMN IF NOT EXISTS reserve_medium numeric NOT NULL DEFAULT 0,
-  ADD COLUMN IF NOT EXISTS reserve_low numeric NOT NULL DEFAULT 0;`, schema)
+  ADD COLUMN IF NOT EXISTS reserve_low numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS cap_high_amount numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS cap_medium_amount numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS cap_low_amount numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS request_cap_percentile numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS rounds int NOT NULL DEFAULT 1,
+  ADD COLUMN IF NOT EXISTS term_years int NOT NULL DEFAULT 1,
+  ADD COLUMN IF NOT EXISTS requested_mean numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS requested_p25 numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS requested_p50 numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS requested_p75 numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS sweep boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS topup_leftover boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS stretch_percent numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS max_partial integer NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS budget_high numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS budget_medium numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS budget_low numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS request_weight numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS efficiency_bias numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS score_max_ref numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS amount_scale numeric NOT NULL DEFAULT 1,
+  ADD COLUMN IF NOT EXISTS min_score_high numeric NOT NULL DEFAULT -1,
+  ADD COLUMN IF NOT EXISTS min_score_medium numeric NOT NULL DEFAULT -1,
+  ADD COLUMN IF NOT EXISTS min_score_low numeric NOT NULL DEFAULT -1,
+  ADD COLUMN IF NOT EXISTS eligible_top_percent numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS tier_strict boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS min_meaningful_award numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS stranded_budget numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS tiebreak text NOT NULL DEFAULT 'score',
+  ADD COLUMN IF NOT EXISTS repeat_penalty numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS reserve_mode text NOT NULL DEFAULT 'priority',
+  ADD COLUMN IF NOT EXISTS priority_source text NOT NULL DEFAULT 'computed',
+  ADD COLUMN IF NOT EXISTS rank_weight numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS award_increment numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS max_award_median_multiple numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS max_spend_percent numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS effective_budget numeric NOT NULL DEFAULT 0;`
+	needCoverageColumnsDDL = `
+ALTER TABLE %s.need_coverage
+  ADD COLUMN IF NOT EXISTS requested_share numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS awarded_share numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS share_delta numeric NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS funding_gap numeric NOT NULL DEFAULT 0;`
+)
+
+func ensureDBSchema(ctx context.Context, pool *pgxpool.Pool, schema string) error {
+	_, err := pool.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schema))
+	if err != nil {
+		return fmt.Errorf("create schema: %w", err)
+	}
+	if err := checkColumnTypes(ctx, pool, schema); err != nil {
+		return err
+	}
+
+	runTable := fmt.Sprintf(runTableDDL, schema)
+	if _, err := pool.Exec(ctx, runTable); err != nil {
+		return fmt.Errorf("create runs table: %w", err)
+	}
+	if err := ensureRunColumns(ctx, pool, schema); err != nil {
+		return err
+	}
+
+	applicantTable := fmt.Sprintf(applicantTableDDL, schema, schema)
+	if _, err := pool.Exec(ctx, applicantTable); err != nil {
+		return fmt.Errorf("create applicants table: %w", err)
+	}
+
+	applicantAlter := fmt.Sprintf(applicantColumnsDDL, schema)
+	if _, err := pool.Exec(ctx, applicantAlter); err != nil {
+		return fmt.Errorf("alter applicants table: %w", err)
+	}
+
+	indexSQL := fmt.Sprintf("CREATE INDEX IF NOT EXISTS applicants_run_id_idx ON %s.applicants(run_id);", schema)
+	if _, err := pool.Exec(ctx, indexSQL); err != nil {
+		return fmt.Errorf("create index: %w", err)
+	}
+
+	needCoverageTable := fmt.Sprintf(needCoverageTableDDL, schema, schema)
+	if _, err := pool.Exec(ctx, needCoverageTable); err != nil {
+		return fmt.Errorf("create need_coverage table: %w", err)
+	}
+
+	if err := ensureNeedCoverageColumns(ctx, pool, schema); err != nil {
+		return err
+	}
+
+	coverageIndex := fmt.Sprintf("CREATE INDEX IF NOT EXISTS need_coverage_run_id_idx ON %s.need_coverage(run_id);", schema)
+	if _, err := pool.Exec(ctx, coverageIndex); err != nil {
+		return fmt.Errorf("create need_coverage index: %w", err)
+	}
+	return nil
+}
+
+// sqlDataTypes maps the type names used in the DDL to the data_type that
+// information_schema.columns reports for them.
+var sqlDataTypes = map[string]string{
+	"uuid":        "uuid",
+	"text":        "text",
+	"numeric":     "numeric",
+	"int":         "integer",
+	"integer":     "integer",
+	"boolean":     "boolean",
+	"timestamptz": "timestamp with time zone",
+	"bigserial":   "bigint",
+}
+
+// expectedColumnTypes parses the DDL templates into table -> column ->
+// information_schema data_type.
+func expectedColumnTypes() map[string]map[string]string {
+	tables := map[string][]string{
+		"runs":          {runTableDDL, runColumnsDDL},
+		"applicants":    {applicantTableDDL, applicantColumnsDDL},
+		"need_coverage": {needCoverageTableDDL, needCoverageColumnsDDL},
+	}
+	expected := make(map[string]map[string]string, len(tables))
+	for table, statements := range tables {
+		columns := make(map[string]string)
+		for _, statement := range statements {
+			for _, line := range strings.Split(statement, "\n") {
+				fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "ADD COLUMN IF NOT EXISTS "))
+				if len(fields) < 2 {
+					continue
+				}
+				if dataType, ok := sqlDataTypes[strings.TrimRight(fields[1], ",;")]; ok {
+					columns[fields[0]] = dataType
+				}
+			}
+		}
+		expected[table] = columns
+	}
+	return expected
+}
+
+// columnQuerier is the part of pgxpool.Pool used by checkColumnTypes.
+type columnQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// checkColumnTypes compares existing columns in schema with the types the DDL
+// declares. ADD COLUMN IF NOT EXISTS leaves a column with a changed type in
+// place, and inserts would then fail with a generic error, so a mismatch is
+// reported up front with the way out.
+func checkColumnTypes(ctx context.Context, db columnQuerier, schema string) error {
+	rows, err := db.Query(ctx, `SELECT table_name, column_name, data_type FROM information_schema.columns WHERE table_schema = $1`, schema)
+	if err != nil {
+		return fmt.Errorf("check schema columns: %w", err)
+	}
+	defer rows.Close()
+
+	expected := expectedColumnTypes()
+	var mismatches []string
+	for rows.Next() {
+		var table, column, dataType string
+		if err := rows.Scan(&table, &column, &dataType); err != nil {
+			return fmt.Errorf("scan schema column: %w", err)
+		}
+		want, ok := expected[table][column]
+		if ok && dataType != want {
+			mismatches = append(mismatches, fmt.Sprintf("column %s.%s is type %s, expected %s", table, column, dataType, want))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("check schema columns: %w", err)
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	sort.Strings(mismatches)
+	return fmt.Errorf("schema %s is incompatible: %s; set GS_AWARD_ALLOCATOR_SCHEMA to a fresh schema", schema, strings.Join(mismatches, "; "))
+}
+
+func ensureRunColumns(ctx context.Context, pool *pgxpool.Pool, schema string) error {
+	alter := fmt.Sprintf(runColumnsDDL, schema)
 	if _, err := pool.Exec(ctx, alter); err != nil {
 		return fmt.Errorf("alter runs table: %w", err)
 	}
@@ -1796,18 +7972,14 @@ ALTER TABLE %s.runs
 }
 
 func ensureNeedCoverageColumns(ctx context.Context, pool *pgxpool.Pool, schema string) error {
-	alter := fmt.Sprintf(`
-ALTER TABLE %s.need_coverage
-  ADD COLUMN IF NOT EXISTS requested_share numeric NOT NULL DEFAULT 0,
-  ADD COLUMN IF NOT EXISTS awarded_share numeric NOT NULL DEFAULT 0,
-  ADD COLUMN IF NOT EXISTS share_delta numeric NOT NULL DEFAULT 0;`, schema)
+	alter := fmt.Sprintf(needCoverageColumnsDDL, schema)
 	if _, err := pool.Exec(ctx, alter); err != nil {
 		return fmt.Errorf("alter need_coverage table: %w", err)
 	}
 	return nil
 }
 
-func insertRun(ctx context.Context, pool *pgxpool.Pool, schema string, runID uuid.UUID, summary allocationSummary, inputPath string, opts dbRunOptions) error {
+func insertRun(ctx context.Context, tx pgx.Tx, schema string, runID uuid.UUID, summary allocationSummary, inputPath string, opts runOptions) error {
 	builder := sq.Insert(schema+".runs").
 		Columns(
 			"run_id",
@@ -1835,12 +8007,20 @@ func insertRun(ctx context.Context, pool *pgxpool.Pool, schema string, runID uui
 			"award_p50",
 			"award_p75",
 			"award_to_request_avg",
+			"requested_mean",
+			"requested_p25",
+			"requested_p50",
+			"requested_p75",
 			"min_awarded",
 			"max_awarded",
 			"last_funded_priority",
 			"last_funded_score",
 			"last_funded_need",
 			"last_funded_requested",
+			"first_unfunded_priority",
+			"first_unfunded_score",
+			"first_unfunded_need",
+			"first_unfunded_requested",
 			"min_award_option",
 			"max_award_option",
 			"min_high",
@@ -1851,16 +8031,49 @@ func insertRun(ctx context.Context, pool *pgxpool.Pool, schema string, runID uui
 			"max_low",
 			"score_weight",
 			"need_weight",
+			"request_weight",
+			"efficiency_bias",
+			"score_max_ref",
 			"reserve_high",
 			"reserve_medium",
 			"reserve_low",
+			"cap_high_amount",
+			"cap_medium_amount",
+			"cap_low_amount",
 			"round_to",
 			"max_percent",
 			"min_score",
+			"min_score_high",
+			"min_score_medium",
+			"min_score_low",
+			"eligible_top_percent",
+			"amount_scale",
+			"request_cap_percentile",
+			"rounds",
+			"term_years",
+			"sweep",
+			"topup_leftover",
+			"stretch_percent",
+			"max_partial",
+			"budget_high",
+			"budget_medium",
+			"budget_low",
+			"tier_strict",
+			"min_meaningful_award",
+			"stranded_budget",
+			"tiebreak",
+			"repeat_penalty",
+			"reserve_mode",
+			"priority_source",
+			"rank_weight",
+			"award_increment",
+			"max_award_median_multiple",
+			"max_spend_percent",
+			"effective_budget",
 		).
 		Values(
 			runID,
-			summary.GeneratedAt,
+			summary.GeneratedTime,
 			inputPath,
 			summary.Budget,
 			summary.BudgetUsed,
@@ -1884,12 +8097,20 @@ func insertRun(ctx context.Context, pool *pgxpool.Pool, schema string, runID uui
 			summary.AwardP50,
 			summary.AwardP75,
 			summary.AwardToRequestAvg,
+			summary.RequestedMean,
+			summary.RequestedP25,
+			summary.RequestedP50,
+			summary.RequestedP75,
 			summary.MinAwarded,
 			summary.MaxAwarded,
 			summary.LastFundedPriority,
 			summary.LastFundedScore,
 			summary.LastFundedNeed,
 			summary.LastFundedRequested,
+			summary.FirstUnfundedPriority,
+			summary.FirstUnfundedScore,
+			summary.FirstUnfundedNeed,
+			summary.FirstUnfundedRequested,
 			opts.MinAward,
 			opts.MaxAward,
 			opts.MinHigh,
@@ -1900,12 +8121,45 @@ func insertRun(ctx context.Context, pool *pgxpool.Pool, schema string, runID uui
 			opts.MaxLow,
 			opts.ScoreWeight,
 			opts.NeedWeight,
+			opts.RequestWeight,
+			opts.EfficiencyBias,
+			opts.ScoreMaxRef,
 			opts.ReserveHigh,
 			opts.ReserveMedium,
 			opts.ReserveLow,
+			opts.CapHighAmount,
+			opts.CapMediumAmount,
+			opts.CapLowAmount,
 			opts.RoundTo,
 			opts.MaxPercent,
 			opts.MinScore,
+			opts.MinScoreHigh,
+			opts.MinScoreMedium,
+			opts.MinScoreLow,
+			opts.EligibleTopPct,
+			opts.AmountScale,
+			opts.RequestCapPct,
+			opts.Rounds,
+			opts.TermYears,
+			opts.Sweep,
+			opts.TopupLeftover,
+			opts.StretchPct,
+			opts.MaxPartial,
+			opts.BudgetHigh,
+			opts.BudgetMedium,
+			opts.BudgetLow,
+			opts.TierStrict,
+			opts.MinMeaningful,
+			summary.StrandedBudget,
+			strings.Join(tiebreakOrder(opts.Tiebreak), ","),
+			opts.RepeatPenalty,
+			reserveModeOrDefault(opts.ReserveMode),
+			prioritySourceOrDefault(opts.PrioritySource),
+			opts.RankWeight,
+			opts.AwardIncrement,
+			opts.MedianMultiple,
+			opts.MaxSpendPct,
+			summary.EffectiveBudget,
 		).
 		PlaceholderFormat(sq.Dollar)
 
@@ -1913,66 +8167,178 @@ func insertRun(ctx context.Context, pool *pgxpool.Pool, schema string, runID uui
 	if err != nil {
 		return fmt.Errorf("build run insert: %w", err)
 	}
-	if _, err := pool.Exec(ctx, query, args...); err != nil {
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
 		return fmt.Errorf("insert run: %w", err)
 	}
 	return nil
 }
 
-func insertApplicants(ctx context.Context, pool *pgxpool.Pool, schema string, runID uuid.UUID, applicants []*applicant) error {
+var applicantColumns = []string{
+	"run_id",
+	"applicant_id",
+	"name",
+	"need_level",
+	"score_raw",
+	"score_norm",
+	"priority",
+	"requested",
+	"other_aid",
+	"cost_of_attendance",
+	"awarded",
+	"eligible",
+	"eligibility_msg",
+	"fte",
+}
+
+func applicantRow(runID uuid.UUID, item *applicant) []any {
+	return []any{
+		runID,
+		item.ID,
+		item.Name,
+		item.NeedLevel,
+		item.ScoreRaw,
+		item.ScoreNorm,
+		item.PriorityScore,
+		item.Requested,
+		item.OtherAid,
+		item.CostOfAttend,
+		item.Awarded,
+		item.Eligible,
+		item.EligibilityMsg,
+		item.FTE,
+	}
+}
+
+// insertApplicants bulk-loads applicants with COPY inside a savepoint. If the
+// copy fails, the savepoint is rolled back so no partial rows remain and the
+// rows are written again with batched inserts in the same transaction.
+func insertApplicants(ctx context.Context, tx pgx.Tx, schema string, runID uuid.UUID, applicants []*applicant) error {
 	if len(applicants) == 0 {
 		return nil
 	}
+	savepoint, err := tx.Begin(ctx)
+	if err == nil {
+		_, err = copyApplicants(ctx, savepoint, schema, runID, applicants)
+		if err == nil {
+			err = savepoint.Commit(ctx)
+		}
+		if err == nil {
+			return nil
+		}
+		savepoint.Rollback(ctx)
+	}
+	fmt.Fprintf(os.Stderr, "COPY into applicants failed, falling back to batched inserts: %v\n", err)
+	return insertApplicantBatches(ctx, tx, schema, runID, applicants)
+}
+
+// fundedQuerier is the part of pgxpool.Pool used by loadFundedSince.
+type fundedQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func fetchFundedSince(ctx context.Context, cfg dbConfig, since time.Time) (map[string]bool, error) {
+	pool, err := pgxpool.New(ctx, cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("open pool: %w", err)
+	}
+	defer pool.Close()
+	return loadFundedSince(ctx, pool, cfg.Schema, since)
+}
+
+// loadFundedSince returns the IDs of applicants awarded a positive amount in
+// any logged run generated at or after since.
+func loadFundedSince(ctx context.Context, db fundedQuerier, schema string, since time.Time) (map[string]bool, error) {
+	query, args, err := sq.Select("DISTINCT a.applicant_id").
+		From(schema + ".applicants a").
+		Join(schema + ".runs r ON r.run_id = a.run_id").
+		Where(sq.Gt{"a.awarded": 0}).
+		Where(sq.GtOrEq{"r.generated_at": since}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build funded query: %w", err)
+	}
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("load funded applicants: %w", err)
+	}
+	defer rows.Close()
+
+	funded := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan funded applicant: %w", err)
+		}
+		funded[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load funded applicants: %w", err)
+	}
+	return funded, nil
+}
+
+// excludeFunded marks eligible applicants funded in a prior run as
+// ineligible and returns how many were excluded.
+func excludeFunded(applicants []*applicant, funded map[string]bool) int {
+	excluded := 0
+	for _, item := range applicants {
+		if item.Eligible && funded[item.ID] {
+			markIneligible(item, "already funded in a prior run")
+			excluded++
+		}
+	}
+	return excluded
+}
+
+// applicantCopier is the part of pgx.Tx used by copyApplicants.
+type applicantCopier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// copyApplicants streams applicant rows through COPY without building the
+// whole row set in memory.
+func copyApplicants(ctx context.Context, copier applicantCopier, schema string, runID uuid.UUID, applicants []*applicant) (int64, error) {
+	source := pgx.CopyFromSlice(len(applicants), func(i int) ([]any, error) {
+		return applicantRow(runID, applicants[i]), nil
+	})
+	copied, err := copier.CopyFrom(ctx, pgx.Identifier{schema, "applicants"}, applicantColumns, source)
+	if err != nil {
+		return copied, fmt.Errorf("copy applicants: %w", err)
+	}
+	if copied != int64(len(applicants)) {
+		return copied, fmt.Errorf("copy applicants: copied %d of %d rows", copied, len(applicants))
+	}
+	return copied, nil
+}
+
+func insertApplicantBatches(ctx context.Context, tx pgx.Tx, schema string, runID uuid.UUID, applicants []*applicant) error {
 	const batchSize = 200
 	for start := 0; start < len(applicants); start += batchSize {
 		end := start + batchSize
 		if end > len(applicants) {
 			end = len(applicants)
 		}
-		builder := sq.Insert(schema+".applicants").
-			Columns(
-				"run_id",
-				"applicant_id",
-				"name",
-				"need_level",
-				"score_raw",
-				"score_norm",
-				"priority",
-				"requested",
-				"awarded",
-				"eligible",
-				"eligibility_msg",
-			).
+		builder := sq.Insert(schema + ".applicants").
+			Columns(applicantColumns...).
 			PlaceholderFormat(sq.Dollar)
 
 		for _, item := range applicants[start:end] {
-			builder = builder.Values(
-				runID,
-				item.ID,
-				item.Name,
-				item.NeedLevel,
-				item.ScoreRaw,
-				item.ScoreNorm,
-				item.PriorityScore,
-				item.Requested,
-				item.Awarded,
-				item.Eligible,
-				item.EligibilityMsg,
-			)
+			builder = builder.Values(applicantRow(runID, item)...)
 		}
 
 		query, args, err := builder.ToSql()
 		if err != nil {
 			return fmt.Errorf("build applicant insert: %w", err)
 		}
-		if _, err := pool.Exec(ctx, query, args...); err != nil {
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
 			return fmt.Errorf("insert applicants: %w", err)
 		}
 	}
 	return nil
 }
 
-func insertNeedCoverage(ctx context.Context, pool *pgxpool.Pool, schema string, runID uuid.UUID, coverage map[string]needCoverageAgg) error {
+func insertNeedCoverage(ctx context.Context, tx pgx.Tx, schema string, runID uuid.UUID, coverage map[string]needCoverageAgg) error {
 	if len(coverage) == 0 {
 		return nil
 	}
@@ -1985,6 +8351,7 @@ func insertNeedCoverage(ctx context.Context, pool *pgxpool.Pool, schema string,
 			"unfunded_count",
 			"requested_total",
 			"awarded_total",
+			"funding_gap",
 			"coverage_rate",
 			"requested_share",
 			"awarded_share",
@@ -2006,6 +8373,7 @@ func insertNeedCoverage(ctx context.Context, pool *pgxpool.Pool, schema string,
 			agg.UnfundedCount,
 			agg.RequestedTotal,
 			agg.AwardedTotal,
+			agg.FundingGap,
 			agg.CoverageRate,
 			agg.RequestedShare,
 			agg.AwardedShare,
@@ -2017,8 +8385,186 @@ func insertNeedCoverage(ctx context.Context, pool *pgxpool.Pool, schema string,
 	if err != nil {
 		return fmt.Errorf("build need coverage insert: %w", err)
 	}
-	if _, err := pool.Exec(ctx, query, args...); err != nil {
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
 		return fmt.Errorf("insert need coverage: %w", err)
 	}
 	return nil
 }
+
+// loadRunFromDatabase reads the options and applicant inputs logged for a run.
+// Applicants are rebuilt from their raw score, need level, and request so the
+// current allocation logic can be re-applied; CSV extra columns are not logged.
+func loadRunFromDatabase(ctx context.Context, cfg dbConfig, runID uuid.UUID) (runOptions, string, []*applicant, error) {
+	pool, err := pgxpool.New(ctx, cfg.URL)
+	if err != nil {
+		return runOptions{}, "", nil, fmt.Errorf("open pool: %w", err)
+	}
+	defer pool.Close()
+
+	runQuery, runArgs, err := sq.Select(
+		"COALESCE(input_path, '')",
+		"budget",
+		"min_award_option",
+		"max_award_option",
+		"min_high",
+		"max_high",
+		"min_medium",
+		"max_medium",
+		"min_low",
+		"max_low",
+		"score_weight",
+		"need_weight",
+		"request_weight",
+		"efficiency_bias",
+		"score_max_ref",
+		"reserve_high",
+		"reserve_medium",
+		"reserve_low",
+		"cap_high_amount",
+		"cap_medium_amount",
+		"cap_low_amount",
+		"round_to",
+		"max_percent",
+		"min_score",
+		"min_score_high",
+		"min_score_medium",
+		"min_score_low",
+		"eligible_top_percent",
+		"amount_scale",
+		"request_cap_percentile",
+		"rounds",
+		"term_years",
+		"sweep",
+		"topup_leftover",
+		"stretch_percent",
+		"max_partial",
+		"budget_high",
+		"budget_medium",
+		"budget_low",
+		"tier_strict",
+		"min_meaningful_award",
+		"tiebreak",
+		"repeat_penalty",
+		"reserve_mode",
+		"priority_source",
+		"rank_weight",
+		"award_increment",
+		"max_award_median_multiple",
+		"max_spend_percent",
+	).
+		From(cfg.Schema + ".runs").
+		Where(sq.Eq{"run_id": runID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return runOptions{}, "", nil, fmt.Errorf("build run query: %w", err)
+	}
+
+	var opts runOptions
+	var inputPath string
+	var tiebreak string
+	err = pool.QueryRow(ctx, runQuery, runArgs...).Scan(
+		&inputPath,
+		&opts.Budget,
+		&opts.MinAward,
+		&opts.MaxAward,
+		&opts.MinHigh,
+		&opts.MaxHigh,
+		&opts.MinMedium,
+		&opts.MaxMedium,
+		&opts.MinLow,
+		&opts.MaxLow,
+		&opts.ScoreWeight,
+		&opts.NeedWeight,
+		&opts.RequestWeight,
+		&opts.EfficiencyBias,
+		&opts.ScoreMaxRef,
+		&opts.ReserveHigh,
+		&opts.ReserveMedium,
+		&opts.ReserveLow,
+		&opts.CapHighAmount,
+		&opts.CapMediumAmount,
+		&opts.CapLowAmount,
+		&opts.RoundTo,
+		&opts.MaxPercent,
+		&opts.MinScore,
+		&opts.MinScoreHigh,
+		&opts.MinScoreMedium,
+		&opts.MinScoreLow,
+		&opts.EligibleTopPct,
+		&opts.AmountScale,
+		&opts.RequestCapPct,
+		&opts.Rounds,
+		&opts.TermYears,
+		&opts.Sweep,
+		&opts.TopupLeftover,
+		&opts.StretchPct,
+		&opts.MaxPartial,
+		&opts.BudgetHigh,
+		&opts.BudgetMedium,
+		&opts.BudgetLow,
+		&opts.TierStrict,
+		&opts.MinMeaningful,
+		&tiebreak,
+		&opts.RepeatPenalty,
+		&opts.ReserveMode,
+		&opts.PrioritySource,
+		&opts.RankWeight,
+		&opts.AwardIncrement,
+		&opts.MedianMultiple,
+		&opts.MaxSpendPct,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return runOptions{}, "", nil, fmt.Errorf("run %s not found", runID)
+	}
+	if err != nil {
+		return runOptions{}, "", nil, fmt.Errorf("load run: %w", err)
+	}
+	if opts.Tiebreak, err = parseTiebreak(tiebreak); err != nil {
+		return runOptions{}, "", nil, fmt.Errorf("load run: %w", err)
+	}
+
+	applicantQuery, applicantArgs, err := sq.Select(
+		"applicant_id",
+		"COALESCE(name, '')",
+		"COALESCE(need_level, '')",
+		"COALESCE(score_raw, 0)",
+		"COALESCE(requested, 0)",
+		"other_aid",
+		"cost_of_attendance",
+		"fte",
+	).
+		From(cfg.Schema + ".applicants").
+		Where(sq.Eq{"run_id": runID}).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return runOptions{}, "", nil, fmt.Errorf("build applicant query: %w", err)
+	}
+	rows, err := pool.Query(ctx, applicantQuery, applicantArgs...)
+	if err != nil {
+		return runOptions{}, "", nil, fmt.Errorf("load applicants: %w", err)
+	}
+	defer rows.Close()
+
+	var applicants []*applicant
+	for rows.Next() {
+		var id, name, need string
+		var score, requested, otherAid, costOfAttendance, fte float64
+		if err := rows.Scan(&id, &name, &need, &score, &requested, &otherAid, &costOfAttendance, &fte); err != nil {
+			return runOptions{}, "", nil, fmt.Errorf("scan applicant: %w", err)
+		}
+		item := newApplicant(id, name, need, score, requested, otherAid, map[string]string{})
+		item.CostOfAttend = costOfAttendance
+		applyFTE(item, fte)
+		applicants = append(applicants, item)
+	}
+	if err := rows.Err(); err != nil {
+		return runOptions{}, "", nil, fmt.Errorf("load applicants: %w", err)
+	}
+	if len(applicants) == 0 {
+		return runOptions{}, "", nil, fmt.Errorf("run %s has no logged applicants", runID)
+	}
+	return opts, inputPath, applicants, nil
+}
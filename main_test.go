@@ -1,8 +1,26 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func buildApplicant(id, need string, score, requested float64) *applicant {
@@ -11,26 +29,37 @@ func buildApplicant(id, need string, score, requested float64) *applicant {
 		NeedLevel: need,
 		ScoreRaw:  score,
 		Requested: requested,
+		Match:     1,
 		Eligible:  true,
 	}
 }
 
-func defaultCaps() needAwardCaps {
-	return needAwardCaps{
-		MinHigh:   -1,
-		MaxHigh:   -1,
-		MinMedium: -1,
-		MaxMedium: -1,
-		MinLow:    -1,
-		MaxLow:    -1,
+func defaultOptions(minAward, maxAward float64) runOptions {
+	return runOptions{
+		MinAward:    minAward,
+		MaxAward:    maxAward,
+		MinHigh:     -1,
+		MaxHigh:     -1,
+		MinMedium:   -1,
+		MaxMedium:   -1,
+		MinLow:      -1,
+		MaxLow:      -1,
+		ScoreWeight: 0.7,
+		NeedWeight:  0.3,
+		MaxPercent:  1,
+		AmountScale: 1,
+		Rounds:      1,
 	}
 }
 
 func prepApplicants(applicants []*applicant, scoreWeight, needWeight float64) {
-	applyMinScore(applicants, 0)
-	normalizeScores(applicants)
-	assignPriority(applicants, scoreWeight, needWeight)
-	sortApplicants(applicants)
+	opts := defaultOptions(0, 0)
+	opts.ScoreWeight = scoreWeight
+	opts.NeedWeight = needWeight
+	applyMinScore(applicants, 0, needMinScores{High: -1, Medium: -1, Low: -1})
+	normalizeScores(applicants, 0)
+	assignPriority(applicants, opts)
+	sortApplicants(applicants, nil)
 }
 
 func TestReserveLowGuaranteesLowNeedFunding(t *testing.T) {
@@ -40,7 +69,9 @@ func TestReserveLowGuaranteesLowNeedFunding(t *testing.T) {
 	}
 	prepApplicants(applicants, 0.7, 0.3)
 
-	awarded := allocateBudget(applicants, 1000, 1000, 1000, defaultCaps(), 0, 0, 1, 0, 1)
+	opts := defaultOptions(1000, 1000)
+	opts.ReserveLow = 1
+	awarded := allocateBudget(applicants, 1000, opts)
 	if len(awarded) != 1 {
 		t.Fatalf("expected 1 awarded applicant, got %d", len(awarded))
 	}
@@ -61,7 +92,10 @@ func TestReserveMixAllocatesAcrossNeedLevels(t *testing.T) {
 	}
 	prepApplicants(applicants, 0.7, 0.3)
 
-	awarded := allocateBudget(applicants, 4000, 1000, 1000, defaultCaps(), 0.5, 0.25, 0, 0, 1)
+	opts := defaultOptions(1000, 1000)
+	opts.ReserveHigh = 0.5
+	opts.ReserveMedium = 0.25
+	awarded := allocateBudget(applicants, 4000, opts)
 	if len(awarded) != 4 {
 		t.Fatalf("expected 4 awarded applicants, got %d", len(awarded))
 	}
@@ -79,16 +113,11 @@ func TestNeedSpecificCapsOverrideGlobal(t *testing.T) {
 	}
 	prepApplicants(applicants, 0.7, 0.3)
 
-	caps := needAwardCaps{
-		MinHigh:   1500,
-		MaxHigh:   -1,
-		MinMedium: -1,
-		MaxMedium: -1,
-		MinLow:    -1,
-		MaxLow:    800,
-	}
+	opts := defaultOptions(500, 2000)
+	opts.MinHigh = 1500
+	opts.MaxLow = 800
 
-	awarded := allocateBudget(applicants, 4000, 500, 2000, caps, 0, 0, 0, 0, 1)
+	awarded := allocateBudget(applicants, 4000, opts)
 	if len(awarded) != 2 {
 		t.Fatalf("expected 2 awarded applicants, got %d", len(awarded))
 	}
@@ -116,6 +145,35 @@ func TestParseBudgetList(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected error for invalid budget")
 	}
+	for _, raw := range []string{"-500", "inf", "1000,nan"} {
+		if _, err := parseBudgetList(raw); err == nil {
+			t.Fatalf("expected scenario budgets %q to be rejected", raw)
+		}
+	}
+}
+
+func TestZeroScenarioBudgetIsAllUnfunded(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "low", 70, 800),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	budgets, err := parseBudgetList("0,1800")
+	if err != nil {
+		t.Fatalf("expected a zero scenario budget to be accepted: %v", err)
+	}
+	opts := defaultOptions(0, 5000)
+	results := buildScenarioResults(applicants, budgets, opts)
+	baseline := results[0]
+	if baseline.AwardedCount != 0 || baseline.BudgetUsed != 0 || baseline.CoverageRate != 0 {
+		t.Fatalf("expected the zero budget to fund no one, got %+v", baseline)
+	}
+	if baseline.EligibleUnfundedCount != 2 || !floatEquals(baseline.FundingGapTotal, 1800) {
+		t.Fatalf("expected everyone unfunded with the full gap, got %+v", baseline)
+	}
+	if results[1].AwardedCount != 2 {
+		t.Fatalf("expected the full budget to fund everyone, got %d", results[1].AwardedCount)
+	}
 }
 
 func TestScenarioResultsBudgetImpact(t *testing.T) {
@@ -125,7 +183,7 @@ func TestScenarioResultsBudgetImpact(t *testing.T) {
 	}
 	prepApplicants(applicants, 0.7, 0.3)
 
-	results := buildScenarioResults(applicants, []float64{1000, 2000}, 1000, 1000, defaultCaps(), 0, 0, 0, 0, 1)
+	results := buildScenarioResults(applicants, []float64{1000, 2000}, defaultOptions(1000, 1000))
 	if len(results) != 2 {
 		t.Fatalf("expected 2 scenario results, got %d", len(results))
 	}
@@ -144,6 +202,3608 @@ func TestScenarioResultsBudgetImpact(t *testing.T) {
 	}
 }
 
+func TestManifestReproduceVerifiesInputHash(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "applicants.csv")
+	if err := os.WriteFile(inputPath, []byte("applicant_id,score,need_level,requested_amount\nA-1,90,high,1000\n"), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	opts := runOptions{Budget: 5000, MinAward: 500, MaxAward: 2000, MaxPercent: 1, ScoreWeight: 0.7, NeedWeight: 0.3}
+
+	manifest, err := buildManifest("2026-01-01T00:00:00Z", inputPath, opts)
+	if err != nil {
+		t.Fatalf("build manifest: %v", err)
+	}
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := writeManifest(manifestPath, manifest); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+
+	loaded, err := loadManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	if loaded.Options.Budget != 5000 || loaded.Options.MaxAward != 2000 {
+		t.Fatalf("unexpected options after round trip: %#v", loaded.Options)
+	}
+	if err := verifyManifestInput(loaded, false); err != nil {
+		t.Fatalf("expected hash to verify, got %v", err)
+	}
+
+	if err := os.WriteFile(inputPath, []byte("applicant_id,score,need_level,requested_amount\nA-1,95,high,1000\n"), 0o644); err != nil {
+		t.Fatalf("rewrite input: %v", err)
+	}
+	err = verifyManifestInput(loaded, false)
+	if err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Fatalf("expected hash mismatch error, got %v", err)
+	}
+	if err := verifyManifestInput(loaded, true); err != nil {
+		t.Fatalf("expected -ignore-hash to skip verification, got %v", err)
+	}
+}
+
+func TestSummarizeGroupsByExtraColumn(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "medium", 90, 1000),
+		buildApplicant("a-3", "low", 70, 1000),
+	}
+	applicants[0].Extras = map[string]string{"cohort": "stem"}
+	applicants[1].Extras = map[string]string{"cohort": "stem"}
+	applicants[2].Extras = map[string]string{"cohort": ""}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	awarded := allocateBudget(applicants, 1500, defaultOptions(500, 1000))
+	summary := summarize(applicants, 1500, awarded, "cohort")
+
+	stem := summary.ByGroup["stem"]
+	if stem.EligibleCount != 2 || stem.AwardedCount != 2 {
+		t.Fatalf("unexpected stem group: %#v", stem)
+	}
+	if !floatEquals(stem.CoverageRate, 0.75) {
+		t.Fatalf("expected 0.75 stem coverage, got %.2f", stem.CoverageRate)
+	}
+	blank := summary.ByGroup["unspecified"]
+	if blank.EligibleCount != 1 || blank.UnfundedCount != 1 {
+		t.Fatalf("expected blank cohort bucketed as unspecified, got %#v", blank)
+	}
+}
+
+func TestRequestCapPercentileLimitsAwardBasis(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 9000),
+		buildApplicant("a-2", "medium", 90, 1000),
+		buildApplicant("a-3", "low", 85, 2000),
+		buildApplicant("a-4", "low", 80, 3000),
+	}
+	capAmount := applyRequestCap(applicants, 0.75)
+	if capAmount != 3000 {
+		t.Fatalf("expected cap at 3000, got %.2f", capAmount)
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	awarded := allocateBudget(applicants, 20000, defaultOptions(500, 10000))
+	summary := summarize(applicants, 20000, awarded, "")
+	if summary.Awards[0].ApplicantID != "a-1" || summary.Awards[0].Awarded != 3000 {
+		t.Fatalf("expected a-1 award capped at 3000, got %#v", summary.Awards[0])
+	}
+	if summary.Awards[0].Requested != 9000 {
+		t.Fatalf("expected original request preserved, got %.2f", summary.Awards[0].Requested)
+	}
+	if summary.RequestCappedCount != 1 || summary.RequestCapAmount != 3000 {
+		t.Fatalf("unexpected request cap summary: %d at %.2f", summary.RequestCappedCount, summary.RequestCapAmount)
+	}
+}
+
+func TestSummaryOnlyJSONOmitsApplicantArrays(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "low", 60, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 1000, defaultOptions(500, 1000))
+	summary := summarize(applicants, 1000, awarded, "")
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	if err := writeSummaryJSON(path, summary, false); err != nil {
+		t.Fatalf("write summary JSON: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read summary JSON: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decode summary JSON: %v", err)
+	}
+	for _, key := range []string{"awards", "unfunded", "ineligible"} {
+		if _, ok := decoded[key]; ok {
+			t.Fatalf("expected %q to be omitted", key)
+		}
+	}
+	if decoded["awarded_count"].(float64) != 1 {
+		t.Fatalf("expected awarded_count to be kept, got %v", decoded["awarded_count"])
+	}
+	if _, ok := decoded["need_coverage"]; !ok {
+		t.Fatalf("expected need_coverage aggregate to be kept")
+	}
+}
+
+func TestAllocateRoundsReallocatesDeclinedOffers(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "high", 90, 1000),
+		buildApplicant("a-3", "medium", 80, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(1000, 1000)
+	opts.Rounds = 3
+	opts.DeclinedIDs = []string{"a-1"}
+	awarded, rounds := allocateRounds(applicants, 2000, opts)
+
+	if len(rounds) != 2 {
+		t.Fatalf("expected 2 rounds (second has no declines), got %d", len(rounds))
+	}
+	if rounds[0].Offered != 2 || rounds[0].Declined != 1 || rounds[0].DeclinedAmount != 1000 {
+		t.Fatalf("unexpected round 1 result: %#v", rounds[0])
+	}
+	if rounds[1].BudgetAvailable != 1000 || rounds[1].Offered != 1 {
+		t.Fatalf("unexpected round 2 result: %#v", rounds[1])
+	}
+	if len(awarded) != 2 || totalAwarded(awarded) != 2000 {
+		t.Fatalf("expected 2 accepted awards totaling 2000, got %d totaling %.2f", len(awarded), totalAwarded(awarded))
+	}
+	for _, item := range awarded {
+		if item.ID == "a-1" {
+			t.Fatalf("declined applicant should not remain awarded")
+		}
+	}
+	summary := summarize(applicants, 2000, awarded, "")
+	if summary.DeclinedCount != 1 || summary.IneligibleCount != 0 || len(summary.IneligibleReasonSummary) != 0 || len(summary.Unfunded) != 0 {
+		t.Fatalf("expected the decline counted apart from ineligible and unfunded applicants, got %d declined, %d ineligible, %v, %d unfunded",
+			summary.DeclinedCount, summary.IneligibleCount, summary.IneligibleReasonSummary, len(summary.Unfunded))
+	}
+
+	opts.Rounds = 0
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "rounds must be >= 1") {
+		t.Fatalf("expected -rounds 0 to be rejected, got %v", err)
+	}
+	opts.Rounds = 1
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "declined-ids requires") {
+		t.Fatalf("expected -declined-ids without extra rounds to be rejected, got %v", err)
+	}
+}
+
+func TestFormatTimestampCustomLayoutAndZone(t *testing.T) {
+	generated := time.Date(2026, 3, 1, 15, 4, 0, 0, time.UTC)
+	zone := time.FixedZone("EST", -5*60*60)
+
+	if got := formatTimestamp(generated, "rfc3339", time.UTC); got != "2026-03-01T15:04:00Z" {
+		t.Fatalf("unexpected rfc3339 timestamp: %s", got)
+	}
+	if got := formatTimestamp(generated, "date", zone); got != "2026-03-01" {
+		t.Fatalf("unexpected date timestamp: %s", got)
+	}
+	if got := formatTimestamp(generated, "Jan 2, 2006 3:04 PM MST", zone); got != "Mar 1, 2026 10:04 AM EST" {
+		t.Fatalf("unexpected custom timestamp: %s", got)
+	}
+}
+
+func TestModeResultsCompareStrategies(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 3000),
+		buildApplicant("a-2", "medium", 85, 1000),
+		buildApplicant("a-3", "low", 75, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	results := buildModeResults(applicants, 3000, []string{"priority", "proportional", "equal", "max-recipients"}, defaultOptions(500, 5000))
+	if len(results) != 4 {
+		t.Fatalf("expected 4 mode results, got %d", len(results))
+	}
+	byMode := make(map[string]modeResult)
+	for _, result := range results {
+		byMode[result.Mode] = result
+		if !floatEquals(result.BudgetUsed, 3000) && result.Mode != "max-recipients" {
+			t.Fatalf("expected %s to spend the full budget, got %.2f", result.Mode, result.BudgetUsed)
+		}
+	}
+	if byMode["priority"].AwardedCount != 1 {
+		t.Fatalf("expected priority mode to fund only the top applicant, got %d", byMode["priority"].AwardedCount)
+	}
+	if byMode["proportional"].AwardedCount != 3 || byMode["equal"].AwardedCount != 3 {
+		t.Fatalf("expected shared modes to fund everyone: %#v", byMode)
+	}
+	if byMode["max-recipients"].AwardedCount != 2 {
+		t.Fatalf("expected max-recipients to fund the two small requests, got %d", byMode["max-recipients"].AwardedCount)
+	}
+	if byMode["equal"].Gini >= byMode["priority"].Gini {
+		t.Fatalf("expected equal mode to be less unequal than priority: %.3f vs %.3f", byMode["equal"].Gini, byMode["priority"].Gini)
+	}
+	if applicants[0].Awarded != 0 {
+		t.Fatalf("expected mode comparison to run on clones")
+	}
+}
+
+func TestGiniCoefficient(t *testing.T) {
+	if got := giniCoefficient([]float64{100, 100, 100}); !floatEquals(got, 0) {
+		t.Fatalf("expected 0 gini for equal awards, got %.3f", got)
+	}
+	if got := giniCoefficient([]float64{0, 0, 0, 400}); !floatEquals(got, 0.75) {
+		t.Fatalf("expected 0.75 gini for single recipient of four, got %.3f", got)
+	}
+}
+
+func TestAllApplicantRatesIncludeIneligible(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "medium", 60, 1000),
+		buildApplicant("a-3", "low", 40, 2000),
+	}
+	applyMinScore(applicants, 50, needMinScores{High: -1, Medium: -1, Low: -1})
+	normalizeScores(applicants, 0)
+	assignPriority(applicants, defaultOptions(0, 0))
+	sortApplicants(applicants, nil)
+
+	awarded := allocateBudget(applicants, 1000, defaultOptions(500, 1000))
+	summary := summarize(applicants, 1000, awarded, "")
+	applyAllApplicantRates(&summary, applicants)
+
+	if !floatEquals(summary.CoverageRate, 0.5) || !floatEquals(summary.FullFundingRate, 0.5) {
+		t.Fatalf("expected eligible-only rates unchanged, got %.2f / %.2f", summary.CoverageRate, summary.FullFundingRate)
+	}
+	if !floatEquals(summary.CoverageRateAll, 0.25) {
+		t.Fatalf("expected all-applicant coverage 0.25, got %.2f", summary.CoverageRateAll)
+	}
+	if !floatEquals(summary.FullFundingRateAll, 1.0/3.0) {
+		t.Fatalf("expected all-applicant full funding 1/3, got %.3f", summary.FullFundingRateAll)
+	}
+}
+
+func TestSummarizeRequestedDistribution(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "medium", 85, 2000),
+		buildApplicant("a-3", "low", 75, 3000),
+		buildApplicant("a-4", "low", 65, 4000),
+		buildApplicant("a-5", "low", 30, 9000),
+	}
+	applyMinScore(applicants, 50, needMinScores{High: -1, Medium: -1, Low: -1})
+	normalizeScores(applicants, 0)
+	assignPriority(applicants, defaultOptions(0, 0))
+	sortApplicants(applicants, nil)
+
+	awarded := allocateBudget(applicants, 3000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 3000, awarded, "")
+	if summary.RequestedTotal != 10000 || !floatEquals(summary.RequestedMean, 2500) {
+		t.Fatalf("unexpected requested total/mean: %.2f / %.2f", summary.RequestedTotal, summary.RequestedMean)
+	}
+	if summary.RequestedP25 != 1000 || summary.RequestedP50 != 2000 || summary.RequestedP75 != 3000 {
+		t.Fatalf("unexpected requested percentiles: %.2f %.2f %.2f", summary.RequestedP25, summary.RequestedP50, summary.RequestedP75)
+	}
+}
+
+func TestProgramBudgetsAllocateIndependently(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("stem-1", "high", 95, 1000),
+		buildApplicant("stem-2", "high", 90, 1000),
+		buildApplicant("arts-1", "low", 60, 1000),
+		buildApplicant("none-1", "high", 99, 1000),
+	}
+	applicants[0].Extras = map[string]string{"program": "STEM"}
+	applicants[1].Extras = map[string]string{"program": "stem"}
+	applicants[2].Extras = map[string]string{"program": "arts"}
+	applicants[3].Extras = map[string]string{"program": "music"}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	budgets, err := parseProgramBudgets("stem=1000, arts=1000")
+	if err != nil {
+		t.Fatalf("parse program budgets: %v", err)
+	}
+	opts := defaultOptions(500, 1000)
+	opts.ProgramBudgets = budgets
+	awarded := allocateBudget(applicants, 2000, opts)
+
+	funded := make(map[string]float64)
+	for _, item := range awarded {
+		funded[item.ID] = item.Awarded
+	}
+	if funded["stem-1"] != 1000 || funded["arts-1"] != 1000 || len(funded) != 2 {
+		t.Fatalf("unexpected program awards: %#v", funded)
+	}
+
+	warnings := unbudgetedProgramWarnings(applicants, budgets)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "music") {
+		t.Fatalf("expected warning for unbudgeted program, got %v", warnings)
+	}
+	programs := summarizePrograms(applicants, budgets)
+	if programs["stem"].AwardedCount != 1 || programs["stem"].UnfundedCount != 1 || programs["stem"].BudgetLeft != 0 {
+		t.Fatalf("unexpected stem program summary: %#v", programs["stem"])
+	}
+}
+
+func TestReservePassFitsLaterSmallerApplicant(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("high-1", "high", 99, 1000),
+		buildApplicant("high-2", "high", 95, 2000),
+		buildApplicant("high-3", "high", 90, 500),
+		buildApplicant("low-1", "low", 80, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(1000, 2000)
+	opts.ReserveHigh = 0.6
+	awarded := allocateBudget(applicants, 2500, opts)
+
+	funded := make(map[string]float64)
+	for _, item := range awarded {
+		funded[item.ID] = item.Awarded
+	}
+	if funded["high-1"] != 1000 || funded["high-3"] != 500 {
+		t.Fatalf("expected reserve to fund high-1 and the smaller high-3 exactly, got %#v", funded)
+	}
+	if funded["high-2"] != 1000 {
+		t.Fatalf("expected general pass to give high-2 the remaining 1000, got %#v", funded)
+	}
+	if total := totalAwarded(awarded); total != 2500 {
+		t.Fatalf("expected full budget used, got %.2f", total)
+	}
+}
+
+func TestSweepTopsUpSmallestGapsFirst(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("high-1", "high", 99, 2500),
+		buildApplicant("medium-1", "medium", 90, 1000),
+		buildApplicant("low-1", "low", 80, 1500),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(1000, 3000)
+	opts.ReserveHigh = 0.25
+	opts.ReserveLow = 0.25
+	opts.Sweep = true
+	awarded := allocateBudget(applicants, 4000, opts)
+	summary := summarize(applicants, 4000, awarded, "")
+
+	funded := make(map[string]*applicant)
+	for _, item := range awarded {
+		funded[item.ID] = item
+	}
+	if funded["low-1"].Awarded != 1500 || funded["low-1"].Swept != 500 {
+		t.Fatalf("expected low-1 (smallest gap) fully topped up, got %.2f", funded["low-1"].Awarded)
+	}
+	if funded["high-1"].Awarded != 1500 || funded["high-1"].Swept != 500 {
+		t.Fatalf("expected high-1 to receive the remaining 500, got %.2f", funded["high-1"].Awarded)
+	}
+	if summary.SweptAmount != 1000 || summary.SweptCount != 2 {
+		t.Fatalf("unexpected sweep summary: %.2f across %d", summary.SweptAmount, summary.SweptCount)
+	}
+	if summary.BudgetLeft != 0 {
+		t.Fatalf("expected sweep to exhaust the budget, got %.2f left", summary.BudgetLeft)
+	}
+}
+
+func TestSweepRespectsMaxPercent(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 2000),
+		buildApplicant("a-2", "medium", 80, 3000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 5000)
+	opts.MaxPercent = 0.5
+	opts.Sweep = true
+	awarded := allocateBudget(applicants, 20000, opts)
+	if applicants[0].Awarded != 1000 || applicants[1].Awarded != 1500 {
+		t.Fatalf("expected awards held at half the request, got %.2f and %.2f", applicants[0].Awarded, applicants[1].Awarded)
+	}
+	if swept := summarize(applicants, 20000, awarded, "").SweptAmount; swept != 0 {
+		t.Fatalf("expected nothing swept past the max percent, got %.2f", swept)
+	}
+
+	clone := cloneApplicants(applicants)
+	opts.AwardIncrement = 100
+	allocateBudget(clone, 2250, opts)
+	if clone[0].Awarded != 1000 || clone[1].Awarded != 1200 || clone[1].Constraint != constraintBudget {
+		t.Fatalf("expected the swept award floored to the increment, got %.2f and %.2f (%s)", clone[0].Awarded, clone[1].Awarded, clone[1].Constraint)
+	}
+}
+
+func TestTopupLeftoverFundsPartialAwardsInPriorityOrder(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("high-1", "high", 99, 2500),
+		buildApplicant("medium-1", "medium", 90, 1000),
+		buildApplicant("low-1", "low", 80, 1500),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(500, 3000)
+	opts.ReserveHigh = 0.2
+	opts.ReserveLow = 0.2
+	opts.TopupLeftover = true
+	awarded := allocateBudget(applicants, 4375, opts)
+	summary := summarize(applicants, 4375, awarded, "")
+
+	funded := make(map[string]*applicant)
+	for _, item := range awarded {
+		funded[item.ID] = item
+	}
+	if funded["high-1"].Awarded != 2500 || funded["high-1"].ToppedUp != 1625 {
+		t.Fatalf("expected high-1 topped up to its full request, got %.2f", funded["high-1"].Awarded)
+	}
+	if funded["high-1"].Constraint != constraintFull {
+		t.Fatalf("expected high-1 to be fully funded, got %q", funded["high-1"].Constraint)
+	}
+	if funded["low-1"].Awarded != 875 || funded["low-1"].ToppedUp != 0 {
+		t.Fatalf("expected low-1 to keep its partial award, got %.2f", funded["low-1"].Awarded)
+	}
+	if summary.TopupAmount != 1625 || summary.TopupCount != 1 || summary.SweptCount != 0 {
+		t.Fatalf("unexpected top-up summary: %.2f across %d", summary.TopupAmount, summary.TopupCount)
+	}
+	opts.Sweep = true
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "topup-leftover") {
+		t.Fatalf("expected sweep and topup-leftover to be rejected together, got %v", err)
+	}
+}
+
+func TestTopupLeftoverRespectsMaxPercent(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("high-1", "high", 99, 2500),
+		buildApplicant("low-1", "low", 80, 1500),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 5000)
+	opts.MaxPercent = 0.5
+	opts.ReserveLow = 0.2
+	opts.TopupLeftover = true
+	awarded := allocateBudget(applicants, 3000, opts)
+	summary := summarize(applicants, 3000, awarded, "")
+	if applicants[0].Awarded != 1250 || applicants[0].ToppedUp != 0 {
+		t.Fatalf("expected high-1 held at half its request, got %.2f", applicants[0].Awarded)
+	}
+	if applicants[1].Awarded != 750 || applicants[1].ToppedUp != 150 {
+		t.Fatalf("expected low-1 topped up only to half its request, got %.2f (+%.2f)", applicants[1].Awarded, applicants[1].ToppedUp)
+	}
+	if summary.BudgetLeft != 1000 {
+		t.Fatalf("expected $1000 left once every award reached its cap, got %.2f", summary.BudgetLeft)
+	}
+}
+
+func TestLoadApplicantsStripsUTF8BOM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bom.csv")
+	content := "\ufeffapplicant_id,name,score,need_level,requested_amount\nA-1,Jordan Lee,92,high,1000\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("expected BOM-prefixed header to load, got %v", err)
+	}
+	if len(warnings) != 0 || len(applicants) != 1 || applicants[0].ID != "A-1" {
+		t.Fatalf("unexpected load result: %d applicants, warnings %v", len(applicants), warnings)
+	}
+
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 1000, defaultOptions(500, 1000))
+	if len(awarded) != 1 || awarded[0].Awarded != 1000 {
+		t.Fatalf("expected allocation to proceed, got %d awards", len(awarded))
+	}
+}
+
+func TestRequestWeightRaisesLargerRequestPriority(t *testing.T) {
+	small := buildApplicant("small", "medium", 90, 1000)
+	large := buildApplicant("large", "medium", 90, 4000)
+	applicants := []*applicant{small, large}
+	normalizeScores(applicants, 0)
+
+	assignPriority(applicants, defaultOptions(0, 0))
+	if small.PriorityScore != large.PriorityScore {
+		t.Fatalf("expected equal priority without request weight, got %.4f vs %.4f", small.PriorityScore, large.PriorityScore)
+	}
+
+	opts := defaultOptions(0, 0)
+	opts.RequestWeight = 0.5
+	assignPriority(applicants, opts)
+	if large.PriorityScore <= small.PriorityScore {
+		t.Fatalf("expected larger request to rank higher, got %.4f vs %.4f", large.PriorityScore, small.PriorityScore)
+	}
+	if !floatEquals(large.PriorityScore, (0.7*1+0.3*0.5+0.5*1)/1.5) {
+		t.Fatalf("unexpected weighted priority %.4f", large.PriorityScore)
+	}
+}
+
+func TestApplyPriorityPrecisionRoundsRecords(t *testing.T) {
+	summary := allocationSummary{
+		LastFundedPriority: 0.123456,
+		Awards:             []awardRecord{{ApplicantID: "A-1", Priority: 0.123456}},
+		Unfunded:           []awardRecord{{ApplicantID: "A-2", Priority: 0.987654}},
+	}
+	applyPriorityPrecision(&summary, 3)
+	if summary.PriorityPrecision != 3 {
+		t.Fatalf("expected precision 3, got %d", summary.PriorityPrecision)
+	}
+	if summary.LastFundedPriority != 0.123 || summary.Awards[0].Priority != 0.123 {
+		t.Fatalf("expected awards rounded to 0.123, got %v and %v", summary.LastFundedPriority, summary.Awards[0].Priority)
+	}
+	if summary.Unfunded[0].Priority != 0.988 {
+		t.Fatalf("expected unfunded rounded to 0.988, got %v", summary.Unfunded[0].Priority)
+	}
+	if got := formatFloat(summary.Awards[0].Priority, summary.PriorityPrecision); got != "0.123" {
+		t.Fatalf("expected formatted priority 0.123, got %s", got)
+	}
+}
+
+func TestFormatPrometheusWritesGaugesAndNeedLabels(t *testing.T) {
+	summary := allocationSummary{
+		BudgetUsed:            1500,
+		CoverageRate:          0.75,
+		EligibleUnfundedCount: 2,
+		NeedCoverage: map[string]needCoverageAgg{
+			"high": {CoverageRate: 1, AwardedTotal: 1000},
+			"low":  {CoverageRate: 0.25, AwardedTotal: 500, UnfundedCount: 2},
+		},
+	}
+	output := formatPrometheus(summary)
+	for _, want := range []string{
+		"# TYPE gs_award_budget_used gauge\n",
+		"gs_award_budget_used 1500\n",
+		"gs_award_coverage_rate 0.75\n",
+		"gs_award_eligible_unfunded 2\n",
+		"gs_award_need_coverage_rate{need=\"high\"} 1\n",
+		"gs_award_need_coverage_rate{need=\"low\"} 0.25\n",
+		"gs_award_need_unfunded{need=\"low\"} 2\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Count(output, "# TYPE gs_award_need_coverage_rate gauge") != 1 {
+		t.Fatalf("expected a single TYPE line per metric family, got:\n%s", output)
+	}
+}
+
+func TestWriteLettersRendersFundedApplicantsOnly(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "letter.md")
+	if err := os.WriteFile(templatePath, []byte("{{.Name}} receives {{.AwardedDisplay}} ({{.CoveredDisplay}} of request)"), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	summary := allocationSummary{
+		Awards: []awardRecord{
+			{ApplicantID: "A-1", Name: "Ada", Requested: 2000, Awarded: 1500},
+			{ApplicantID: "A/2", Requested: 1000, Awarded: 0},
+		},
+	}
+	outDir := filepath.Join(dir, "letters")
+	letters, err := writeLetters(outDir, templatePath, summary)
+	if err != nil {
+		t.Fatalf("write letters: %v", err)
+	}
+	if len(letters) != 1 || letters[0] != filepath.Join(outDir, "A-1.md") {
+		t.Fatalf("expected 1 letter at A-1.md, got %v", letters)
+	}
+	content, err := os.ReadFile(filepath.Join(outDir, "A-1.md"))
+	if err != nil {
+		t.Fatalf("read letter: %v", err)
+	}
+	if string(content) != "Ada receives $1500.00 (75.0% of request)" {
+		t.Fatalf("unexpected letter content: %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "A_2.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected no letter for unfunded applicant")
+	}
+}
+
+func TestMinRepresentFundsMatchingApplicantsFirst(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("top-1", "high", 95, 1000),
+		buildApplicant("top-2", "high", 90, 1000),
+		buildApplicant("first-gen", "low", 60, 1000),
+	}
+	applicants[0].Extras = map[string]string{"first_gen": "false"}
+	applicants[1].Extras = map[string]string{"first_gen": "false"}
+	applicants[2].Extras = map[string]string{"first_gen": "TRUE"}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	rules, err := parseRepresentRules("first_gen:true=1")
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	opts := defaultOptions(0, 1000)
+	opts.MinRepresent = rules
+	allocateBudget(applicants, 2000, opts)
+
+	if applicants[2].Awarded != 1000 {
+		t.Fatalf("expected first-gen applicant funded, got %.2f", applicants[2].Awarded)
+	}
+	if applicants[0].Awarded != 1000 || applicants[1].Awarded != 0 {
+		t.Fatalf("expected remaining budget to follow priority, got %.2f and %.2f", applicants[0].Awarded, applicants[1].Awarded)
+	}
+	results := summarizeRepresentation(applicants, rules)
+	if len(results) != 1 || !results[0].Met || results[0].AwardedCount != 1 || results[0].EligibleCount != 1 {
+		t.Fatalf("unexpected representation result: %+v", results)
+	}
+	if _, err := parseRepresentRules("first_gen=10"); err == nil {
+		t.Fatalf("expected error for rule without value")
+	}
+}
+
+func TestMinRepresentWithReserveStaysWithinBudget(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("eng-1", "high", 95, 2000),
+		buildApplicant("eng-2", "medium", 90, 2000),
+		buildApplicant("low-1", "low", 70, 2000),
+		buildApplicant("low-2", "low", 65, 2000),
+	}
+	for _, item := range applicants {
+		item.Extras = map[string]string{"cohort": "arts"}
+	}
+	applicants[0].Extras["cohort"] = "engineering"
+	applicants[1].Extras["cohort"] = "engineering"
+	prepApplicants(applicants, 0.7, 0.3)
+
+	rules, err := parseRepresentRules("cohort:engineering=2")
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+	opts := defaultOptions(0, 2000)
+	opts.MinRepresent = rules
+	opts.ReserveLow = 1
+	awarded := allocateBudget(applicants, 5000, opts)
+	if total := totalAwarded(awarded); total > 5000+invariantTolerance {
+		t.Fatalf("expected awards within the $5000 budget, got %.2f", total)
+	}
+	if applicants[0].Awarded != 2000 || applicants[1].Awarded != 2000 {
+		t.Fatalf("expected representation funded first, got %.2f and %.2f", applicants[0].Awarded, applicants[1].Awarded)
+	}
+}
+
+func TestEfficiencyBiasLetsSmallRequestOvertake(t *testing.T) {
+	large := buildApplicant("large", "medium", 80, 2000)
+	small := buildApplicant("small", "medium", 80, 500)
+	applicants := []*applicant{large, small}
+	normalizeScores(applicants, 0)
+
+	assignPriority(applicants, defaultOptions(0, 0))
+	if large.PriorityScore != small.PriorityScore {
+		t.Fatalf("expected equal base priority, got %.4f vs %.4f", large.PriorityScore, small.PriorityScore)
+	}
+	base := small.PriorityScore
+
+	opts := defaultOptions(0, 0)
+	opts.EfficiencyBias = 0.2
+	assignPriority(applicants, opts)
+	sortApplicants(applicants, nil)
+	if applicants[0].ID != "small" {
+		t.Fatalf("expected small request to rank first, got %s", applicants[0].ID)
+	}
+	if !floatEquals(small.PriorityScore, base*1.15) || !floatEquals(large.PriorityScore, base) {
+		t.Fatalf("unexpected biased priorities: small %.4f large %.4f", small.PriorityScore, large.PriorityScore)
+	}
+	opts = defaultOptions(0, 1000)
+	opts.EfficiencyBias = 1.5
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "efficiency-bias") {
+		t.Fatalf("expected efficiency-bias above 1 to be rejected")
+	}
+}
+
+func TestScoreMaxRefNormalizesAgainstFixedMaximum(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a", "high", 80, 1000),
+		buildApplicant("b", "high", 40, 1000),
+		buildApplicant("c", "high", 120, 1000),
+	}
+	normalizeScores(applicants, 100)
+	if !floatEquals(applicants[0].ScoreNorm, 0.8) || !floatEquals(applicants[1].ScoreNorm, 0.4) {
+		t.Fatalf("expected norms relative to 100, got %.3f and %.3f", applicants[0].ScoreNorm, applicants[1].ScoreNorm)
+	}
+	if applicants[2].ScoreNorm != 1 {
+		t.Fatalf("expected score above reference to clamp to 1, got %.3f", applicants[2].ScoreNorm)
+	}
+	normalizeScores(applicants, 0)
+	if !floatEquals(applicants[0].ScoreNorm, 80.0/120) {
+		t.Fatalf("expected observed max without reference, got %.3f", applicants[0].ScoreNorm)
+	}
+}
+
+func TestAmountScaleConvertsCentsOnParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cents.csv")
+	content := "applicant_id,score,need_level,requested_amount\nA-1,92,high,250000\nA-2,85,medium,120050\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	raw, _, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load unscaled: %v", err)
+	}
+	if warning := amountScaleWarning(raw, 5000); !strings.Contains(warning, "-amount-scale 0.01") {
+		t.Fatalf("expected scale mismatch warning, got %q", warning)
+	}
+
+	scaled, _, err := loadApplicants(path, 0.01, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load scaled: %v", err)
+	}
+	if !floatEquals(scaled[0].Requested, 2500) || !floatEquals(scaled[1].Requested, 1200.50) {
+		t.Fatalf("expected scaled requests 2500 and 1200.50, got %.2f and %.2f", scaled[0].Requested, scaled[1].Requested)
+	}
+	if warning := amountScaleWarning(scaled, 5000); warning != "" {
+		t.Fatalf("expected no warning after scaling, got %q", warning)
+	}
+}
+
+func TestApplyOptionOverridesKeepsStoredUnlessFlagSet(t *testing.T) {
+	stored := defaultOptions(500, 5000)
+	stored.Budget = 20000
+	stored.ReserveHigh = 0.4
+	flagged := defaultOptions(500, 3000)
+	flagged.Budget = 30000
+	flagged.ScoreWeight = 0.5
+
+	merged := applyOptionOverrides(stored, flagged, map[string]bool{"budget": true, "max": true})
+	if merged.Budget != 30000 || merged.MaxAward != 3000 {
+		t.Fatalf("expected set flags to override, got budget %.2f max %.2f", merged.Budget, merged.MaxAward)
+	}
+	if merged.ScoreWeight != 0.7 || merged.ReserveHigh != 0.4 {
+		t.Fatalf("expected unset flags to keep stored values, got score-weight %.2f reserve-high %.2f", merged.ScoreWeight, merged.ReserveHigh)
+	}
+}
+
+func TestCoverageLadderFindsMinimumBudgets(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "medium", 85, 1000),
+		buildApplicant("a-3", "low", 75, 2000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(0, 1500)
+
+	steps := buildCoverageLadder(applicants, opts)
+	if len(steps) != 10 {
+		t.Fatalf("expected 10 ladder steps, got %d", len(steps))
+	}
+	if !steps[4].Reachable || !floatEquals(steps[4].Budget, 2000) {
+		t.Fatalf("expected 50%% coverage at $2000, got %#v", steps[4])
+	}
+	if !steps[7].Reachable || !floatEquals(steps[7].Budget, 3200) || !floatEquals(steps[7].MarginalBudget, 400) {
+		t.Fatalf("expected 80%% coverage at $3200 (+$400), got %#v", steps[7])
+	}
+	if steps[8].Reachable {
+		t.Fatalf("expected 90%% coverage to be unreachable with a $1500 cap")
+	}
+	if applicants[0].Awarded != 0 {
+		t.Fatalf("expected ladder to leave the original applicants untouched")
+	}
+}
+
+func TestAnonymizedLabelsKeepApplicantID(t *testing.T) {
+	if label := formatApplicantLabel("A-1", "Jordan Lee", true); label != "J. L. (A-1)" {
+		t.Fatalf("expected masked label, got %q", label)
+	}
+	if label := formatApplicantLabel("A-2", "  élise   de  vries ", true); label != "É. D. V. (A-2)" {
+		t.Fatalf("expected masked multi-part label, got %q", label)
+	}
+	if label := formatApplicantLabel("A-3", "", true); label != "A-3" {
+		t.Fatalf("expected bare ID without a name, got %q", label)
+	}
+	if label := formatApplicantLabel("A-1", "Jordan Lee", false); label != "Jordan Lee (A-1)" {
+		t.Fatalf("expected full name when not anonymized, got %q", label)
+	}
+}
+
+func TestMinScoreByNeedTier(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("high-pass", "high", 62, 1000),
+		buildApplicant("high-fail", "high", 55, 1000),
+		buildApplicant("medium-fail", "medium", 68, 1000),
+		buildApplicant("medium-pass", "medium", 72, 1000),
+		buildApplicant("low-fail", "low", 78, 1000),
+		buildApplicant("low-pass", "low", 85, 1000),
+	}
+	applyMinScore(applicants, 70, needMinScores{High: 60, Medium: -1, Low: 80})
+
+	eligible := map[string]bool{}
+	reasons := map[string]string{}
+	for _, item := range applicants {
+		eligible[item.ID] = item.Eligible
+		reasons[item.ID] = item.EligibilityMsg
+	}
+	for _, id := range []string{"high-pass", "medium-pass", "low-pass"} {
+		if !eligible[id] {
+			t.Fatalf("expected %s to be eligible, got %q", id, reasons[id])
+		}
+	}
+	if reasons["high-fail"] != "score below high-need minimum (60.0)" {
+		t.Fatalf("unexpected high-need reason: %q", reasons["high-fail"])
+	}
+	if reasons["medium-fail"] != "score below minimum (70.0)" {
+		t.Fatalf("expected medium to fall back to the global minimum, got %q", reasons["medium-fail"])
+	}
+	if reasons["low-fail"] != "score below low-need minimum (80.0)" {
+		t.Fatalf("unexpected low-need reason: %q", reasons["low-fail"])
+	}
+}
+
+func TestOtherAidReducesAwardToUnmetNeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aid.csv")
+	content := "applicant_id,score,need_level,requested_amount,other_aid\nA-1,90,high,4000,1500\nA-2,90,high,3000,\nA-3,95,high,2000,2000\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("load applicants: %v %v", err, warnings)
+	}
+	if applicants[2].Eligible || applicants[2].EligibilityMsg != "need already met" {
+		t.Fatalf("expected fully covered applicant to be ineligible, got %q", applicants[2].EligibilityMsg)
+	}
+
+	opts := defaultOptions(0, 5000)
+	opts.RequestWeight = 1
+	normalizeScores(applicants, 0)
+	assignPriority(applicants, opts)
+	sortApplicants(applicants, nil)
+	if applicants[0].ID != "A-2" {
+		t.Fatalf("expected larger unmet need to rank first, got %s", applicants[0].ID)
+	}
+
+	allocateBudget(applicants, 10000, opts)
+	aided := applicants[1]
+	if aided.ID != "A-1" || aided.Awarded != 2500 || aided.Requested != 4000 {
+		t.Fatalf("expected A-1 awarded its $2500 unmet need with request kept at $4000, got %#v", aided)
+	}
+	summary := summarize(applicants, 10000, []*applicant{applicants[0], aided}, "")
+	if summary.FullyFundedCount != 2 {
+		t.Fatalf("expected unmet-need awards to count as fully funded, got %d", summary.FullyFundedCount)
+	}
+}
+
+func TestCutoffExplanationReportsAdditionalBudget(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 2000),
+		buildApplicant("a-2", "high", 90, 1500),
+		buildApplicant("a-3", "medium", 85, 1000),
+		buildApplicant("a-4", "low", 80, 800),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(1000, 5000)
+	awarded := allocateBudget(applicants, 2500, opts)
+	if len(awarded) != 1 {
+		t.Fatalf("expected one award, got %d", len(awarded))
+	}
+
+	explanation := buildCutoffExplanation(applicants, 2500-totalAwarded(awarded), opts, 2)
+	if explanation.LastFunded == nil || explanation.LastFunded.ID != "a-1" {
+		t.Fatalf("expected a-1 as last funded, got %#v", explanation.LastFunded)
+	}
+	if len(explanation.Next) != 2 || explanation.Next[0].Applicant.ID != "a-2" || explanation.Next[1].Applicant.ID != "a-3" {
+		t.Fatalf("unexpected next unfunded applicants: %#v", explanation.Next)
+	}
+	if !floatEquals(explanation.Next[0].AdditionalToFund, 1000) || !floatEquals(explanation.Next[1].AdditionalToFund, 2000) {
+		t.Fatalf("expected $1000 and $2000 more, got %.2f and %.2f", explanation.Next[0].AdditionalToFund, explanation.Next[1].AdditionalToFund)
+	}
+}
+
+func TestConstraintSummaryCountsBindingLimits(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("full", "high", 99, 1000),
+		buildApplicant("max", "high", 95, 8000),
+		buildApplicant("percent", "high", 90, 4000),
+		buildApplicant("tail", "high", 85, 3000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(500, 5000)
+	opts.MaxPercent = 0.9
+
+	awarded := allocateBudget(applicants, 10000, opts)
+	summary := summarize(applicants, 10000, awarded, "")
+	expected := map[string]int{
+		constraintMaxPercent: 2,
+		constraintMaxAward:   1,
+		constraintBudget:     1,
+	}
+	for constraint, count := range expected {
+		if summary.ConstraintSummary[constraint] != count {
+			t.Fatalf("expected %d %s awards, got %v", count, constraint, summary.ConstraintSummary)
+		}
+	}
+
+	opts.MaxPercent = 1
+	if got := plannedConstraint(applicants[0], opts); got != constraintFull {
+		t.Fatalf("expected full request constraint, got %s", got)
+	}
+}
+
+func TestPreviewLimitsApplicantsAndScalesBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.csv")
+	var builder strings.Builder
+	builder.WriteString("applicant_id,score,need_level,requested_amount\n")
+	builder.WriteString("bad,oops,high,1000\n")
+	for i := 1; i <= 10; i++ {
+		builder.WriteString("A-" + strconv.Itoa(i) + ",80,high,1000\n")
+	}
+	if err := os.WriteFile(path, []byte(builder.String()), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	first, _, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 3)
+	if err != nil {
+		t.Fatalf("load preview: %v", err)
+	}
+	opts := defaultOptions(0, 5000)
+	first, preview, err := buildPreview(path, first, 3, false, 0, opts)
+	if err != nil {
+		t.Fatalf("build preview: %v", err)
+	}
+	if len(first) != 3 || first[2].ID != "A-3" || preview.Total != 10 {
+		t.Fatalf("expected first 3 of 10 valid rows, got %d applicants (last %s) of %d", len(first), first[len(first)-1].ID, preview.Total)
+	}
+	opts.Budget = 10000
+	scalePreviewBudgets(&opts, preview.BudgetScale)
+	if !floatEquals(opts.Budget, 3000) {
+		t.Fatalf("expected budget scaled to 3000, got %.2f", opts.Budget)
+	}
+
+	all, _, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load all: %v", err)
+	}
+	sampleA, randomPreview, _ := buildPreview(path, all, 4, true, 7, defaultOptions(0, 5000))
+	sampleB := sampleApplicants(all, 4, 7)
+	if len(sampleA) != 4 || randomPreview.Total != 10 || !floatEquals(randomPreview.BudgetScale, 0.4) {
+		t.Fatalf("unexpected random preview: %d applicants, %#v", len(sampleA), randomPreview)
+	}
+	for i := range sampleA {
+		if sampleA[i].ID != sampleB[i].ID {
+			t.Fatalf("expected seeded samples to match, got %s and %s", sampleA[i].ID, sampleB[i].ID)
+		}
+	}
+}
+
+// failingRows returns a header, then the same non-parse error forever.
+type failingRows struct{ reads int }
+
+func (f *failingRows) Read() ([]string, error) {
+	f.reads++
+	if f.reads == 1 {
+		return []string{"applicant_id", "score", "need_level", "requested_amount"}, nil
+	}
+	return nil, errors.New("disk unplugged")
+}
+
+func (f *failingRows) FieldPos(field int) (int, int) {
+	return f.reads, field + 1
+}
+
+func TestReadApplicantsStopsOnReadErrors(t *testing.T) {
+	rows := &failingRows{}
+	_, _, err := readApplicants(rows, 1, false, nil, nil, idNormalization{}, 0)
+	if err == nil || !strings.Contains(err.Error(), "unable to read the row after line 1: disk unplugged") {
+		t.Fatalf("expected the read error to stop the load, got %v", err)
+	}
+	if rows.reads != 2 {
+		t.Fatalf("expected the load to stop after the failed read, got %d reads", rows.reads)
+	}
+}
+
+func TestParseAmountHandlesThousandsSeparators(t *testing.T) {
+	cases := []struct {
+		raw          string
+		decimalComma bool
+		want         float64
+	}{
+		{"1,250.00", false, 1250},
+		{"12,345,678.5", false, 12345678.5},
+		{"2500", false, 2500},
+		{"1.250,00", true, 1250},
+		{"12.345,5", true, 12345.5},
+		{"800,75", true, 800.75},
+	}
+	for _, tc := range cases {
+		got, err := parseAmount(tc.raw, tc.decimalComma)
+		if err != nil || !floatEquals(got, tc.want) {
+			t.Fatalf("parseAmount(%q, %v) = %.2f, %v; want %.2f", tc.raw, tc.decimalComma, got, err, tc.want)
+		}
+	}
+	for _, raw := range []string{"1,5", "12,50.00", "1.250,00"} {
+		if _, err := parseAmount(raw, false); err == nil {
+			t.Fatalf("expected %q to be rejected without -decimal-comma", raw)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "eu.csv")
+	content := "applicant_id,score,need_level,requested_amount\nA-1,90,high,\"1.250,00\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, true, nil, nil, idNormalization{}, 0)
+	if err != nil || len(warnings) != 0 || !floatEquals(applicants[0].Requested, 1250) {
+		t.Fatalf("expected European amount to load as 1250, got %v %v", err, warnings)
+	}
+}
+
+func TestWriteSummaryCSVFlattensMetrics(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 2000),
+		buildApplicant("a-2", "low", 70, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 2500, defaultOptions(500, 5000))
+	summary := summarize(applicants, 2500, awarded, "")
+
+	path := filepath.Join(t.TempDir(), "summary.csv")
+	if err := writeSummaryCSV(path, summary); err != nil {
+		t.Fatalf("write summary CSV: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read summary CSV: %v", err)
+	}
+	content := string(data)
+	for _, row := range []string{
+		"metric,value\n",
+		"budget,2500.00\n",
+		"awarded_count,2\n",
+		"coverage_rate,0.8333\n",
+		"need.high.awarded_total,2000.00\n",
+		"need.low.coverage_rate,0.5000\n",
+	} {
+		if !strings.Contains(content, row) {
+			t.Fatalf("expected summary CSV to contain %q, got:\n%s", row, content)
+		}
+	}
+}
+
+func TestShadowComparisonCountsAdditionalFunded(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "medium", 85, 1000),
+		buildApplicant("a-3", "low", 75, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(1000, 5000)
+	awarded := allocateBudget(applicants, 1000, opts)
+
+	comparison := buildShadowComparison(applicants, awarded, 1000, 3000, opts)
+	if comparison.Actual.AwardedCount != 1 || comparison.Shadow.AwardedCount != 3 || comparison.AdditionalFunded != 2 {
+		t.Fatalf("unexpected shadow comparison: %#v", comparison)
+	}
+	if !floatEquals(comparison.Shadow.CoverageRate, 1) || comparison.Shadow.EligibleUnfundedCount != 0 {
+		t.Fatalf("expected full coverage at shadow budget, got %#v", comparison.Shadow)
+	}
+	if applicants[1].Awarded != 0 {
+		t.Fatalf("expected shadow scenario to leave actual awards untouched")
+	}
+}
+
+func TestFlagCappedCountsMaxCappedAwards(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("big", "high", 95, 10000),
+		buildApplicant("small", "medium", 90, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 20000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 20000, awarded, "")
+	if summary.MaxCappedCount != 1 || !floatEquals(summary.MaxCappedTrimmed, 5000) {
+		t.Fatalf("expected one max-capped award trimmed by 5000, got %d / %.2f", summary.MaxCappedCount, summary.MaxCappedTrimmed)
+	}
+
+	path := filepath.Join(t.TempDir(), "awards.csv")
+	if err := writeAwardsCSV(path, summary.Awards, 4, true, false); err != nil {
+		t.Fatalf("write awards CSV: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read awards CSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if !strings.HasSuffix(lines[0], ",capped_by") || !strings.HasSuffix(lines[1], ",max_award") || !strings.HasSuffix(lines[2], ",") {
+		t.Fatalf("unexpected capped_by column:\n%s", data)
+	}
+}
+
+func TestNoEligibleMessageListsTopReasons(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 40, 1000),
+		buildApplicant("a-2", "medium", 45, 1000),
+		buildApplicant("a-3", "unknown", 90, 1000),
+	}
+	markIneligible(applicants[2], "need_level must be low, medium, or high")
+	applyMinScore(applicants, 50, needMinScores{High: -1, Medium: -1, Low: -1})
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 5000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 5000, awarded, "")
+	if summary.EligibleCount != 0 || len(awarded) != 0 {
+		t.Fatalf("expected no eligible applicants, got %d eligible", summary.EligibleCount)
+	}
+
+	message := noEligibleMessage(summary, 0)
+	for _, want := range []string{"all 3 applicants were ineligible", "- score below minimum (50.0): 2", "- need_level must be low, medium, or high: 1"} {
+		if !strings.Contains(message, want) {
+			t.Fatalf("expected message to contain %q, got:\n%s", want, message)
+		}
+	}
+
+	message = noEligibleMessage(summary, 1)
+	if !strings.Contains(message, "- score below minimum (50.0): 2") || strings.Contains(message, "- need_level") || !strings.Contains(message, "... 1 more") {
+		t.Fatalf("expected -ineligible-reasons-top 1 to show one reason, got:\n%s", message)
+	}
+}
+
+func TestSummarizeListsTiedBoundaryApplicants(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 80, 1000),
+		buildApplicant("a-2", "high", 80, 1000),
+		buildApplicant("a-3", "high", 80, 1000),
+		buildApplicant("a-4", "low", 50, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 2000, defaultOptions(500, 1000))
+	summary := summarize(applicants, 2000, awarded, "")
+
+	if len(summary.Boundary) != 3 {
+		t.Fatalf("expected 3 boundary applicants, got %d", len(summary.Boundary))
+	}
+	var funded int
+	for _, item := range summary.Boundary {
+		if item.Priority != summary.LastFundedPriority {
+			t.Fatalf("expected boundary priority %.4f, got %.4f", summary.LastFundedPriority, item.Priority)
+		}
+		if item.Funded {
+			funded++
+		}
+	}
+	if funded != 2 || summary.Boundary[2].Funded {
+		t.Fatalf("expected the first two tied applicants funded, got %+v", summary.Boundary)
+	}
+
+	untied := []*applicant{
+		buildApplicant("b-1", "high", 90, 1000),
+		buildApplicant("b-2", "low", 50, 1000),
+	}
+	prepApplicants(untied, 0.7, 0.3)
+	awarded = allocateBudget(untied, 1000, defaultOptions(500, 1000))
+	if boundary := summarize(untied, 1000, awarded, "").Boundary; boundary != nil {
+		t.Fatalf("expected no boundary without ties, got %+v", boundary)
+	}
+}
+
+func TestCheckInvariantsAcrossParameterSweep(t *testing.T) {
+	cases := []struct {
+		name   string
+		budget float64
+		adjust func(*runOptions)
+	}{
+		{name: "tight budget", budget: 1500},
+		{name: "ample budget", budget: 20000},
+		{name: "rounded awards", budget: 4000, adjust: func(opts *runOptions) { opts.RoundTo = 250 }},
+		{name: "max percent", budget: 4000, adjust: func(opts *runOptions) { opts.MaxPercent = 0.6 }},
+		{name: "low reserve", budget: 3000, adjust: func(opts *runOptions) { opts.ReserveLow = 0.3 }},
+		{name: "sweep", budget: 3500, adjust: func(opts *runOptions) { opts.Sweep = true }},
+		{name: "representation with reserve", budget: 2500, adjust: func(opts *runOptions) {
+			opts.MinRepresent = []representRule{{Column: "cohort", Value: "engineering", Count: 2}}
+			opts.ReserveLow = 1
+		}},
+		{name: "max percent with sweep", budget: 20000, adjust: func(opts *runOptions) {
+			opts.MaxPercent = 0.5
+			opts.Sweep = true
+		}},
+		{name: "max percent with topup", budget: 3000, adjust: func(opts *runOptions) {
+			opts.MaxPercent = 0.5
+			opts.ReserveLow = 0.2
+			opts.TopupLeftover = true
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			applicants := []*applicant{
+				buildApplicant("a-1", "high", 92, 1800),
+				buildApplicant("a-2", "medium", 75, 1200),
+				buildApplicant("a-3", "low", 60, 900),
+				buildApplicant("a-4", "low", 55, 700),
+				buildApplicant("a-5", "high", 40, 1500),
+			}
+			for i, item := range applicants {
+				item.Extras = map[string]string{"cohort": "arts"}
+				if i < 2 {
+					item.Extras["cohort"] = "engineering"
+				}
+			}
+			markIneligible(applicants[4], "missing transcript")
+			opts := defaultOptions(500, 1500)
+			opts.Budget = tc.budget
+			if tc.adjust != nil {
+				tc.adjust(&opts)
+			}
+			prepApplicants(applicants, 0.7, 0.3)
+			awarded := allocateBudget(applicants, tc.budget, opts)
+			summary := summarize(applicants, tc.budget, awarded, "")
+			if err := checkInvariants(applicants, summary, opts); err != nil {
+				t.Fatalf("unexpected invariant violation: %v", err)
+			}
+		})
+	}
+
+	applicants := []*applicant{
+		buildApplicant("b-1", "high", 90, 1000),
+		buildApplicant("b-2", "low", 60, 1000),
+	}
+	markIneligible(applicants[1], "missing transcript")
+	applicants[0].Awarded = 1200
+	applicants[1].Awarded = 300
+	summary := allocationSummary{Budget: 1000, BudgetUsed: 1200}
+	err := checkInvariants(applicants, summary, defaultOptions(500, 1500))
+	if err == nil {
+		t.Fatal("expected invariant violations")
+	}
+	for _, want := range []string{"ineligible applicant b-2", "exceeds budget", "does not match awards total"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected violation %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestMatchMultiplierReportsEffectiveAwards(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "applicants.csv")
+	data := "applicant_id,name,score,need_level,requested_amount,match_multiplier\n" +
+		"a-1,Alex,90,high,1000,2\n" +
+		"a-2,Bea,80,medium,1000,\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, _, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if applicants[0].Match != 2 || applicants[1].Match != 1 {
+		t.Fatalf("expected multipliers 2 and 1, got %.2f and %.2f", applicants[0].Match, applicants[1].Match)
+	}
+
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 1500, defaultOptions(500, 1000))
+	summary := summarize(applicants, 1500, awarded, "")
+	if !floatEquals(summary.BudgetUsed, 1500) {
+		t.Fatalf("expected real spend of 1500, got %.2f", summary.BudgetUsed)
+	}
+	if !floatEquals(summary.TotalEffectiveAwarded, 2500) {
+		t.Fatalf("expected effective total 2500, got %.2f", summary.TotalEffectiveAwarded)
+	}
+	if !floatEquals(summary.Awards[0].Effective, 2000) || !floatEquals(summary.Awards[1].Effective, 500) {
+		t.Fatalf("unexpected effective awards: %+v", summary.Awards)
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	if err := os.WriteFile(bad, []byte("applicant_id,name,score,need_level,requested_amount,match_multiplier\na-1,Alex,90,high,1000,-1\na-2,Bea,80,medium,1000,1.5\n"), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	_, warnings, err := loadApplicants(bad, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "line 2: invalid match_multiplier" {
+		t.Fatalf("expected a match_multiplier warning, got %v", warnings)
+	}
+}
+
+func TestResolveBudgetFallsBackToEnvironment(t *testing.T) {
+	t.Setenv("GS_AWARD_ALLOCATOR_BUDGET", " 25000 ")
+	budget, source, err := resolveBudget(0, false)
+	if err != nil || budget != 25000 || source != "environment (GS_AWARD_ALLOCATOR_BUDGET)" {
+		t.Fatalf("expected env budget 25000, got %.2f from %q (%v)", budget, source, err)
+	}
+
+	budget, source, err = resolveBudget(12000, true)
+	if err != nil || budget != 12000 || source != "flag" {
+		t.Fatalf("expected flag budget to win, got %.2f from %q (%v)", budget, source, err)
+	}
+
+	t.Setenv("GS_AWARD_ALLOCATOR_BUDGET", "lots")
+	if _, _, err := resolveBudget(0, false); err == nil {
+		t.Fatal("expected an error for a non-numeric env budget")
+	}
+
+	t.Setenv("GS_AWARD_ALLOCATOR_BUDGET", "")
+	budget, source, err = resolveBudget(0, false)
+	if err != nil || budget != 0 || source != "unset" {
+		t.Fatalf("expected an unset budget, got %.2f from %q (%v)", budget, source, err)
+	}
+}
+
+func TestTierStrictFundsHigherTiersFirst(t *testing.T) {
+	build := func() []*applicant {
+		applicants := []*applicant{
+			buildApplicant("m-1", "medium", 100, 1000),
+			buildApplicant("l-1", "low", 100, 1000),
+			buildApplicant("h-1", "high", 20, 1000),
+			buildApplicant("h-2", "high", 10, 1000),
+		}
+		prepApplicants(applicants, 0.9, 0.1)
+		return applicants
+	}
+
+	opts := defaultOptions(500, 1000)
+	applicants := build()
+	if applicants[0].ID != "m-1" {
+		t.Fatalf("expected m-1 to lead on priority, got %s", applicants[0].ID)
+	}
+	awarded := allocateBudget(applicants, 2000, opts)
+	if awarded[0].ID != "m-1" {
+		t.Fatalf("expected priority order to fund m-1 first, got %s", awarded[0].ID)
+	}
+
+	opts.TierStrict = true
+	applicants = build()
+	awarded = allocateBudget(applicants, 2500, opts)
+	var ids []string
+	for _, item := range awarded {
+		ids = append(ids, item.ID)
+	}
+	if strings.Join(ids, ",") != "h-1,h-2,m-1" {
+		t.Fatalf("expected high tier before medium, got %v", ids)
+	}
+	if !floatEquals(awarded[2].Awarded, 500) || applicants[1].Awarded != 0 {
+		t.Fatalf("expected the medium tier to take the remaining 500 and low nothing, got %.2f and %.2f", awarded[2].Awarded, applicants[1].Awarded)
+	}
+}
+
+func TestSortAwardRecordsKeepsFundingRank(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-3", "low", 95, 800),
+		buildApplicant("a-1", "high", 70, 1200),
+		buildApplicant("a-2", "medium", 60, 1000),
+	}
+	applicants[0].Name = "Casey"
+	applicants[1].Name = "avery"
+	applicants[2].Name = "Blake"
+	prepApplicants(applicants, 1, 0)
+	awarded := allocateBudget(applicants, 5000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 5000, awarded, "")
+	funding := make(map[string]int)
+	for _, record := range summary.Awards {
+		funding[record.ApplicantID] = record.Rank
+	}
+
+	cases := map[string]string{
+		"priority":     "a-3,a-1,a-2",
+		"name":         "a-1,a-2,a-3",
+		"need":         "a-1,a-2,a-3",
+		"awarded-desc": "a-1,a-2,a-3",
+		"id":           "a-1,a-2,a-3",
+	}
+	for field, want := range cases {
+		records := append([]awardRecord(nil), summary.Awards...)
+		sortAwardRecords(records, field)
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.ApplicantID)
+			if record.Rank != funding[record.ApplicantID] {
+				t.Fatalf("%s: expected %s to keep funding rank %d, got %d", field, record.ApplicantID, funding[record.ApplicantID], record.Rank)
+			}
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Fatalf("%s: expected order %s, got %s", field, want, got)
+		}
+	}
+	if validAwardSort("score") {
+		t.Fatal("expected score to be rejected as a sort field")
+	}
+}
+
+type fakeCopier struct {
+	table   pgx.Identifier
+	columns []string
+	rows    [][]any
+	err     error
+}
+
+func (f *fakeCopier) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.table = tableName
+	f.columns = columnNames
+	for rowSrc.Next() {
+		values, err := rowSrc.Values()
+		if err != nil {
+			return int64(len(f.rows)), err
+		}
+		f.rows = append(f.rows, values)
+	}
+	return int64(len(f.rows)), rowSrc.Err()
+}
+
+func TestCopyApplicantsStreamsRows(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "low", 60, 500),
+	}
+	applicants[0].Awarded = 1000
+	markIneligible(applicants[1], "missing transcript")
+	runID := uuid.New()
+
+	copier := &fakeCopier{}
+	copied, err := copyApplicants(context.Background(), copier, "gs_award_allocator", runID, applicants)
+	if err != nil || copied != 2 {
+		t.Fatalf("expected 2 copied rows, got %d (%v)", copied, err)
+	}
+	if copier.table.Sanitize() != `"gs_award_allocator"."applicants"` {
+		t.Fatalf("unexpected table %s", copier.table.Sanitize())
+	}
+	if len(copier.columns) != len(copier.rows[0]) {
+		t.Fatalf("expected %d values per row, got %d", len(copier.columns), len(copier.rows[0]))
+	}
+	if copier.rows[0][0] != runID || copier.rows[0][1] != "a-1" || copier.rows[0][10] != 1000.0 {
+		t.Fatalf("unexpected first row: %v", copier.rows[0])
+	}
+	if copier.rows[1][11] != false || copier.rows[1][12] != "missing transcript" {
+		t.Fatalf("unexpected second row: %v", copier.rows[1])
+	}
+
+	failing := &fakeCopier{err: errors.New("copy not permitted")}
+	if _, err := copyApplicants(context.Background(), failing, "gs_award_allocator", runID, applicants); err == nil || !strings.Contains(err.Error(), "copy not permitted") {
+		t.Fatalf("expected the copy error to be returned, got %v", err)
+	}
+}
+
+func TestLoadApplicantsWarnsOnMixedNeedSpellings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "applicants.csv")
+	data := "applicant_id,score,need_level,requested_amount\n" +
+		"a-1,90,High,1000\n" +
+		"a-2,80,HIGH,1000\n" +
+		"a-3,70,high,1000\n" +
+		"a-4,60,low,1000\n" +
+		"a-5,50,low,1000\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if applicants[1].NeedLevel != "high" {
+		t.Fatalf("expected need levels to be normalized, got %q", applicants[1].NeedLevel)
+	}
+	if len(warnings) != 1 || warnings[0] != "need_level has mixed spellings: High, HIGH, high" {
+		t.Fatalf("expected one mixed spelling warning, got %v", warnings)
+	}
+}
+
+func TestRoundToSetSnapsToNearestStandardAmount(t *testing.T) {
+	set, err := parseRoundSet("2500, 500,1000,1500,1000,5000")
+	if err != nil {
+		t.Fatalf("parse round set: %v", err)
+	}
+	if len(set) != 5 || set[0] != 500 || set[4] != 5000 {
+		t.Fatalf("expected sorted unique amounts, got %v", set)
+	}
+
+	snaps := []struct {
+		value float64
+		want  float64
+	}{
+		{value: 1100, want: 1000},
+		{value: 1400, want: 1500},
+		{value: 1250, want: 1000}, // equidistant between 1000 and 1500: lower wins
+		{value: 2000, want: 1500}, // equidistant between 1500 and 2500: lower wins
+		{value: 3750, want: 2500}, // 5000 is above the 4000 cap
+	}
+	for _, tc := range snaps {
+		if got := roundToSet(tc.value, set, 500, 4000); got != tc.want {
+			t.Fatalf("value %.2f: expected %.2f, got %.2f", tc.value, tc.want, got)
+		}
+	}
+	if got := roundToSet(300, set, 100, 400); got != 300 {
+		t.Fatalf("expected a value with no standard amount inside the caps to stay unrounded, got %.2f", got)
+	}
+
+	// Awards are capped at the request, so snapping never rounds above it.
+	if got := computeAward(1400, 500, 4000, 0, set, 1, 0); got != 1000 {
+		t.Fatalf("expected a 1400 request to snap down to 1000, got %.2f", got)
+	}
+	if got := computeAward(9000, 500, 4000, 0, set, 1, 0); got != 2500 {
+		t.Fatalf("expected a max-capped award to snap to 2500, got %.2f", got)
+	}
+
+	if _, err := parseRoundSet("500,abc"); err == nil {
+		t.Fatal("expected an error for a non-numeric amount")
+	}
+	opts := defaultOptions(500, 5000)
+	opts.RoundTo = 100
+	opts.RoundSet = set
+	if err := validateOptions(opts); err == nil {
+		t.Fatal("expected round and round-to-set to be rejected together")
+	}
+}
+
+func TestSortOutputByIDOrdersFileRecords(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("c-3", "high", 95, 1000),
+		buildApplicant("a-1", "medium", 85, 1000),
+		buildApplicant("d-4", "low", 75, 1000),
+		buildApplicant("b-2", "low", 65, 1000),
+		buildApplicant("f-6", "high", 40, 1000),
+		buildApplicant("e-5", "high", 30, 1000),
+	}
+	markIneligible(applicants[4], "missing transcript")
+	markIneligible(applicants[5], "missing transcript")
+	prepApplicants(applicants, 1, 0)
+	awarded := allocateBudget(applicants, 2000, defaultOptions(500, 1000))
+	summary := summarize(applicants, 2000, awarded, "")
+
+	sorted := sortOutputByID(summary)
+	ids := func(records []awardRecord) string {
+		var out []string
+		for _, record := range records {
+			out = append(out, record.ApplicantID)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := ids(sorted.Awards); got != "a-1,c-3" {
+		t.Fatalf("expected awards sorted by id, got %s", got)
+	}
+	if got := ids(sorted.Unfunded); got != "b-2,d-4" {
+		t.Fatalf("expected unfunded sorted by id, got %s", got)
+	}
+	if sorted.Ineligible[0].ApplicantID != "e-5" || sorted.Ineligible[1].ApplicantID != "f-6" {
+		t.Fatalf("expected ineligible sorted by id, got %+v", sorted.Ineligible)
+	}
+	if got := ids(summary.Awards); got != "c-3,a-1" {
+		t.Fatalf("expected the console summary to keep priority order, got %s", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "awards.csv")
+	if err := writeAwardsCSV(path, sorted.Awards, 4, false, false); err != nil {
+		t.Fatalf("write awards CSV: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read awards CSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if !strings.HasPrefix(lines[1], "a-1,") || !strings.HasPrefix(lines[2], "c-3,") {
+		t.Fatalf("expected CSV rows sorted by id:\n%s", data)
+	}
+}
+
+func TestMinMeaningfulAwardStrandsSmallRemainder(t *testing.T) {
+	build := func() []*applicant {
+		applicants := []*applicant{
+			buildApplicant("a-1", "high", 95, 1000),
+			buildApplicant("a-2", "high", 90, 700),
+			buildApplicant("a-3", "low", 50, 250),
+		}
+		prepApplicants(applicants, 1, 0)
+		return applicants
+	}
+
+	opts := defaultOptions(100, 1000)
+	applicants := build()
+	awarded := allocateBudget(applicants, 2000, opts)
+	if len(awarded) != 3 {
+		t.Fatalf("expected the small request to be funded without a threshold, got %d awards", len(awarded))
+	}
+
+	opts.MinMeaningful = 400
+	applicants = build()
+	awarded = allocateBudget(applicants, 2000, opts)
+	if len(awarded) != 2 || applicants[2].Awarded != 0 {
+		t.Fatalf("expected allocation to stop after two awards, got %d", len(awarded))
+	}
+	summary := summarize(applicants, 2000, awarded, "")
+	if stranded := strandedBudget(summary.BudgetLeft, opts.MinMeaningful); !floatEquals(stranded, 300) {
+		t.Fatalf("expected 300 stranded, got %.2f", stranded)
+	}
+	if stranded := strandedBudget(500, opts.MinMeaningful); stranded != 0 {
+		t.Fatalf("expected a remainder above the threshold not to count as stranded, got %.2f", stranded)
+	}
+}
+
+func TestWriteOutputsManifestHashesFiles(t *testing.T) {
+	dir := t.TempDir()
+	awardsPath := filepath.Join(dir, "awards.csv")
+	if err := os.WriteFile(awardsPath, []byte("applicant_id\na-1\n"), 0o644); err != nil {
+		t.Fatalf("write awards: %v", err)
+	}
+	manifestPath := filepath.Join(dir, "outputs.json")
+	files := []outputFile{{Path: awardsPath, Type: "awards_csv"}}
+	if err := writeOutputsManifest(manifestPath, "2026-01-01T00:00:00Z", files); err != nil {
+		t.Fatalf("write outputs manifest: %v", err)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("read outputs manifest: %v", err)
+	}
+	var manifest outputsManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("parse outputs manifest: %v", err)
+	}
+	want, err := fileSHA256(awardsPath)
+	if err != nil {
+		t.Fatalf("hash awards: %v", err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Type != "awards_csv" || manifest.Files[0].SHA256 != want {
+		t.Fatalf("unexpected outputs manifest: %s", data)
+	}
+
+	missing := []outputFile{{Path: filepath.Join(dir, "missing.csv"), Type: "unfunded_csv"}}
+	if err := writeOutputsManifest(manifestPath, "", missing); err == nil {
+		t.Fatal("expected an error for a missing output file")
+	}
+}
+
+func TestTiebreakRequestedDescFundsLargerRequestsFirst(t *testing.T) {
+	build := func() []*applicant {
+		applicants := []*applicant{
+			buildApplicant("small", "high", 80, 1000),
+			buildApplicant("large-a", "high", 70, 3000),
+			buildApplicant("large-b", "high", 80, 3000),
+			buildApplicant("mid", "high", 80, 2000),
+		}
+		for _, item := range applicants {
+			item.PriorityScore = 0.5
+		}
+		return applicants
+	}
+	order := func(applicants []*applicant) string {
+		var ids []string
+		for _, item := range applicants {
+			ids = append(ids, item.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	applicants := build()
+	sortApplicants(applicants, nil)
+	if got := order(applicants); got != "small,large-b,mid,large-a" {
+		t.Fatalf("expected the default score tiebreak, got %s", got)
+	}
+
+	tiebreak, err := parseTiebreak("requested-desc, score")
+	if err != nil {
+		t.Fatalf("parse tiebreak: %v", err)
+	}
+	applicants = build()
+	sortApplicants(applicants, tiebreak)
+	if got := order(applicants); got != "large-b,large-a,mid,small" {
+		t.Fatalf("expected larger requests first, then score, got %s", got)
+	}
+
+	applicants = build()
+	sortApplicants(applicants, []string{"requested-desc"})
+	if got := order(applicants); got != "large-a,large-b,mid,small" {
+		t.Fatalf("expected input order to break remaining ties, got %s", got)
+	}
+	awarded := allocatePool(applicants, 4000, defaultOptions(500, 5000))
+	if len(awarded) != 2 || awarded[0].ID != "large-a" || !floatEquals(awarded[1].Awarded, 1000) {
+		t.Fatalf("expected fewer, bigger awards, got %d awards", len(awarded))
+	}
+
+	if _, err := parseTiebreak("random"); err == nil {
+		t.Fatal("expected an unknown tiebreak to be rejected")
+	}
+}
+
+func TestNeedWeightColumnOverridesNeedLevel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "applicants.csv")
+	data := "applicant_id,score,need_level,requested_amount,need_weight\n" +
+		"a-1,80,low,1000,0.9\n" +
+		"a-2,80,high,1000,\n" +
+		"a-3,80,high,1000,0.2\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("load applicants: %v %v", err, warnings)
+	}
+	opts := defaultOptions(0, 0)
+	opts.ScoreWeight = 0
+	opts.NeedWeight = 1
+	normalizeScores(applicants, 0)
+	assignPriority(applicants, opts)
+
+	want := map[string]float64{"a-1": 0.9, "a-2": 1, "a-3": 0.2}
+	for _, item := range applicants {
+		if !floatEquals(item.PriorityScore, want[item.ID]) {
+			t.Fatalf("%s: expected priority %.2f, got %.4f", item.ID, want[item.ID], item.PriorityScore)
+		}
+	}
+	if applicants[0].NeedLevel != "low" {
+		t.Fatalf("expected need_level to stay the bucketing level, got %s", applicants[0].NeedLevel)
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	if err := os.WriteFile(bad, []byte("applicant_id,score,need_level,requested_amount,need_weight\na-1,80,low,1000,1.5\na-2,80,low,1000,0.5\n"), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	_, warnings, err = loadApplicants(bad, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "line 2: need_weight must be between 0 and 1" {
+		t.Fatalf("expected a need_weight range warning, got %v", warnings)
+	}
+}
+
+func TestPassBreakdownReportsReserveSpending(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("h-1", "high", 95, 1000),
+		buildApplicant("h-2", "high", 90, 1000),
+		buildApplicant("m-1", "medium", 85, 1000),
+		buildApplicant("l-1", "low", 60, 1000),
+		buildApplicant("l-2", "low", 55, 600),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(500, 1000)
+	opts.ReserveHigh = 0.25
+	opts.ReserveLow = 0.4
+	awarded := allocateBudget(applicants, 4000, opts)
+	summary := summarize(applicants, 4000, awarded, "")
+
+	want := []passResult{
+		{Name: "reserve-high", Spent: 1000, Funded: 1},
+		{Name: "reserve-low", Spent: 1600, Funded: 2},
+		{Name: "general", Spent: 1000, Funded: 1},
+	}
+	if len(summary.PassBreakdown) != len(want) {
+		t.Fatalf("expected %d passes, got %+v", len(want), summary.PassBreakdown)
+	}
+	var spent float64
+	for i, pass := range summary.PassBreakdown {
+		if pass.Name != want[i].Name || !floatEquals(pass.Spent, want[i].Spent) || pass.Funded != want[i].Funded {
+			t.Fatalf("pass %d: expected %+v, got %+v", i, want[i], pass)
+		}
+		spent += pass.Spent
+	}
+	if !floatEquals(spent, summary.BudgetUsed) {
+		t.Fatalf("expected passes to sum to budget used %.2f, got %.2f", summary.BudgetUsed, spent)
+	}
+}
+
+func TestGapClosedPerDollar(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "medium", 80, 1500),
+		buildApplicant("a-3", "low", 70, 1500),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 3000, defaultOptions(500, 1500))
+	summary := summarize(applicants, 3000, awarded, "")
+	closed := summary.BudgetRequiredFull - summary.FundingGapTotal
+	if !floatEquals(summary.GapClosedPerDollar, closed/3000) || !floatEquals(summary.GapClosedPerDollar, 1) {
+		t.Fatalf("expected the full budget to close the gap 1:1, got %.4f", summary.GapClosedPerDollar)
+	}
+	if got := gapClosedPerDollar(4000, 1000, 0); got != 0 {
+		t.Fatalf("expected 0 for a zero budget, got %.4f", got)
+	}
+	if got := gapClosedPerDollar(4000, 2500, 2000); !floatEquals(got, 0.75) {
+		t.Fatalf("expected 0.75, got %.4f", got)
+	}
+}
+
+func TestRepeatPenaltyDropsFrequentRecipients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "applicants.csv")
+	data := "applicant_id,score,need_level,requested_amount,prior_awards\n" +
+		"veteran,95,high,1000,3\n" +
+		"fresh,85,high,1000,\n" +
+		"returning,90,high,1000,1\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	rank := func(penalty float64) string {
+		applicants, _, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+		if err != nil {
+			t.Fatalf("load applicants: %v", err)
+		}
+		opts := defaultOptions(0, 0)
+		opts.ScoreWeight = 0.7
+		opts.NeedWeight = 0.3
+		opts.RepeatPenalty = penalty
+		normalizeScores(applicants, 0)
+		assignPriority(applicants, opts)
+		sortApplicants(applicants, nil)
+		for _, item := range applicants {
+			if item.PriorityScore < 0 {
+				t.Fatalf("expected priority floored at 0, got %.4f for %s", item.PriorityScore, item.ID)
+			}
+		}
+		return applicants[0].ID + "," + applicants[1].ID + "," + applicants[2].ID
+	}
+
+	if got := rank(0); got != "veteran,returning,fresh" {
+		t.Fatalf("expected score order without a penalty, got %s", got)
+	}
+	if got := rank(0.05); got != "fresh,returning,veteran" {
+		t.Fatalf("expected the repeat recipient to drop, got %s", got)
+	}
+	// Both repeat recipients floor at 0 and fall back to the score tiebreak.
+	if got := rank(1); got != "fresh,veteran,returning" {
+		t.Fatalf("expected heavy penalties to floor at 0, got %s", got)
+	}
+}
+
+func TestNeedBinsBinIndexForReportingOnly(t *testing.T) {
+	bins, err := parseNeedBins("0.33,0.66")
+	if err != nil {
+		t.Fatalf("parse need bins: %v", err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "applicants.csv")
+	data := "applicant_id,score,need_index,requested_amount\n" +
+		"a-1,80,0.10,1000\n" +
+		"a-2,80,0.33,1000\n" +
+		"a-3,80,0.65,1000\n" +
+		"a-4,80,0.90,1000\n" +
+		"a-5,80,1.40,1000\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, bins, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "line 6: need_index must be between 0 and 1" {
+		t.Fatalf("expected a need_index range warning, got %v", warnings)
+	}
+	wantLevels := []string{"low", "medium", "medium", "high"}
+	for i, item := range applicants {
+		if item.NeedLevel != wantLevels[i] || !item.Eligible {
+			t.Fatalf("%s: expected eligible %s, got %s (%s)", item.ID, wantLevels[i], item.NeedLevel, item.EligibilityMsg)
+		}
+	}
+
+	opts := defaultOptions(0, 0)
+	opts.ScoreWeight = 0
+	opts.NeedWeight = 1
+	normalizeScores(applicants, 0)
+	assignPriority(applicants, opts)
+	if !floatEquals(applicants[2].PriorityScore, 0.65) || !floatEquals(applicants[1].PriorityScore, 0.33) {
+		t.Fatalf("expected priority to use the raw index, got %.4f and %.4f", applicants[2].PriorityScore, applicants[1].PriorityScore)
+	}
+
+	for _, raw := range []string{"0.66,0.33", "0.2,1.5", "0.5", "low,high"} {
+		if _, err := parseNeedBins(raw); err == nil {
+			t.Fatalf("expected need-bins %q to be rejected", raw)
+		}
+	}
+}
+
+func TestReserveModeSpreadSharesReserve(t *testing.T) {
+	build := func() []*applicant {
+		applicants := []*applicant{
+			buildApplicant("h-1", "high", 90, 1000),
+			buildApplicant("h-2", "high", 80, 600),
+			buildApplicant("h-3", "high", 70, 400),
+			buildApplicant("l-1", "low", 50, 1000),
+		}
+		prepApplicants(applicants, 0.7, 0.3)
+		return applicants
+	}
+
+	opts := defaultOptions(100, 1000)
+	opts.ReserveHigh = 0.4
+	applicants := build()
+	allocateBudget(applicants, 2500, opts)
+	if applicants[0].Pass != "reserve-high" || !floatEquals(applicants[0].Awarded, 1000) {
+		t.Fatalf("expected priority mode to give the whole reserve to h-1, got %s %.2f", applicants[0].Pass, applicants[0].Awarded)
+	}
+	if applicants[1].Pass == "reserve-high" {
+		t.Fatalf("expected h-2 to miss the reserve in priority mode")
+	}
+
+	opts.ReserveMode = reserveModeSpread
+	if err := validateOptions(opts); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	applicants = build()
+	allocateBudget(applicants, 2500, opts)
+	want := map[string]float64{"h-1": 500, "h-2": 300, "h-3": 200}
+	for _, item := range applicants[:3] {
+		if item.Pass != "reserve-high" || !floatEquals(item.Awarded, want[item.ID]) {
+			t.Fatalf("expected %s to get %.2f from the reserve, got %s %.2f", item.ID, want[item.ID], item.Pass, item.Awarded)
+		}
+		if item.Constraint != constraintBudget {
+			t.Fatalf("expected %s to be budget constrained, got %s", item.ID, item.Constraint)
+		}
+	}
+
+	opts.ReserveMode = "even"
+	if err := validateOptions(opts); err == nil {
+		t.Fatalf("expected an unknown reserve-mode to be rejected")
+	}
+}
+
+func TestReserveModesCompareForOneTier(t *testing.T) {
+	requests := map[string]float64{"h-1": 1000, "h-2": 800, "h-3": 600}
+	run := func(mode string) (map[string]float64, float64) {
+		applicants := []*applicant{
+			buildApplicant("h-1", "high", 90, requests["h-1"]),
+			buildApplicant("h-2", "high", 80, requests["h-2"]),
+			buildApplicant("h-3", "high", 70, requests["h-3"]),
+			buildApplicant("m-1", "medium", 60, 1000),
+		}
+		prepApplicants(applicants, 0.7, 0.3)
+		opts := defaultOptions(100, 1000)
+		opts.ReserveHigh = 0.5
+		opts.ReserveMode = mode
+		if err := validateOptions(opts); err != nil {
+			t.Fatalf("unexpected validation error for %s: %v", mode, err)
+		}
+		allocateBudget(applicants, 3000, opts)
+		reserveAwards := make(map[string]float64)
+		var total float64
+		for _, item := range applicants {
+			if item.Pass == "reserve-high" {
+				reserveAwards[item.ID] = item.Awarded
+				total += item.Awarded
+			}
+		}
+		return reserveAwards, total
+	}
+
+	const reserve = 1500
+	greedy, greedyTotal := run("greedy")
+	want := map[string]float64{"h-1": 1000, "h-2": 500}
+	if len(greedy) != len(want) || !floatEquals(greedyTotal, reserve) {
+		t.Fatalf("expected greedy to spend the $%d reserve on h-1 and h-2, got %v (total %.2f)", reserve, greedy, greedyTotal)
+	}
+	for id, amount := range want {
+		if !floatEquals(greedy[id], amount) {
+			t.Fatalf("expected greedy to give %s %.2f, got %.2f", id, amount, greedy[id])
+		}
+	}
+
+	proportional, proportionalTotal := run("proportional")
+	if len(proportional) != len(requests) || !floatEquals(proportionalTotal, reserve) {
+		t.Fatalf("expected proportional to spread the $%d reserve across the tier, got %v (total %.2f)", reserve, proportional, proportionalTotal)
+	}
+	for id, requested := range requests {
+		if share := requested / 2400 * reserve; !floatEquals(proportional[id], share) {
+			t.Fatalf("expected proportional to give %s %.2f of the reserve, got %.2f", id, share, proportional[id])
+		}
+	}
+	if reserveModeOrDefault("greedy") != reserveModePriority || reserveModeOrDefault("proportional") != reserveModeSpread {
+		t.Fatalf("expected greedy and proportional to alias priority and spread")
+	}
+}
+
+func TestReserveModeSpreadKeepsAwardIncrement(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("h-1", "high", 90, 1000),
+		buildApplicant("h-2", "high", 80, 600),
+		buildApplicant("h-3", "high", 70, 400),
+		buildApplicant("l-1", "low", 50, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(100, 1000)
+	opts.ReserveHigh = 0.4
+	opts.ReserveMode = reserveModeSpread
+	opts.AwardIncrement = 250
+	awarded := allocateBudget(applicants, 2500, opts)
+
+	want := map[string]float64{"h-1": 500, "h-2": 250}
+	for _, item := range applicants[:2] {
+		if item.Pass != "reserve-high" || !floatEquals(item.Awarded, want[item.ID]) {
+			t.Fatalf("expected %s to get %.2f from the reserve, got %s %.2f", item.ID, want[item.ID], item.Pass, item.Awarded)
+		}
+	}
+	if applicants[2].Pass != "general" || !floatEquals(applicants[2].Awarded, 250) {
+		t.Fatalf("expected h-3 to be funded from the reserve remainder by the general pass, got %s %.2f", applicants[2].Pass, applicants[2].Awarded)
+	}
+	for _, item := range awarded {
+		if !floatEquals(floorToIncrement(item.Awarded, 250), item.Awarded) {
+			t.Fatalf("expected %s's award to be a multiple of 250, got %.2f", item.ID, item.Awarded)
+		}
+	}
+	if total := totalAwarded(awarded); total > 2500 {
+		t.Fatalf("expected awards within the budget, got %.2f", total)
+	}
+
+	applicants = []*applicant{
+		buildApplicant("h-1", "high", 90, 1000),
+		buildApplicant("h-2", "high", 80, 600),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts.ReserveHigh = 1
+	opts.AwardIncrement = 0
+	opts.RoundSet = []float64{250, 500, 1000}
+	allocateBudget(applicants, 1000, opts)
+	if !floatEquals(applicants[0].Awarded, 500) || !floatEquals(applicants[1].Awarded, 250) {
+		t.Fatalf("expected spread shares to floor onto the round-to-set amounts, got %.2f and %.2f", applicants[0].Awarded, applicants[1].Awarded)
+	}
+}
+
+func TestWriteXLSXSheets(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 3000),
+		buildApplicant("a-2", "low", 60, 2000),
+		buildApplicant("a-3", "unknown", 80, 1000),
+	}
+	markIneligible(applicants[2], "need_level must be low, medium, or high")
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 3000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 3000, awarded, "")
+
+	path := filepath.Join(t.TempDir(), "allocation.xlsx")
+	if err := writeXLSX(path, workbookSheets(summary)); err != nil {
+		t.Fatalf("write xlsx: %v", err)
+	}
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("open xlsx: %v", err)
+	}
+	defer archive.Close()
+	read := func(name string) []byte {
+		for _, file := range archive.File {
+			if file.Name != name {
+				continue
+			}
+			entry, err := file.Open()
+			if err != nil {
+				t.Fatalf("open %s: %v", name, err)
+			}
+			defer entry.Close()
+			data, err := io.ReadAll(entry)
+			if err != nil {
+				t.Fatalf("read %s: %v", name, err)
+			}
+			return data
+		}
+		t.Fatalf("xlsx is missing %s", name)
+		return nil
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(read("xl/workbook.xml"), &workbook); err != nil {
+		t.Fatalf("parse workbook: %v", err)
+	}
+	var names []string
+	for _, sheet := range workbook.Sheets {
+		names = append(names, sheet.Name)
+	}
+	if strings.Join(names, ",") != "Awards,Unfunded,Ineligible,Summary" {
+		t.Fatalf("unexpected sheet names: %v", names)
+	}
+	awardsSheet := string(read("xl/worksheets/sheet1.xml"))
+	if !strings.Contains(awardsSheet, `<c r="F2" s="1"><v>3000</v></c>`) {
+		t.Fatalf("expected the awarded amount as a formatted number:\n%s", awardsSheet)
+	}
+}
+
+func TestWriteFileAtomicKeepsOriginalOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "awards.csv")
+	if err := os.WriteFile(path, []byte("previous\n"), 0o644); err != nil {
+		t.Fatalf("seed output: %v", err)
+	}
+
+	err := writeFileAtomic(path, func(out io.Writer) error {
+		if _, err := io.WriteString(out, "partial"); err != nil {
+			return err
+		}
+		return errors.New("disk went away")
+	})
+	if err == nil {
+		t.Fatalf("expected the write error to be returned")
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "previous\n" {
+		t.Fatalf("expected the original file to survive a failed write, got %q", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected the temporary file to be removed, found %d entries", len(entries))
+	}
+
+	if err := writeAwardsCSV(path, nil, 4, false, false); err != nil {
+		t.Fatalf("write awards CSV: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "applicant_id,") {
+		t.Fatalf("expected the new CSV to replace the original, got %q", data)
+	}
+	entries, _ = os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected only the output file after a successful write, found %d entries", len(entries))
+	}
+}
+
+func TestAwardIncrementFloorsAwards(t *testing.T) {
+	if got := computeAward(1250, 500, 4000, 0, nil, 1, 100); got != 1200 {
+		t.Fatalf("expected 1250 to floor to 1200, got %.2f", got)
+	}
+	if got := computeAward(5000, 500, 4000, 0, nil, 0.33, 100); got != 1600 {
+		t.Fatalf("expected the max-percent cap of 1650 to floor to 1600, got %.2f", got)
+	}
+	if got := computeAward(580, 550, 4000, 0, nil, 1, 100); got != 0 {
+		t.Fatalf("expected an award floored below the minimum to be skipped, got %.2f", got)
+	}
+
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "high", 80, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(500, 5000)
+	opts.AwardIncrement = 100
+	awarded := allocateBudget(applicants, 1750, opts)
+	if len(awarded) != 2 || !floatEquals(awarded[1].Awarded, 700) {
+		t.Fatalf("expected the budget-truncated award to floor to 700, got %+v", awarded)
+	}
+
+	opts.RoundTo = 100
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "award-increment") {
+		t.Fatalf("expected award-increment with round to be rejected, got %v", err)
+	}
+}
+
+// fakeFundedDB records the funded query and returns canned applicant IDs, so
+// tests assert on the SQL and bound arguments rather than re-running filters.
+type fakeFundedDB struct {
+	ids  []string
+	sql  string
+	args []any
+}
+
+func (f *fakeFundedDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	f.sql = sql
+	f.args = args
+	return &fakeRows{ids: f.ids}, nil
+}
+
+type fakeRows struct {
+	ids   []string
+	index int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) Next() bool                                   { r.index++; return r.index <= len(r.ids) }
+func (r *fakeRows) Values() ([]any, error)                       { return []any{r.ids[r.index-1]}, nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+func (r *fakeRows) Scan(dest ...any) error {
+	*dest[0].(*string) = r.ids[r.index-1]
+	return nil
+}
+
+func TestExcludeFundedSinceMarksPriorAwardees(t *testing.T) {
+	db := &fakeFundedDB{ids: []string{"a-2"}}
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	funded, err := loadFundedSince(context.Background(), db, "gs_award_allocator", since)
+	if err != nil {
+		t.Fatalf("load funded: %v", err)
+	}
+	want := "SELECT DISTINCT a.applicant_id FROM gs_award_allocator.applicants a " +
+		"JOIN gs_award_allocator.runs r ON r.run_id = a.run_id " +
+		"WHERE a.awarded > $1 AND r.generated_at >= $2"
+	if db.sql != want {
+		t.Fatalf("unexpected funded query:\n got %s\nwant %s", db.sql, want)
+	}
+	if len(db.args) != 2 || db.args[0] != 0 || db.args[1] != since {
+		t.Fatalf("expected args [0 %v], got %v", since, db.args)
+	}
+	if len(funded) != 1 || !funded["a-2"] {
+		t.Fatalf("expected only a-2 to be funded since the cutoff, got %v", funded)
+	}
+
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "high", 85, 1000),
+		buildApplicant("a-3", "low", 70, 1000),
+	}
+	if excluded := excludeFunded(applicants, funded); excluded != 1 {
+		t.Fatalf("expected one exclusion, got %d", excluded)
+	}
+	if applicants[1].Eligible || applicants[1].EligibilityMsg != "already funded in a prior run" {
+		t.Fatalf("expected a-2 to be ineligible, got %v %q", applicants[1].Eligible, applicants[1].EligibilityMsg)
+	}
+	if !applicants[0].Eligible || !applicants[2].Eligible {
+		t.Fatalf("expected a-1 and a-3 to stay eligible")
+	}
+}
+
+func TestNeedCoverageFundingGap(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("h-1", "high", 90, 3000),
+		buildApplicant("h-2", "high", 80, 2000),
+		buildApplicant("m-1", "medium", 70, 1500),
+		buildApplicant("l-1", "low", 60, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 4000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 4000, awarded, "")
+
+	want := map[string]float64{"high": 1000, "medium": 1500, "low": 1000}
+	var total float64
+	for level, gap := range want {
+		if got := summary.NeedCoverage[level].FundingGap; !floatEquals(got, gap) {
+			t.Fatalf("expected %s funding gap %.2f, got %.2f", level, gap, got)
+		}
+		total += gap
+	}
+	if !floatEquals(total, summary.FundingGapTotal) {
+		t.Fatalf("expected per-level gaps to sum to %.2f, got %.2f", summary.FundingGapTotal, total)
+	}
+}
+
+func TestOutputGateSkipsOnlyInDryRun(t *testing.T) {
+	if (&outputGate{}).skip("JSON", "out.json") {
+		t.Fatalf("expected outputs to be written without -dry-run")
+	}
+	if !(&outputGate{dryRun: true}).skip("JSON", "out.json") {
+		t.Fatalf("expected -dry-run to skip outputs")
+	}
+}
+
+func TestMaxAwardMedianMultipleCapsAwards(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 12000),
+		buildApplicant("a-2", "high", 80, 1000),
+		buildApplicant("a-3", "medium", 70, 1500),
+		buildApplicant("a-4", "low", 60, 800),
+		buildApplicant("a-5", "low", 50, 2000),
+	}
+	markIneligible(applicants[4], "missing transcript")
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(500, 10000)
+	opts.MedianMultiple = 2
+	opts.medianAwardCap = medianAwardCap(applicants, opts.MedianMultiple)
+	if !floatEquals(opts.medianAwardCap, 2000) {
+		t.Fatalf("expected a cap of 2x the eligible median request (1000), got %.2f", opts.medianAwardCap)
+	}
+	awarded := allocateBudget(applicants, 50000, opts)
+	for _, item := range awarded {
+		if item.Awarded > 2000+invariantTolerance {
+			t.Fatalf("expected %s to be capped at 2000, got %.2f", item.ID, item.Awarded)
+		}
+	}
+	if !floatEquals(applicants[0].Awarded, 2000) || applicants[0].Constraint != constraintMaxAward {
+		t.Fatalf("expected a-1 to be held to the median cap, got %.2f (%s)", applicants[0].Awarded, applicants[0].Constraint)
+	}
+	if !floatEquals(applicants[2].Awarded, 1500) {
+		t.Fatalf("expected requests under the cap to be funded in full, got %.2f", applicants[2].Awarded)
+	}
+}
+
+func TestSummarizeFirstUnfunded(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 2000),
+		buildApplicant("a-2", "medium", 85, 2000),
+		buildApplicant("a-3", "low", 75, 1500),
+		buildApplicant("a-4", "low", 99, 1000),
+	}
+	markIneligible(applicants[3], "missing transcript")
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 2000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 2000, awarded, "")
+
+	if summary.FirstUnfundedNeed != "medium" || !floatEquals(summary.FirstUnfundedScore, 85) || !floatEquals(summary.FirstUnfundedRequested, 2000) {
+		t.Fatalf("expected a-2 as the first unfunded applicant, got %s %.1f %.2f", summary.FirstUnfundedNeed, summary.FirstUnfundedScore, summary.FirstUnfundedRequested)
+	}
+	if summary.FirstUnfundedPriority >= summary.LastFundedPriority {
+		t.Fatalf("expected the first unfunded priority %.4f below the last funded %.4f", summary.FirstUnfundedPriority, summary.LastFundedPriority)
+	}
+}
+
+func TestNeedCodesMapNumericNeedLevels(t *testing.T) {
+	codes, err := parseNeedCodes("1=low, 2=medium, 3=High")
+	if err != nil {
+		t.Fatalf("parse need codes: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "coded.csv")
+	data := "applicant_id,score,need_level,requested_amount\n" +
+		"a-1,80,1,1000\n" +
+		"a-2,80,2,1000\n" +
+		"a-3,80,3,1000\n" +
+		"a-4,80,4,1000\n" +
+		"a-5,80,medium,1000\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, _, err := loadApplicants(path, 1, false, nil, codes, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	wantLevels := []string{"low", "medium", "high", "4", "medium"}
+	for i, item := range applicants {
+		if item.NeedLevel != wantLevels[i] {
+			t.Fatalf("%s: expected need %s, got %s", item.ID, wantLevels[i], item.NeedLevel)
+		}
+		if item.Eligible == (i == 3) {
+			t.Fatalf("%s: unexpected eligibility %v (%s)", item.ID, item.Eligible, item.EligibilityMsg)
+		}
+	}
+
+	for _, raw := range []string{"1=urgent", "=low", "1=low,1=high", "1"} {
+		if _, err := parseNeedCodes(raw); err == nil {
+			t.Fatalf("expected need-codes %q to be rejected", raw)
+		}
+	}
+}
+
+func TestMarginToCutoffAroundBoundary(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "high", 80, 1000),
+		buildApplicant("a-3", "high", 70, 1000),
+		buildApplicant("a-4", "high", 60, 1000),
+	}
+	prepApplicants(applicants, 1, 0)
+	awarded := allocateBudget(applicants, 2000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 2000, awarded, "")
+	applyPriorityPrecision(&summary, 4)
+
+	cutoff := summary.LastFundedPriority
+	if !floatEquals(cutoff, 0.8889) {
+		t.Fatalf("expected a-2 at the cutoff, got %.4f", cutoff)
+	}
+	wantAwards := []float64{0.1111, 0}
+	for i, record := range summary.Awards {
+		if !floatEquals(record.Margin, wantAwards[i]) {
+			t.Fatalf("%s: expected margin %.4f, got %.4f", record.ApplicantID, wantAwards[i], record.Margin)
+		}
+	}
+	wantUnfunded := []float64{-0.1111, -0.2222}
+	for i, record := range summary.Unfunded {
+		if !floatEquals(record.Margin, wantUnfunded[i]) {
+			t.Fatalf("%s: expected margin %.4f, got %.4f", record.ApplicantID, wantUnfunded[i], record.Margin)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "unfunded.csv")
+	if err := writeUnfundedCSV(path, summary.Unfunded, 4, false); err != nil {
+		t.Fatalf("write unfunded CSV: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), ",margin_to_cutoff\n") || !strings.Contains(string(data), ",0.7778,-0.1111\n") {
+		t.Fatalf("expected margin_to_cutoff in the unfunded CSV:\n%s", data)
+	}
+}
+
+func TestWriteAwardsTextMatchesConsoleList(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "medium", 80, 1200),
+		buildApplicant("a-3", "low", 70, 900),
+	}
+	applicants[0].Name = "Ada Park"
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 5000, defaultOptions(500, 5000))
+	summary := summarize(applicants, 5000, awarded, "")
+
+	path := filepath.Join(t.TempDir(), "awards.txt")
+	if err := writeAwardsText(path, summary.Awards, 2, false, 4, false); err != nil {
+		t.Fatalf("write awards text: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read awards text: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) != 5 || lines[0] != "Awarded Applicants" || lines[4] != "... 1 more" {
+		t.Fatalf("expected a two-row table with a remainder line, got:\n%s", data)
+	}
+	if !strings.HasPrefix(lines[2], "1. Ada Park (a-1) | Need: High") {
+		t.Fatalf("unexpected first row: %s", lines[2])
+	}
+
+	if err := writeAwardsText(path, summary.Awards, 2, true, 4, false); err != nil {
+		t.Fatalf("write awards text: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Count(string(data), "| Awarded: $") != 3 {
+		t.Fatalf("expected -all to include every award, got:\n%s", data)
+	}
+}
+
+func TestNonFiniteNumbersAreIneligible(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nan.csv")
+	data := "applicant_id,score,need_level,requested_amount,match_multiplier\n" +
+		"a-1,80,high,1000,\n" +
+		"a-2,inf,high,1000,\n" +
+		"a-3,nan,medium,1000,\n" +
+		"a-4,-inf,low,1000,\n" +
+		"a-5,70,low,inf,\n" +
+		"a-6,70,low,NaN,\n" +
+		"a-7,70,low,1000,inf\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "line 8: invalid match_multiplier" {
+		t.Fatalf("expected an infinite match_multiplier warning, got %v", warnings)
+	}
+	want := map[string]string{
+		"a-1": "",
+		"a-2": "score must be a finite number",
+		"a-3": "score must be a finite number",
+		"a-4": "score must be a finite number",
+		"a-5": "requested_amount must be a finite number",
+		"a-6": "requested_amount must be a finite number",
+	}
+	for _, item := range applicants {
+		if item.EligibilityMsg != want[item.ID] || item.Eligible != (want[item.ID] == "") {
+			t.Fatalf("%s: expected reason %q, got %q", item.ID, want[item.ID], item.EligibilityMsg)
+		}
+		if !isFinite(item.ScoreRaw) || !isFinite(item.Requested) {
+			t.Fatalf("%s: expected non-finite values to be cleared, got %v / %v", item.ID, item.ScoreRaw, item.Requested)
+		}
+	}
+
+	normalizeScores(applicants, 0)
+	if !floatEquals(applicants[0].ScoreNorm, 1) {
+		t.Fatalf("expected normalization to ignore non-finite scores, got %v", applicants[0].ScoreNorm)
+	}
+}
+
+func TestTermYearsAllocatesMultiYearTotals(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 2000),
+		buildApplicant("a-2", "low", 70, 1500),
+	}
+	applicants[1].OtherAid = 500
+	applyTermYears(applicants, 4)
+	if applicants[0].Requested != 8000 || applicants[1].Requested != 6000 || applicants[1].OtherAid != 2000 {
+		t.Fatalf("expected annual amounts multiplied by the term, got %.2f, %.2f, %.2f",
+			applicants[0].Requested, applicants[1].Requested, applicants[1].OtherAid)
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 10000)
+	awarded := allocateBudget(applicants, 12000, opts)
+	summary := summarize(applicants, 12000, awarded, "")
+	applyTermSummary(&summary, 4)
+	if summary.BudgetUsed != 12000 || summary.EligibleRequestedTotal != 14000 {
+		t.Fatalf("expected totals over the term, got used %.2f of %.2f requested", summary.BudgetUsed, summary.EligibleRequestedTotal)
+	}
+	if summary.TermYears != 4 || summary.AnnualBudget != 3000 || summary.AnnualBudgetUsed != 3000 || summary.AnnualRequestedTotal != 3500 {
+		t.Fatalf("unexpected annual figures: %+v", summary)
+	}
+
+	single := allocationSummary{Budget: 1000}
+	applyTermSummary(&single, 1)
+	if single.TermYears != 0 || single.AnnualBudget != 0 {
+		t.Fatalf("expected a one-year term to leave annual figures unset")
+	}
+}
+
+func TestBuildNearMissesFiltersScoreOnlyExclusions(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("close", "medium", 68, 1000),
+		buildApplicant("closer", "medium", 69.5, 1000),
+		buildApplicant("far", "medium", 50, 1000),
+		buildApplicant("tiered", "high", 58, 1000),
+		buildApplicant("two-reasons", "low", 67, 1000),
+		buildApplicant("eligible", "low", 80, 1000),
+	}
+	markIneligible(applicants[4], "missing applicant_id")
+	tiers := needMinScores{High: 60, Medium: -1, Low: -1}
+	applyMinScore(applicants, 70, tiers)
+
+	misses := buildNearMisses(buildIneligibleRecords(applicants), 5, 70, tiers)
+	var ids []string
+	for _, item := range misses {
+		ids = append(ids, item.ApplicantID)
+	}
+	if strings.Join(ids, ",") != "closer,close,tiered" {
+		t.Fatalf("expected score-only near misses by score descending, got %v", ids)
+	}
+	if misses[2].Threshold != 60 || !floatEquals(misses[2].BelowBy, 2) {
+		t.Fatalf("expected the tiered threshold to apply, got %+v", misses[2])
+	}
+	if buildNearMisses(buildIneligibleRecords(applicants), 0, 70, tiers) != nil {
+		t.Fatalf("expected a zero delta to disable near misses")
+	}
+}
+
+func TestResultHashIsStableAcrossIdenticalRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "applicants.csv")
+	content := "applicant_id,score,need_level,requested_amount\nA-1,90,high,2000\nA-2,80,medium,1500\nA-3,70,low,1000\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	run := func() allocationSummary {
+		applicants, _, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+		if err != nil {
+			t.Fatalf("load applicants: %v", err)
+		}
+		prepApplicants(applicants, 0.7, 0.3)
+		awarded := allocateBudget(applicants, 3000, defaultOptions(500, 2000))
+		return summarize(applicants, 3000, awarded, "")
+	}
+
+	first := run()
+	time.Sleep(time.Millisecond)
+	second := run()
+	if first.ResultHash == "" || first.ResultHash != second.ResultHash {
+		t.Fatalf("expected identical runs to share a hash, got %q and %q", first.ResultHash, second.ResultHash)
+	}
+	if first.GeneratedTime.Equal(second.GeneratedTime) {
+		t.Fatalf("expected distinct generation times")
+	}
+
+	awards := []*applicant{
+		{ID: "A-2", Awarded: 1000},
+		{ID: "A-1", Awarded: 2000},
+	}
+	if resultHash(awards) != resultHash([]*applicant{awards[1], awards[0]}) {
+		t.Fatalf("expected the hash to ignore award order")
+	}
+	before := resultHash(awards)
+	awards[0].Awarded = 1000.01
+	if resultHash(awards) == before {
+		t.Fatalf("expected a changed amount to change the hash")
+	}
+}
+
+func TestPrioritySourceUsesExternalRank(t *testing.T) {
+	build := func() []*applicant {
+		applicants := []*applicant{
+			buildApplicant("top-score", "high", 95, 1000),
+			buildApplicant("mid-score", "medium", 80, 1000),
+			buildApplicant("low-score", "low", 60, 1000),
+		}
+		applicants[0].Rank = 3
+		applicants[1].Rank = 2
+		applicants[2].Rank = 1
+		normalizeScores(applicants, 0)
+		return applicants
+	}
+
+	opts := defaultOptions(0, 1000)
+	opts.PrioritySource = prioritySourceExternal
+	external := build()
+	assignPriority(external, opts)
+	sortApplicants(external, nil)
+	if external[0].ID != "low-score" || external[0].PriorityScore != 1 || external[2].PriorityScore != 0 {
+		t.Fatalf("expected the committee rank to order applicants, got %s first at %.3f", external[0].ID, external[0].PriorityScore)
+	}
+
+	opts.PrioritySource = prioritySourceBlend
+	opts.RankWeight = 0.5
+	blended := build()
+	assignPriority(blended, opts)
+	computed := computedPriority(blended[1], opts)
+	if !floatEquals(blended[1].PriorityScore, 0.5*computed+0.5*0.5) {
+		t.Fatalf("expected a 50/50 blend of %.4f and rank 0.5, got %.4f", computed, blended[1].PriorityScore)
+	}
+
+	_, warn := parseApplicant([]string{"A-1", "90", "high", "1000", "0"}, map[string]int{
+		"applicant_id": 0, "score": 1, "need_level": 2, "requested_amount": 3, "rank": 4,
+	}, 2, 1, false, nil, nil, idNormalization{})
+	if !strings.Contains(warn, "rank") {
+		t.Fatalf("expected rank 0 to be rejected, got %q", warn)
+	}
+	opts.PrioritySource = "committee"
+	if err := validateOptions(opts); err == nil {
+		t.Fatalf("expected an unknown priority source to be rejected")
+	}
+}
+
+func TestMaxSpendPercentCapsEffectiveBudget(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 2000),
+		buildApplicant("a-2", "medium", 80, 2000),
+		buildApplicant("a-3", "low", 70, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 5000)
+	opts.MaxSpendPct = 0.9
+	awarded := allocateBudget(applicants, 10000, opts)
+	summary := summarize(applicants, 10000, awarded, "")
+	applySpendCap(&summary, spendCapBudget(applicants, 10000, opts.MaxSpendPct), opts.MaxSpendPct)
+	if !floatEquals(summary.BudgetUsed, 4500) {
+		t.Fatalf("expected spending capped at 90%% of $5000 demand, got %.2f", summary.BudgetUsed)
+	}
+	if !floatEquals(summary.EffectiveBudget, 4500) || !strings.Contains(summary.EffectiveBudgetNote, "90.0% of eligible demand") {
+		t.Fatalf("expected the effective budget and reason to be reported, got %.2f %q", summary.EffectiveBudget, summary.EffectiveBudgetNote)
+	}
+
+	if got := spendCapBudget(applicants, 3000, opts.MaxSpendPct); got != 3000 {
+		t.Fatalf("expected a smaller nominal budget to win, got %.2f", got)
+	}
+	tight := allocationSummary{Budget: 3000}
+	applySpendCap(&tight, 3000, opts.MaxSpendPct)
+	if tight.EffectiveBudgetNote != "" {
+		t.Fatalf("expected no note when the cap does not bind")
+	}
+}
+
+func TestWriteFixedWidthRoundTripsWidths(t *testing.T) {
+	spec, err := parseFixedWidthSpec("id:6,amount:10,need:6,name:8")
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	awarded := []*applicant{
+		{ID: "A-1", Name: "Jordan Lee-Whitfield", NeedLevel: "high", Awarded: 1500},
+		{ID: "A-22", Name: "Sam", NeedLevel: "medium", Awarded: 987.5},
+	}
+	path := filepath.Join(t.TempDir(), "awards.txt")
+	if err := writeFixedWidth(path, awarded, spec); err != nil {
+		t.Fatalf("write fixed width: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read fixed width: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one record per award, got %d", len(lines))
+	}
+	for i, line := range lines {
+		if len(line) != 30 {
+			t.Fatalf("expected 30-character records, got %d in %q", len(line), line)
+		}
+		var fields []string
+		offset := 0
+		for _, field := range spec {
+			fields = append(fields, line[offset:offset+field.Width])
+			offset += field.Width
+		}
+		amount, err := strconv.ParseFloat(fields[1], 64)
+		if strings.TrimSpace(fields[0]) != awarded[i].ID || err != nil || amount != awarded[i].Awarded {
+			t.Fatalf("record %d did not round-trip: %q", i, fields)
+		}
+		if strings.TrimSpace(fields[2]) != awarded[i].NeedLevel {
+			t.Fatalf("expected need %q, got %q", awarded[i].NeedLevel, fields[2])
+		}
+	}
+	if lines[0][6:16] != "0001500.00" || lines[0][22:] != "Jordan L" {
+		t.Fatalf("expected zero-padded amounts and truncated names, got %q", lines[0])
+	}
+
+	narrow, _ := parseFixedWidthSpec("id:6,amount:6")
+	if err := writeFixedWidth(path, awarded, narrow); err == nil || !strings.Contains(err.Error(), "does not fit") {
+		t.Fatalf("expected an amount too wide for its field to fail, got %v", err)
+	}
+	if _, err := parseFixedWidthSpec("id:6,bank:10"); err == nil {
+		t.Fatalf("expected an unknown field to be rejected")
+	}
+}
+
+func TestOverflowingNumbersAreIneligibleAndNormalizationIsGuarded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overflow.csv")
+	data := "applicant_id,score,need_level,requested_amount\n" +
+		"a-1,80,high,1000\n" +
+		"a-2,1e400,high,1000\n" +
+		"a-3,70,low,1e400\n" +
+		"a-4,Inf,low,1000\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil || len(warnings) != 0 || len(applicants) != 4 {
+		t.Fatalf("expected overflowing rows to load as ineligible, got %d applicants, warnings %v, err %v", len(applicants), warnings, err)
+	}
+	want := map[string]string{
+		"a-1": "",
+		"a-2": "score must be a finite number",
+		"a-3": "requested_amount must be a finite number",
+		"a-4": "score must be a finite number",
+	}
+	for _, item := range applicants {
+		if item.EligibilityMsg != want[item.ID] {
+			t.Fatalf("%s: expected reason %q, got %q", item.ID, want[item.ID], item.EligibilityMsg)
+		}
+	}
+
+	stray := []*applicant{
+		buildApplicant("ok-1", "high", 80, 1000),
+		buildApplicant("ok-2", "low", 40, 1000),
+		buildApplicant("bad", "low", math.Inf(1), 1000),
+		buildApplicant("nan", "low", math.NaN(), 1000),
+	}
+	normalizeScores(stray, math.Inf(1))
+	if !floatEquals(stray[0].ScoreNorm, 1) || !floatEquals(stray[1].ScoreNorm, 0.5) {
+		t.Fatalf("expected a stray Inf not to collapse normalized scores, got %v and %v", stray[0].ScoreNorm, stray[1].ScoreNorm)
+	}
+	if stray[2].ScoreNorm != 0 || stray[3].ScoreNorm != 0 {
+		t.Fatalf("expected non-finite scores to normalize to 0, got %v and %v", stray[2].ScoreNorm, stray[3].ScoreNorm)
+	}
+}
+
+func TestFTEScalesAwardCeiling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fte.csv")
+	data := "applicant_id,score,need_level,requested_amount,fte\n" +
+		"a-1,90,high,4000,0.5\n" +
+		"a-2,90,high,4000,\n" +
+		"a-3,70,low,1000,1.5\n" +
+		"a-4,70,low,1000,half\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("load applicants: %v %v", err, warnings)
+	}
+	for _, item := range applicants[2:] {
+		if item.Eligible || item.EligibilityMsg != "fte must be greater than 0 and at most 1" {
+			t.Fatalf("expected %s ineligible for its fte, got %v %q", item.ID, item.Eligible, item.EligibilityMsg)
+		}
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	if applicants[0].PriorityScore != applicants[1].PriorityScore {
+		t.Fatalf("expected fte to leave priority unchanged, got %.4f and %.4f", applicants[0].PriorityScore, applicants[1].PriorityScore)
+	}
+
+	opts := defaultOptions(500, 3000)
+	allocateBudget(applicants, 10000, opts)
+	if applicants[0].Awarded != 1500 || applicants[0].Constraint != constraintFTE {
+		t.Fatalf("expected the half-time max award of 1500, got %.2f (%s)", applicants[0].Awarded, applicants[0].Constraint)
+	}
+	if applicants[1].Awarded != 3000 || applicants[1].Constraint != constraintMaxAward {
+		t.Fatalf("expected a blank fte to default to full time, got %.2f (%s)", applicants[1].Awarded, applicants[1].Constraint)
+	}
+}
+
+func TestCostOfAttendanceCapsAwards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coa.csv")
+	data := "applicant_id,score,need_level,requested_amount,cost_of_attendance\n" +
+		"a-1,90,high,4000,2500\n" +
+		"a-2,80,medium,1500,\n" +
+		"a-3,70,low,1000,-5\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != "line 4: invalid cost_of_attendance" {
+		t.Fatalf("expected a negative cost of attendance to be rejected, got %v", warnings)
+	}
+	if warning := costOfAttendanceWarning(applicants); !strings.Contains(warning, "1 applicant(s)") || !strings.Contains(warning, "a-1") {
+		t.Fatalf("expected a data-quality warning for a-1, got %q", warning)
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(500, 5000)
+	awarded := allocateBudget(applicants, 10000, opts)
+	funded := make(map[string]*applicant)
+	for _, item := range awarded {
+		funded[item.ID] = item
+	}
+	if funded["a-1"].Awarded != 2500 || funded["a-1"].Requested != 4000 {
+		t.Fatalf("expected a-1 capped at cost of attendance with its request kept, got %.2f of %.2f", funded["a-1"].Awarded, funded["a-1"].Requested)
+	}
+	if funded["a-1"].Constraint != constraintCostOfAtt {
+		t.Fatalf("expected the cost_of_attendance constraint, got %q", funded["a-1"].Constraint)
+	}
+	if funded["a-2"].Awarded != 1500 {
+		t.Fatalf("expected a blank cost of attendance to leave the award uncapped, got %.2f", funded["a-2"].Awarded)
+	}
+
+	opts.MaxPercent = 0.5
+	if _, itemMax := itemAwardCaps(funded["a-1"], opts); itemMax != 2500 {
+		t.Fatalf("expected cost of attendance as the item maximum, got %.2f", itemMax)
+	}
+	if award, _ := plannedAward(funded["a-1"], opts); award != 2000 {
+		t.Fatalf("expected max-percent to compose with cost of attendance, got %.2f", award)
+	}
+}
+
+func TestEligibilityExpiryUsesAsOfDate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expiry.csv")
+	data := "applicant_id,score,need_level,requested_amount,eligible_until\n" +
+		"expired,90,high,1000,2026-03-31\n" +
+		"on-date,85,high,1000,2026-04-01\n" +
+		"future,80,medium,1000,2027-01-15\n" +
+		"malformed,75,low,1000,04/30/2026\n" +
+		"blank,70,low,1000,\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load applicants: %v", err)
+	}
+	if len(applicants) != 5 || len(warnings) != 1 || !strings.Contains(warnings[0], "line 5: invalid eligible_until") {
+		t.Fatalf("expected the malformed date to warn and keep the row, got %d applicants, warnings %v", len(applicants), warnings)
+	}
+
+	asOf, _ := time.Parse(time.DateOnly, "2026-04-01")
+	if expired := applyEligibilityExpiry(applicants, asOf); expired != 1 {
+		t.Fatalf("expected one expired applicant, got %d", expired)
+	}
+	for _, item := range applicants {
+		wantEligible := item.ID != "expired"
+		if item.Eligible != wantEligible {
+			t.Fatalf("%s: expected eligible=%v, got %v (%q)", item.ID, wantEligible, item.Eligible, item.EligibilityMsg)
+		}
+	}
+	if applicants[0].EligibilityMsg != "eligibility expired 2026-03-31" {
+		t.Fatalf("unexpected expiry reason %q", applicants[0].EligibilityMsg)
+	}
+
+	opts := defaultOptions(0, 1000)
+	opts.AsOf = "April 1"
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "as-of") {
+		t.Fatalf("expected an invalid as-of date to be rejected, got %v", err)
+	}
+}
+
+func TestAppealExportDescribesOneApplicant(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("funded", "high", 95, 2000),
+		buildApplicant("missed", "low", 70, 1500),
+		buildApplicant("blocked", "medium", 40, 1000),
+	}
+	markIneligible(applicants[2], "score below minimum (50.0)")
+	prepApplicants(applicants, 0.7, 0.3)
+	opts := defaultOptions(500, 2000)
+	opts.Budget = 2000
+	awarded := allocateBudget(applicants, 2000, opts)
+	summary := summarize(applicants, 2000, awarded, "")
+
+	doc, err := buildAppeal(applicants, "missed", summary, opts)
+	if err != nil {
+		t.Fatalf("build appeal: %v", err)
+	}
+	if !floatEquals(doc.ScoreTerm+doc.NeedTerm, doc.Applicant.PriorityScore) || doc.PlannedAward != 1500 {
+		t.Fatalf("expected the priority terms and planned award, got %+v", doc)
+	}
+	var buf bytes.Buffer
+	if err := writeAppealDocument(&buf, doc, 4, false); err != nil {
+		t.Fatalf("write appeal: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# Award Decision: missed",
+		"- Raw score: 70.0",
+		"- Not funded",
+		"- Last-funded priority (cutoff): " + formatFloat(summary.LastFundedPriority, 4),
+		"- Planned award if funded: $1500.00 (budget left: $0.00)",
+		"- budget: 2000",
+		"- score_weight: 0.7",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected appeal record to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	doc, _ = buildAppeal(applicants, "funded", summary, opts)
+	writeAppealDocument(&buf, doc, 4, false)
+	if !strings.Contains(buf.String(), "- Awarded: $2000.00") {
+		t.Fatalf("expected the funded record to show the award, got:\n%s", buf.String())
+	}
+	buf.Reset()
+	doc, _ = buildAppeal(applicants, "blocked", summary, opts)
+	writeAppealDocument(&buf, doc, 4, false)
+	if !strings.Contains(buf.String(), "- Ineligible: score below minimum (50.0)") {
+		t.Fatalf("expected the ineligible reason, got:\n%s", buf.String())
+	}
+	if _, err := buildAppeal(applicants, "nobody", summary, opts); err == nil {
+		t.Fatalf("expected an unknown applicant to be an error")
+	}
+}
+
+func TestJSONOutputIsByteIdenticalAcrossRuns(t *testing.T) {
+	dir := t.TempDir()
+	run := func(name string, compact bool) []byte {
+		applicants := []*applicant{
+			buildApplicant("a-1", "high", 95, 2000),
+			buildApplicant("a-2", "medium", 85, 1500),
+			buildApplicant("a-3", "low", 75, 1200),
+			buildApplicant("a-4", "low", 60, 900),
+			buildApplicant("a-5", "medium", 30, 800),
+		}
+		for i, item := range applicants {
+			item.Extras = map[string]string{"cohort": []string{"north", "south", "east"}[i%3]}
+		}
+		markIneligible(applicants[4], "missing transcript")
+		markIneligible(applicants[3], "score below minimum (65.0)")
+		prepApplicants(applicants, 0.7, 0.3)
+		awarded := allocateBudget(applicants, 3000, defaultOptions(500, 2000))
+		summary := summarize(applicants, 3000, awarded, "cohort")
+		summary.GeneratedAt = "2026-01-01T00:00:00Z"
+		path := filepath.Join(dir, name)
+		if err := writeJSON(path, summary, awarded, compact); err != nil {
+			t.Fatalf("write JSON: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read JSON: %v", err)
+		}
+		return data
+	}
+
+	first := run("first.json", false)
+	for i := 0; i < 5; i++ {
+		if again := run("again.json", false); !bytes.Equal(first, again) {
+			t.Fatalf("expected identical JSON bytes across runs")
+		}
+	}
+	byNeed := string(first[bytes.Index(first, []byte(`"by_need"`)):])
+	if !(strings.Index(byNeed, `"high": {`) < strings.Index(byNeed, `"low": {`) && strings.Index(byNeed, `"low": {`) < strings.Index(byNeed, `"medium": {`)) {
+		t.Fatalf("expected need-level map keys in sorted order")
+	}
+
+	compact := run("compact.json", true)
+	if strings.Count(string(compact), "\n") != 1 || !bytes.Equal(compact, run("compact-again.json", true)) {
+		t.Fatalf("expected stable single-line compact JSON")
+	}
+	var indented, flat map[string]any
+	if json.Unmarshal(first, &indented) != nil || json.Unmarshal(compact, &flat) != nil || len(indented) != len(flat) {
+		t.Fatalf("expected compact and indented JSON to carry the same fields")
+	}
+}
+
+func TestLevelAmountCapStopsFundingAndWarns(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("high-1", "high", 95, 1000),
+		buildApplicant("low-1", "low", 90, 1000),
+		buildApplicant("low-2", "low", 85, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(100, 5000)
+	opts.CapLowAmount = 1200
+	awarded := allocateBudget(applicants, 5000, opts)
+	funded := make(map[string]*applicant)
+	for _, item := range awarded {
+		funded[item.ID] = item
+	}
+	if funded["high-1"].Awarded != 1000 || funded["low-1"].Awarded != 1000 {
+		t.Fatalf("expected high-1 and low-1 fully funded, got %+v", funded)
+	}
+	if funded["low-2"].Awarded != 200 || funded["low-2"].Constraint != constraintLevelCap {
+		t.Fatalf("expected low-2 held to the $200 left under the cap, got %.2f (%s)", funded["low-2"].Awarded, funded["low-2"].Constraint)
+	}
+
+	waiting := buildApplicant("medium-1", "medium", 60, 500)
+	waiting.Eligible = true
+	usage, warnings := summarizeLevelCaps(append(applicants, waiting), 2800, opts)
+	if len(usage) != 1 || usage[0].NeedLevel != "low" || usage[0].Used != 1200 || !usage[0].Reached {
+		t.Fatalf("unexpected cap usage: %+v", usage)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "1 eligible applicants unfunded") {
+		t.Fatalf("expected a warning about unspent budget, got %v", warnings)
+	}
+
+	opts.CapLowAmount = -1
+	if err := validateOptions(opts); err == nil {
+		t.Fatalf("expected a negative cap to be rejected")
+	}
+}
+
+func TestStretchShavesAwardsToFundMoreApplicants(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "medium", 90, 1000),
+		buildApplicant("a-3", "low", 85, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(900, 1000)
+	if awarded := allocateBudget(cloneApplicants(applicants), 2800, opts); len(awarded) != 2 {
+		t.Fatalf("expected two awards without stretch, got %d", len(awarded))
+	}
+
+	opts.StretchPct = 0.1
+	awarded := allocateBudget(applicants, 2800, opts)
+	summary := summarize(applicants, 2800, awarded, "")
+	if len(awarded) != 3 || summary.StretchAddedCount != 1 {
+		t.Fatalf("expected stretch to fund one more applicant, got %d awards (%d added)", len(awarded), summary.StretchAddedCount)
+	}
+	if !floatEquals(summary.StretchShave, 0.05) {
+		t.Fatalf("expected the smallest shave that fits, got %.4f", summary.StretchShave)
+	}
+	for _, item := range awarded[:2] {
+		if !floatEquals(item.Awarded, 950) || item.Constraint != constraintStretch {
+			t.Fatalf("expected %s shaved to 950, got %.2f (%s)", item.ID, item.Awarded, item.Constraint)
+		}
+	}
+	if !floatEquals(awarded[2].Awarded, 900) {
+		t.Fatalf("expected a-3 funded from the $900 left, got %.2f", awarded[2].Awarded)
+	}
+	if !applicants[2].StretchAdded || applicants[0].StretchAdded {
+		t.Fatalf("expected only a-3 to be counted as added")
+	}
+}
+
+func TestWeightNoteShowsNormalizedWeights(t *testing.T) {
+	opts := defaultOptions(0, 5000)
+	if note := weightNote(opts); strings.Contains(note, "normalized") {
+		t.Fatalf("expected weights summing to 1 to need no explanation, got %q", note)
+	}
+	opts.ScoreWeight = 7
+	opts.NeedWeight = 3
+	note := weightNote(opts)
+	if !strings.Contains(note, "score 0.700, need 0.300, request 0.000") || !strings.Contains(note, "normalized from 7/3/0, which sum to 10") {
+		t.Fatalf("unexpected weight note: %q", note)
+	}
+
+	opts.NeedWeight = math.NaN()
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "finite") {
+		t.Fatalf("expected a NaN weight to be rejected, got %v", err)
+	}
+	opts.ScoreWeight, opts.NeedWeight = 0, 0
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "cannot all be zero") {
+		t.Fatalf("expected all-zero weights to be rejected, got %v", err)
+	}
+}
+
+func TestLoadApplicantsReadsXLSX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roster.xlsx")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create workbook: %v", err)
+	}
+	archive := zip.NewWriter(file)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Roster" sheetId="1" r:id="rId7"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId7" Type="worksheet" Target="worksheets/roster.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>applicant_id</t></si><si><t>score</t></si><si><t>need_level</t></si><si><t>requested_amount</t></si>` +
+			`<si><t>00042</t></si><si><r><t>Hi</t></r><r><t>gh</t></r></si></sst>`,
+		"xl/worksheets/roster.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>4</v></c><c r="B2"><v>88.5</v></c><c r="C2" t="s"><v>5</v></c><c r="D2"><v>1250.75</v></c></row>` +
+			`<row r="3"><c r="A3"/></row>` +
+			`<row r="5"><c r="A5" t="inlineStr"><is><t>A-7</t></is></c><c r="C5" t="inlineStr"><is><t>low</t></is></c><c r="D5"><v>900</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		entry, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := io.WriteString(entry, content); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close workbook: %v", err)
+	}
+	file.Close()
+
+	applicants, warnings, err := loadApplicants(path, 1, true, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load workbook: %v", err)
+	}
+	if len(applicants) != 1 {
+		t.Fatalf("expected one valid applicant, got %d", len(applicants))
+	}
+	item := applicants[0]
+	if item.ID != "00042" || item.NeedLevel != "high" || item.ScoreRaw != 88.5 || item.Requested != 1250.75 || item.SourceLine != 2 {
+		t.Fatalf("unexpected applicant from workbook: %+v", item)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "line 5") {
+		t.Fatalf("expected the row after the blank and missing rows to be reported as line 5, got %v", warnings)
+	}
+}
+
+func TestCutoffTieMessageOnlyWhenTieSplitsFunding(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "medium", 80, 1000),
+		buildApplicant("a-3", "medium", 80, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(1000, 1000)
+	awarded := allocateBudget(applicants, 2000, opts)
+	summary := summarize(applicants, 2000, awarded, "")
+	if len(summary.Boundary) != 2 || summary.LastFundedPriority != summary.FirstUnfundedPriority {
+		t.Fatalf("expected a-2 and a-3 tied at the cutoff, got %+v", summary.Boundary)
+	}
+	message := cutoffTieMessage(summary.Boundary, 4)
+	if !strings.Contains(message, "1 of 2 applicants tied") {
+		t.Fatalf("unexpected cutoff tie message: %q", message)
+	}
+
+	clone := cloneApplicants(applicants)
+	awarded = allocateBudget(clone, 3000, opts)
+	summary = summarize(clone, 3000, awarded, "")
+	if message := cutoffTieMessage(summary.Boundary, 4); message != "" {
+		t.Fatalf("expected no error when the whole tied group is funded, got %q", message)
+	}
+}
+
+func TestFullSpendMessageExplainsUnspentBudget(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 90, 1000),
+		buildApplicant("a-2", "medium", 80, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 800)
+	awarded := allocateBudget(applicants, 2000, opts)
+	summary := summarize(applicants, 2000, awarded, "")
+	message := fullSpendMessage(applicants, summary, opts, 1)
+	if !strings.Contains(message, "$400.00 left unspent") || !strings.Contains(message, "2 awards held below need by max_award") {
+		t.Fatalf("unexpected full spend message: %q", message)
+	}
+
+	clone := cloneApplicants(applicants)
+	opts = defaultOptions(0, 1000)
+	awarded = allocateBudget(clone, 2500, opts)
+	summary = summarize(clone, 2500, awarded, "")
+	if message := fullSpendMessage(clone, summary, opts, 1); !strings.Contains(message, "every eligible applicant is fully funded") {
+		t.Fatalf("expected the fully funded reason, got %q", message)
+	}
+	if message := fullSpendMessage(clone, summary, opts, 500); message != "" {
+		t.Fatalf("expected no error within tolerance, got %q", message)
+	}
+}
+
+func TestWithdrawalReportsWhoMovesUp(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "high", 90, 1000),
+		buildApplicant("a-3", "medium", 85, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 1000)
+	impact, err := buildWithdrawal(applicants, "a-1", 2000, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !floatEquals(impact.BudgetFreed, 1000) {
+		t.Fatalf("expected $1000 freed, got %.2f", impact.BudgetFreed)
+	}
+	if len(impact.Gains) != 1 || impact.Gains[0].ApplicantID != "a-3" || !impact.Gains[0].NewlyFunded || !floatEquals(impact.Gains[0].After, 1000) {
+		t.Fatalf("expected a-3 newly funded, got %+v", impact.Gains)
+	}
+	for _, item := range applicants {
+		if item.Awarded != 0 {
+			t.Fatalf("expected the input applicants untouched, got %s awarded %.2f", item.ID, item.Awarded)
+		}
+	}
+
+	if _, err := buildWithdrawal(applicants, "missing", 2000, opts); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestScenarioCacheReusesConfigurations(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "low", 95, 1000),
+		buildApplicant("a-2", "high", 40, 1000),
+		buildApplicant("a-3", "medium", 50, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 1000)
+	opts.ScoreWeight, opts.NeedWeight = 0.7, 0.3
+	cache := newScenarioCache(applicants, opts)
+	base := cache.params(1000)
+	needFirst := scenarioParams{Budget: 1000, ScoreWeight: 0, NeedWeight: 1}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.result(base)
+			cache.result(needFirst)
+			cache.result(scenarioParams{Budget: 2000, NeedWeight: 1})
+		}()
+	}
+	wg.Wait()
+
+	if len(cache.results) != 3 || len(cache.orders) != 2 {
+		t.Fatalf("expected 3 results over 2 orderings, got %d and %d", len(cache.results), len(cache.orders))
+	}
+	if ids := cache.result(base).fundedIDs; len(ids) != 1 || ids[0] != "a-1" {
+		t.Fatalf("expected the run's weights to fund a-1, got %v", ids)
+	}
+	if ids := cache.result(needFirst).fundedIDs; len(ids) != 1 || ids[0] != "a-2" {
+		t.Fatalf("expected need-only weights to fund a-2, got %v", ids)
+	}
+	if applicants[0].ID != "a-1" || applicants[0].Awarded != 0 {
+		t.Fatalf("expected the originals untouched, got %s awarded %.2f", applicants[0].ID, applicants[0].Awarded)
+	}
+}
+
+func TestEligibleTopPercentKeepsTopOfPool(t *testing.T) {
+	var applicants []*applicant
+	for i := 1; i <= 10; i++ {
+		applicants = append(applicants, buildApplicant(fmt.Sprintf("a-%d", i), "medium", float64(i*10), 1000))
+	}
+	applicants = append(applicants, buildApplicant("a-11", "medium", 95, 0))
+	markIneligible(applicants[10], "requested_amount must be > 0")
+
+	applyTopPercent(applicants, 0.2)
+	applyMinScore(applicants, 95, needMinScores{High: -1, Medium: -1, Low: -1})
+	var eligible []string
+	for _, item := range applicants {
+		if item.Eligible {
+			eligible = append(eligible, item.ID)
+		}
+	}
+	if len(eligible) != 1 || eligible[0] != "a-10" {
+		t.Fatalf("expected only a-10 within the top 20%% and above the minimum, got %v", eligible)
+	}
+	if applicants[8].EligibilityMsg != "score below minimum (95.0)" || applicants[7].EligibilityMsg != "outside top 20.0% by score; score below minimum (95.0)" {
+		t.Fatalf("unexpected reasons: %q, %q", applicants[8].EligibilityMsg, applicants[7].EligibilityMsg)
+	}
+
+	tied := []*applicant{
+		buildApplicant("t-1", "high", 90, 1000),
+		buildApplicant("t-2", "high", 80, 1000),
+		buildApplicant("t-3", "high", 80, 1000),
+		buildApplicant("t-4", "high", 70, 1000),
+	}
+	applyTopPercent(tied, 0.5)
+	if !tied[2].Eligible || tied[3].Eligible {
+		t.Fatalf("expected the tie at the cut kept and t-4 excluded, got %v %v", tied[2].Eligible, tied[3].Eligible)
+	}
+}
+
+func TestWeightSweepReordersPerPair(t *testing.T) {
+	pairs, err := parseWeightPairs("1/0, 0/1,0.5/0.5,2/0")
+	if err != nil || len(pairs) != 4 {
+		t.Fatalf("parse pairs: %v %v", pairs, err)
+	}
+	if _, err := parseWeightPairs("0.7-0.3"); err == nil {
+		t.Fatalf("expected an error for a pair without a slash")
+	}
+
+	applicants := []*applicant{
+		buildApplicant("a-1", "low", 95, 1000),
+		buildApplicant("a-2", "high", 40, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 1000)
+	results := buildWeightSweep(applicants, 1000, pairs, opts)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 sweep results, got %d", len(results))
+	}
+	if !floatEquals(results[0].NeedCoverage["low"], 1) || !floatEquals(results[0].NeedCoverage["high"], 0) {
+		t.Fatalf("expected score-only weights to fund the low-need applicant, got %v", results[0].NeedCoverage)
+	}
+	if !floatEquals(results[1].NeedCoverage["high"], 1) || !floatEquals(results[1].NeedCoverage["low"], 0) {
+		t.Fatalf("expected need-only weights to fund the high-need applicant, got %v", results[1].NeedCoverage)
+	}
+	if results[3].NeedCoverage["low"] != results[0].NeedCoverage["low"] || results[3].ScoreWeight != 2 {
+		t.Fatalf("expected 2/0 to match 1/0 and keep its label, got %+v", results[3])
+	}
+	if !floatEquals(results[0].CoverageRate, 0.5) || applicants[0].Awarded != 0 {
+		t.Fatalf("expected 50%% coverage on clones, got %.2f", results[0].CoverageRate)
+	}
+}
+
+func TestIneligibleReasonsTopLimitsReport(t *testing.T) {
+	applicants := []*applicant{buildApplicant("a-1", "high", 90, 1000)}
+	for i, reason := range []string{"missing transcript", "missing transcript", "duplicate", "late", "withdrawn"} {
+		item := buildApplicant(fmt.Sprintf("x-%d", i), "low", 50, 500)
+		markIneligible(item, reason)
+		applicants = append(applicants, item)
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 1000, defaultOptions(0, 1000))
+	summary := summarize(applicants, 1000, awarded, "")
+
+	shown, hidden := limitReasonSummary(sortReasonSummary(summary.IneligibleReasonSummary), 3)
+	if len(shown) != 3 || hidden != 1 || shown[0].Reason != "missing transcript" || shown[0].Count != 2 {
+		t.Fatalf("expected the top 3 of 4 reasons, got %+v (%d hidden)", shown, hidden)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.md")
+	summary.IneligibleReasonsTop = 2
+	if err := writeReport(path, summary, 10, false, 10, false); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	if !strings.Contains(string(data), "- ... 2 more") || strings.Contains(string(data), "- withdrawn: 1") {
+		t.Fatalf("expected the report limited to 2 reasons:\n%s", data)
+	}
+
+	summary.IneligibleReasonsTop = 0
+	if err := writeReport(path, summary, 10, false, 10, false); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "- withdrawn: 1") || strings.Contains(string(data), "more\n") {
+		t.Fatalf("expected every reason with a limit of 0:\n%s", data)
+	}
+}
+
+func TestPriorityBreakdownCSVShowsContributions(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 80, 1000),
+		buildApplicant("a-2", "low", 100, 1000),
+		buildApplicant("a-3", "medium", 90, 1000),
+	}
+	markIneligible(applicants[2], "missing transcript")
+	prepApplicants(applicants, 0.7, 0.3)
+
+	for _, item := range applicants[:2] {
+		if sum := item.ScoreContrib + item.NeedContrib + item.RequestContrib; !floatEquals(sum, item.PriorityScore) {
+			t.Fatalf("expected %s contributions to sum to %.4f, got %.4f", item.ID, item.PriorityScore, sum)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "breakdown.csv")
+	if err := writePriorityBreakdownCSV(path, applicants, false, 4); err != nil {
+		t.Fatalf("write breakdown: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read breakdown: %v", err)
+	}
+	want := "applicant_id,score_raw,score_norm,need_level,need_score,score_weight_contribution,need_weight_contribution,priority\n" +
+		"a-1,80.0,0.8000,high,1.00,0.5600,0.3000,0.8600\n" +
+		"a-2,100.0,1.0000,low,0.00,0.7000,0.0000,0.7000\n"
+	if string(data) != want {
+		t.Fatalf("unexpected breakdown CSV:\n%s", data)
+	}
+}
+
+func TestMaxPartialFundsOnlyFullAwardsOnceReached(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "high", 90, 1000),
+		buildApplicant("a-3", "medium", 85, 600),
+		buildApplicant("a-4", "low", 80, 400),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(0, 800)
+	if awarded := allocateBudget(cloneApplicants(applicants), 3000, opts); len(awarded) != 4 {
+		t.Fatalf("expected everyone funded without a partial limit, got %d", len(awarded))
+	}
+
+	opts.MaxPartial = 1
+	awarded := allocateBudget(applicants, 3000, opts)
+	summary := summarize(applicants, 3000, awarded, "")
+	if applicants[0].Awarded != 800 || applicants[1].Awarded != 0 {
+		t.Fatalf("expected a-2's partial award to be skipped, got a-1 %.2f a-2 %.2f", applicants[0].Awarded, applicants[1].Awarded)
+	}
+	if applicants[2].Awarded != 600 || applicants[3].Awarded != 400 {
+		t.Fatalf("expected fully fundable applicants to still be funded, got %.2f and %.2f", applicants[2].Awarded, applicants[3].Awarded)
+	}
+	if summary.PartiallyFundedCount != 1 || !floatEquals(summary.BudgetLeft, 1200) {
+		t.Fatalf("expected one partial award and $1200 unspent, got %d and %.2f", summary.PartiallyFundedCount, summary.BudgetLeft)
+	}
+}
+
+func TestScenarioStepsListNewlyFundedApplicants(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("a-1", "high", 95, 1000),
+		buildApplicant("a-2", "medium", 85, 1000),
+		buildApplicant("a-3", "low", 75, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	results := buildScenarioResults(applicants, []float64{0, 1000, 3000}, defaultOptions(1000, 1000))
+	steps := buildScenarioSteps(results)
+	if len(steps) != 2 {
+		t.Fatalf("expected a step between each pair of budgets, got %d", len(steps))
+	}
+	if steps[0].FromBudget != 0 || steps[0].ToBudget != 1000 || strings.Join(steps[0].NewlyFundedIDs, ",") != "a-1" {
+		t.Fatalf("unexpected first step: %+v", steps[0])
+	}
+	if strings.Join(steps[1].NewlyFundedIDs, ",") != "a-2,a-3" {
+		t.Fatalf("expected the extra $2000 to fund a-2 and a-3, got %v", steps[1].NewlyFundedIDs)
+	}
+
+	encoded, err := json.Marshal(allocationSummary{ScenarioSteps: steps})
+	if err != nil {
+		t.Fatalf("marshal steps: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"newly_funded_ids":["a-2","a-3"]`) {
+		t.Fatalf("expected newly_funded_ids in the JSON, got %s", encoded)
+	}
+}
+
+func TestNeedLevelBudgetsAllocateWithoutSpillover(t *testing.T) {
+	applicants := []*applicant{
+		buildApplicant("high-1", "high", 95, 1000),
+		buildApplicant("high-2", "high", 90, 1000),
+		buildApplicant("medium-1", "medium", 85, 1000),
+		buildApplicant("low-1", "low", 80, 1000),
+		buildApplicant("low-2", "low", 75, 1000),
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+
+	opts := defaultOptions(1000, 1000)
+	opts.BudgetHigh = 1000
+	opts.BudgetMedium = 2500
+	opts.BudgetLow = 2000
+	opts.ReserveMedium = 0.5
+	awarded := allocateBudget(applicants, 5500, opts)
+	funded := make(map[string]bool)
+	for _, item := range awarded {
+		funded[item.ID] = true
+	}
+	if !funded["high-1"] || funded["high-2"] {
+		t.Fatalf("expected the high budget to fund only high-1, got %v", funded)
+	}
+	if !funded["medium-1"] || !funded["low-1"] || !funded["low-2"] {
+		t.Fatalf("expected medium and low applicants funded from their own budgets, got %v", funded)
+	}
+
+	levels := summarizeNeedBudgets(applicants, 5500, opts)
+	if levels["medium"].BudgetUsed != 1000 || levels["medium"].BudgetLeft != 1500 {
+		t.Fatalf("expected medium's leftover to stay unspent, got %+v", levels["medium"])
+	}
+	if levels["high"].BudgetLeft != 0 || levels["high"].UnfundedCount != 1 {
+		t.Fatalf("unexpected high budget usage: %+v", levels["high"])
+	}
+	if levels["low"].BudgetUsed != 2000 {
+		t.Fatalf("unexpected low budget usage: %+v", levels["low"])
+	}
+}
+
+func TestNormalizeIDsMatchesMessyFormatting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.csv")
+	content := "applicant_id,score,need_level,requested_amount\nA-123,90,high,1000\n a_124 ,80,low,1000\nb125,70,medium,1000\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	opts := defaultOptions(500, 1000)
+	opts.NormalizeIDs = true
+	opts.IDStrip = "-_"
+	applicants, _, err := loadApplicants(path, 1, false, nil, nil, optionIDNormalization(opts), 0)
+	if err != nil {
+		t.Fatalf("load input: %v", err)
+	}
+	ids := []string{applicants[0].ID, applicants[1].ID, applicants[2].ID}
+	if strings.Join(ids, ",") != "A123,A124,B125" {
+		t.Fatalf("unexpected normalized IDs: %v", ids)
+	}
+	if applicants[0].OriginalID != "A-123" || applicants[2].OriginalID != "b125" {
+		t.Fatalf("expected original IDs kept for display, got %q and %q", applicants[0].OriginalID, applicants[2].OriginalID)
+	}
+
+	prepApplicants(applicants, 0.7, 0.3)
+	opts.Rounds = 2
+	opts.DeclinedIDs = []string{"a-123"}
+	awarded, _ := allocateRounds(applicants, 2000, opts)
+	summary := summarize(applicants, 2000, awarded, "")
+	if !applicants[0].Declined {
+		t.Fatalf("expected a-123 to match A-123 as declined")
+	}
+	if _, err := buildAppeal(applicants, " a_124", summary, opts); err != nil {
+		t.Fatalf("expected the appeal ID to be normalized: %v", err)
+	}
+	originals := make(map[string]string)
+	for _, record := range append(summary.Awards, summary.Unfunded...) {
+		originals[record.ApplicantID] = record.OriginalID
+	}
+	if originals["B125"] != "b125" {
+		t.Fatalf("expected original_id in the output records, got %v", originals)
+	}
+
+	opts.IDStrip = "-x"
+	if err := validateOptions(opts); err == nil || !strings.Contains(err.Error(), "non-alphanumeric") {
+		t.Fatalf("expected letters in id-strip to be rejected, got %v", err)
+	}
+}
+
+// fakeSchemaDB serves seeded information_schema.columns rows as
+// table, column, data_type triples.
+type fakeSchemaDB struct {
+	columns [][3]string
+}
+
+func (f *fakeSchemaDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if !strings.Contains(sql, "information_schema.columns") {
+		return nil, errors.New("unexpected query")
+	}
+	return &fakeColumnRows{columns: f.columns}, nil
+}
+
+type fakeColumnRows struct {
+	fakeRows
+	columns [][3]string
+}
+
+func (r *fakeColumnRows) Next() bool { r.index++; return r.index <= len(r.columns) }
+func (r *fakeColumnRows) Scan(dest ...any) error {
+	for i, value := range r.columns[r.index-1] {
+		*dest[i].(*string) = value
+	}
+	return nil
+}
+
+func TestCheckColumnTypesReportsIncompatibleColumns(t *testing.T) {
+	compatible := &fakeSchemaDB{columns: [][3]string{
+		{"runs", "budget", "numeric"},
+		{"runs", "generated_at", "timestamp with time zone"},
+		{"runs", "rounds", "integer"},
+		{"runs", "legacy_note", "text"},
+		{"applicants", "id", "bigint"},
+	}}
+	if err := checkColumnTypes(context.Background(), compatible, "gs_award_allocator"); err != nil {
+		t.Fatalf("expected matching columns to pass, got %v", err)
+	}
+
+	mismatched := &fakeSchemaDB{columns: [][3]string{
+		{"runs", "budget", "text"},
+		{"applicants", "eligible", "integer"},
+		{"need_coverage", "share_delta", "numeric"},
+	}}
+	err := checkColumnTypes(context.Background(), mismatched, "gs_award_allocator")
+	if err == nil {
+		t.Fatalf("expected mismatched column types to be rejected")
+	}
+	for _, want := range []string{
+		"column applicants.eligible is type integer, expected boolean",
+		"column runs.budget is type text, expected numeric",
+		"set GS_AWARD_ALLOCATOR_SCHEMA to a fresh schema",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in error, got %v", want, err)
+		}
+	}
+}
+
+func TestSourceLinesSurviveAllocation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lines.csv")
+	content := "applicant_id,score,need_level,requested_amount\n" +
+		"\n" +
+		"a-1,70,low,1000\n" +
+		"a-2,oops,high,1000\n" +
+		"a-3,95,high,1000\n" +
+		"a-4,80,unknown,1000\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	applicants, warnings, err := loadApplicants(path, 1, false, nil, nil, idNormalization{}, 0)
+	if err != nil {
+		t.Fatalf("load input: %v", err)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "line 4:") {
+		t.Fatalf("expected the bad score warning on file line 4, got %v", warnings)
+	}
+	prepApplicants(applicants, 0.7, 0.3)
+	awarded := allocateBudget(applicants, 1000, defaultOptions(1000, 1000))
+	summary := summarize(applicants, 1000, awarded, "")
+
+	if len(summary.Awards) != 1 || summary.Awards[0].ApplicantID != "a-3" || summary.Awards[0].SourceLine != 5 {
+		t.Fatalf("expected a-3 awarded from line 5, got %+v", summary.Awards)
+	}
+	if len(summary.Unfunded) != 1 || summary.Unfunded[0].SourceLine != 3 {
+		t.Fatalf("expected a-1 unfunded from line 3 after the blank line, got %+v", summary.Unfunded)
+	}
+	if len(summary.Ineligible) != 1 || summary.Ineligible[0].SourceLine != 6 {
+		t.Fatalf("expected a-4 ineligible from line 6, got %+v", summary.Ineligible)
+	}
+
+	out := filepath.Join(dir, "awards.csv")
+	if err := writeAwardsCSV(out, summary.Awards, 4, false, true); err != nil {
+		t.Fatalf("write awards CSV: %v", err)
+	}
+	written, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read awards CSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(written)), "\n")
+	if !strings.HasSuffix(lines[0], ",source_line") || !strings.HasSuffix(lines[1], ",5") {
+		t.Fatalf("expected a source_line column, got %q", written)
+	}
+}
+
 func floatEquals(a, b float64) bool {
 	return math.Abs(a-b) < 1e-6
 }